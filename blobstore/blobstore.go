@@ -0,0 +1,29 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps homework file contents outside the database. Keys are slash-separated
+// paths such as "<user_id>/<date>/<sha256>".
+type Store interface {
+	// Put stores the blob unless one already exists under the key. Keys name their
+	// content and may be shared by several submissions, so a stored blob is never
+	// replaced: a failed re-upload must not take it away from them.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Checksum returns the hex-encoded SHA-256 of data
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
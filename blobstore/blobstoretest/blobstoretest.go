@@ -0,0 +1,85 @@
+// Package blobstoretest checks that a blobstore.Store behaves as the interface promises.
+package blobstoretest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"dashka-homework-bot/blobstore"
+)
+
+// TestStore runs the checks every backend must pass against store. Keys are placed
+// under prefix, so several runs may share one bucket or database.
+func TestStore(t *testing.T, store blobstore.Store, prefix string) {
+	t.Run("put and get", func(t *testing.T) {
+		key := prefix + "/put/blob"
+		put(t, store, key, "first")
+		if got := get(t, store, key); got != "first" {
+			t.Errorf("Get() = %q, want %q", got, "first")
+		}
+	})
+
+	t.Run("put existing key", func(t *testing.T) {
+		// A stored blob is never replaced
+		key := prefix + "/existing/blob"
+		put(t, store, key, "first")
+		put(t, store, key, "second")
+		if got := get(t, store, key); got != "first" {
+			t.Errorf("Get() = %q, want %q", got, "first")
+		}
+	})
+
+	t.Run("get missing key", func(t *testing.T) {
+		_, err := store.Get(context.Background(), prefix+"/missing/blob")
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			t.Errorf("Get() error = %v, want %v", err, blobstore.ErrNotFound)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		ctx := context.Background()
+		key := prefix + "/delete/blob"
+		put(t, store, key, "first")
+
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, blobstore.ErrNotFound) {
+			t.Errorf("Get() after Delete() error = %v, want %v", err, blobstore.ErrNotFound)
+		}
+
+		// Deleting again is not an error, and the key can be stored anew
+		if err := store.Delete(ctx, key); err != nil {
+			t.Errorf("second Delete() error = %v", err)
+		}
+		put(t, store, key, "second")
+		if got := get(t, store, key); got != "second" {
+			t.Errorf("Get() after new Put() = %q, want %q", got, "second")
+		}
+	})
+}
+
+func put(t *testing.T, store blobstore.Store, key, data string) {
+	t.Helper()
+	if err := store.Put(context.Background(), key, bytes.NewReader([]byte(data)), int64(len(data))); err != nil {
+		t.Fatalf("Put(%s) error = %v", key, err)
+	}
+}
+
+func get(t *testing.T, store blobstore.Store, key string) string {
+	t.Helper()
+	r, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", key, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", key, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,60 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dashka-homework-bot/blobstore/blobstoretest"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobstoretest.TestStore(t, store, "user")
+}
+
+func TestPutLeavesNoTemporaryFiles(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(context.Background(), "user/2026-10-19/sum", bytes.NewReader([]byte("data")), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "user", "2026-10-19"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "sum" {
+		t.Errorf("directory holds %v, want only the blob", entries)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../outside", "/etc/passwd", "", "."} {
+		t.Run(key, func(t *testing.T) {
+			ctx := context.Background()
+			if err := store.Put(ctx, key, bytes.NewReader(nil), 0); err == nil {
+				t.Error("Put() error = nil, want an invalid key")
+			}
+			if _, err := store.Get(ctx, key); err == nil {
+				t.Error("Get() error = nil, want an invalid key")
+			}
+			if err := store.Delete(ctx, key); err == nil {
+				t.Error("Delete() error = nil, want an invalid key")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package gridfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"dashka-homework-bot/blobstore"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const bucketName = "homework_files"
+
+var _ blobstore.Store = (*Store)(nil)
+
+// Store keeps blobs in a MongoDB GridFS bucket, using the key as the file name
+type Store struct {
+	database *mongo.Database
+}
+
+func NewStore(database *mongo.Database) *Store {
+	return &Store{database: database}
+}
+
+// bucket opens a bucket bound to the context deadline. Deadlines are per bucket,
+// so every call gets its own.
+func (s *Store) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(s.database, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GridFS bucket: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetReadDeadline(deadline)
+		bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The key fixes the content, so an existing file is already this blob
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": key}, options.GridFSFind().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("failed to find blob %s: %w", key, err)
+	}
+	exists := cursor.Next(ctx)
+	cursor.Close(ctx)
+	if exists {
+		return nil
+	}
+
+	if _, err := bucket.UploadFromStream(key, r); err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := bucket.OpenDownloadStreamByName(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s: %w", key, blobstore.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+	return stream, nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	bucket, err := s.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := bucket.FindContext(ctx, bson.M{"filename": key})
+	if err != nil {
+		return fmt.Errorf("failed to find blob %s: %w", key, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var file struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&file); err != nil {
+			return fmt.Errorf("failed to decode blob %s: %w", key, err)
+		}
+		if err := bucket.DeleteContext(ctx, file.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return fmt.Errorf("failed to delete blob %s: %w", key, err)
+		}
+	}
+	return cursor.Err()
+}
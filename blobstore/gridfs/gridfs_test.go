@@ -0,0 +1,38 @@
+package gridfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/blobstore/blobstoretest"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestStore runs against a real MongoDB in a throwaway database:
+// MONGO_TEST_URI=mongodb://localhost:27017 go test ./blobstore/gridfs
+func TestStore(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect to MongoDB: %v", err)
+	}
+	database := client.Database(fmt.Sprintf("homework_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	blobstoretest.TestStore(t, NewStore(database), "user")
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"dashka-homework-bot/blobstore"
+)
+
+var _ blobstore.Store = (*Store)(nil)
+
+// Store keeps blobs in process memory, for running the bot without any backing service
+type Store struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewStore() *Store {
+	return &Store{blobs: make(map[string][]byte)}
+}
+
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[key]; !ok {
+		s.blobs[key] = data
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, blobstore.ErrNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
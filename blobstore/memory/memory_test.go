@@ -0,0 +1,11 @@
+package memory
+
+import (
+	"testing"
+
+	"dashka-homework-bot/blobstore/blobstoretest"
+)
+
+func TestStore(t *testing.T) {
+	blobstoretest.TestStore(t, NewStore(), "user")
+}
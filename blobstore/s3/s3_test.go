@@ -0,0 +1,41 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/blobstore/blobstoretest"
+)
+
+// TestStore runs against a real S3-compatible server, e.g. the MinIO of
+// docker-compose.yml: MINIO_ENDPOINT=localhost:9000 go test ./blobstore/s3
+func TestStore(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+
+	cfg := Config{
+		Endpoint:  endpoint,
+		AccessKey: envOr("MINIO_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("MINIO_SECRET_KEY", "minioadmin"),
+		Bucket:    envOr("MINIO_BUCKET", "homework-test"),
+		UseSSL:    os.Getenv("MINIO_USE_SSL") == "true",
+	}
+	store, err := NewStore(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	blobstoretest.TestStore(t, store, fmt.Sprintf("test-%d", time.Now().UnixNano()))
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -2,36 +2,77 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	//"time"
 	//"dashka-homework-bot/storage/mongo"
 	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// Add new handler methods
+// handleAddStudent sends the student a link request to approve. Nothing is linked
+// until they do, or until the parent opens an invite link from /invite. Without an
+// argument the student can be picked from the parent's chats with a keyboard button.
 func (h *Handler) handleAddStudent(message *tgbotapi.Message) {
 	args := strings.Fields(message.CommandArguments())
 	if len(args) < 1 {
-		h.sendMessage(message.Chat.ID, "Пожалуйста, укажите Telegram-имя пользователя студента.\nИспользование: /addstudent @username")
+		msg := tgbotapi.NewMessage(message.Chat.ID, "Нажмите кнопку ниже и выберите ученика из своих чатов.\n"+
+			"Или укажите имя пользователя: /addstudent @username\n\n"+
+			"Еще можно попросить ученика отправить боту /invite и открыть ссылку из ответа.")
+		msg.ReplyMarkup = pickStudentKeyboard()
+		if _, err := h.bot.Send(msg); err != nil {
+			logger.Error("Error sending message: %v", err)
+		}
 		return
 	}
 
-	parentUserID := fmt.Sprintf("%d", message.From.ID)
+	ctx := context.Background()
 	studentUsername := args[0]
+	student, err := h.db.GetUserByUsername(ctx, studentUsername)
+	if err != nil {
+		logger.Error("Error finding student %s for parent %d: %v", studentUsername, message.From.ID, err)
+		h.replyStudentNotFound(message.Chat.ID, err)
+		return
+	}
 
-	ctx := context.Background()
-	err := h.db.AddStudentContact(ctx, parentUserID, studentUsername)
+	h.addStudent(ctx, message, student)
+}
+
+// addStudent asks the student to approve the sender of message as their parent
+func (h *Handler) addStudent(ctx context.Context, message *tgbotapi.Message, student *storage.User) {
+	parentUserID := fmt.Sprintf("%d", message.From.ID)
+	parent, err := h.db.GetUser(ctx, parentUserID)
 	if err != nil {
-		logger.Error("Error adding student contact for parent %s: %v", parentUserID, err)
-		h.sendMessage(message.Chat.ID, fmt.Sprintf("Не удалось добавить студента: %v", err))
+		logger.Error("Error getting parent %s: %v", parentUserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить вашу информацию. Пожалуйста, попробуйте снова.")
+		return
+	}
+
+	if student.UserID == parentUserID {
+		h.sendMessage(message.Chat.ID, "Нельзя добавить самого себя.")
+		return
+	}
+	if isLinkedParent(parent, student) {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("%s уже в ваших контактах.", studentName(parent, student)))
 		return
 	}
 
-	h.sendMessage(message.Chat.ID, fmt.Sprintf("Успешно добавлен студент %s в ваши контакты. Теперь вы можете проверять его домашку с помощью /checkhw", studentUsername))
+	if err := h.requestLink(ctx, message.Chat.ID, parent, student); err != nil {
+		logger.Error("Error requesting link of parent %s to %s: %v", parentUserID, student.UserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось отправить запрос ученику, попробуйте позже")
+	}
+}
+
+func (h *Handler) replyStudentNotFound(chatID int64, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		h.sendMessage(chatID, "Ученик не найден. Он должен хотя бы раз написать боту, или попросите его отправить /invite.")
+		return
+	}
+	h.sendMessage(chatID, "Не удалось добавить студента, попробуйте позже")
 }
 
 // TODO: can make /homework_status for adult to check on student
@@ -46,58 +87,128 @@ func (h *Handler) handleCheckHomework(message *tgbotapi.Message) {
 		return
 	}
 
-	if len(parent.UserContacts) == 0 {
-		h.sendMessage(message.Chat.ID, "Вы еще не добавили ни одного студента. Используйте команду /addstudent @username, чтобы добавить студента.")
+	if len(parent.StudentIDs) == 0 {
+		h.sendMessage(message.Chat.ID, "Вы еще не добавили ни одного студента. Используйте команду /addstudent, чтобы добавить студента.")
 		return
 	}
 
-	// For each student, check and send homework status
-	for _, studentUsername := range parent.UserContacts {
-		dayName := getNextDayName() // Using your existing function
-		completed, incomplete, homeworks, err := h.db.GetHomeworkStatus(ctx, studentUsername, dayName)
+	// For each student, check and send homework status for their tomorrow
+	for _, student := range h.linkedStudents(ctx, parent) {
+		name := studentName(parent, &student)
+		date := h.nextDate(ctx, &student)
+		completed, incomplete, homeworks, err := h.db.GetHomeworkStatus(ctx, student.UserID, date)
 		if err != nil {
-			logger.Error("Error checking homework for student %s: %v", studentUsername, err)
-			h.sendMessage(message.Chat.ID, fmt.Sprintf("Не удалось проверить домашку для студента %s", studentUsername))
+			logger.Error("Error checking homework for student %s: %v", student.UserID, err)
+			h.sendMessage(message.Chat.ID, fmt.Sprintf("Не удалось проверить домашку для студента %s", name))
 			continue
 		}
 
 		// Send status message
-		statusMsg := fmt.Sprintf("Статус домашнего задания для %s:\n\n", studentUsername)
-		if len(completed) > 0 {
-			statusMsg += "✅ Начата домашка:\n"
-			for _, subject := range completed {
-				statusMsg += fmt.Sprintf("- %s\n", subject)
+		h.sendMessage(message.Chat.ID, formatHomeworkStatus(name, date, completed, incomplete, homeworks, h.lessonTasks(ctx, student.UserID, date)))
+
+		// Send homework of completed subjects in timetable order
+		for _, subject := range completed {
+			if err := h.sendSubjectHomework(ctx, message.Chat.ID, subject, homeworks[subject]); err != nil {
+				logger.Error("Error sending homework: %v", err)
+				h.sendMessage(message.Chat.ID, fmt.Sprintf("Не удалось отправить некоторые файлы домашки по %s", subject))
 			}
 		}
-		if len(incomplete) > 0 {
-			statusMsg += "\n❌ Не начата домашка:\n"
-			for _, subject := range incomplete {
-				statusMsg += fmt.Sprintf("- %s\n", subject)
+	}
+}
+
+// linkedStudents returns the students linked to the parent, skipping any that can't be loaded
+func (h *Handler) linkedStudents(ctx context.Context, parent *storage.User) []storage.User {
+	var students []storage.User
+	for _, studentID := range parent.StudentIDs {
+		student, err := h.db.GetUser(ctx, studentID)
+		if err != nil {
+			logger.Error("Error getting student %s: %v", studentID, err)
+			continue
+		}
+		students = append(students, *student)
+	}
+	return students
+}
+
+// handleHistory shows the homework status for the lessons of a past or future date
+func (h *Handler) handleHistory(message *tgbotapi.Message) {
+	date, ok := parseDate(message.CommandArguments())
+	if !ok {
+		h.sendMessage(message.Chat.ID, "Использование: /history дд.мм\nПример: /history 14.10")
+		return
+	}
+
+	userID := fmt.Sprintf("%d", message.From.ID)
+	ctx := context.Background()
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить вашу информацию. Пожалуйста, попробуйте снова.")
+		return
+	}
+
+	// Parents see their students, students see themselves
+	students := h.linkedStudents(ctx, user)
+	if len(user.StudentIDs) == 0 {
+		students = []storage.User{*user}
+	}
+
+	for _, student := range students {
+		name := studentName(user, &student)
+		completed, incomplete, homeworks, err := h.db.GetHomeworkStatus(ctx, student.UserID, date)
+		if err != nil {
+			logger.Error("Error getting history for student %s: %v", student.UserID, err)
+			h.sendMessage(message.Chat.ID, fmt.Sprintf("Не удалось получить историю для %s", name))
+			continue
+		}
+
+		statusMsg := formatHomeworkStatus(name, date, completed, incomplete, homeworks, h.lessonTasks(ctx, student.UserID, date))
+		if len(homeworks) > 0 {
+			statusMsg += "\n📎 Загружено:\n"
+			for _, subject := range completed {
+				statusMsg += fmt.Sprintf("- %s: %s\n", subject, formatFileCounts(homeworks[subject]))
 			}
 		}
 		h.sendMessage(message.Chat.ID, statusMsg)
+	}
+}
+
+// reviewSections are the headings of formatHomeworkStatus in display order
+var reviewSections = []struct {
+	status string
+	title  string
+}{
+	{storage.SubjectApproved, "✅ Одобрено:"},
+	{storage.SubjectAwaitingReview, "👀 Ждет проверки:"},
+	{storage.SubjectStarted, "✏️ Начата домашка:"},
+	{storage.SubjectNeedsRedo, "❗ Нужно переделать:"},
+}
 
-		// Send homework photos for completed subjects
-		for subject, homeworkList := range homeworks {
-			h.sendMessage(message.Chat.ID, fmt.Sprintf("\n📚 Фото домашки для %s:", subject))
-			for _, homework := range homeworkList {
-				// Create photo message
-				photoMsg := tgbotapi.NewPhoto(message.Chat.ID, tgbotapi.FileBytes{
-					Name:  "homework.jpg",
-					Bytes: homework.Photo,
-				})
-				photoMsg.Caption = fmt.Sprintf("Предмет: %s\nЗагружено в: %s",
-					subject,
-					homework.UploadedAt.Format("15:04 02.01.2006"))
-
-				_, err := h.bot.Send(photoMsg)
-				if err != nil {
-					logger.Error("Error sending homework photo: %v", err)
-					h.sendMessage(message.Chat.ID, "Не удалось отправить некоторые фото домашнего задания")
-				}
+// formatHomeworkStatus lists the subjects by review status, each with its assignment
+// from tasks when there is one
+func formatHomeworkStatus(studentName, date string, completed, incomplete []string, homeworks map[string][]storage.Homework, tasks map[string]string) string {
+	statusMsg := fmt.Sprintf("Статус домашнего задания для %s на %s:\n", studentName, formatDate(date))
+	for _, section := range reviewSections {
+		var lines string
+		for _, subject := range completed {
+			if storage.SubjectReviewStatus(homeworks[subject]) == section.status {
+				lines += fmt.Sprintf("- %s\n", formatLesson(subject, tasks[subject]))
 			}
 		}
+		if lines != "" {
+			statusMsg += "\n" + section.title + "\n" + lines
+		}
+	}
+	if len(incomplete) > 0 {
+		statusMsg += "\n❌ Не начата домашка:\n"
+		for _, subject := range incomplete {
+			statusMsg += fmt.Sprintf("- %s\n", formatLesson(subject, tasks[subject]))
+		}
+	}
+	if len(completed) == 0 && len(incomplete) == 0 {
+		statusMsg += "Уроков нет\n"
 	}
+	return statusMsg
 }
 
 // func (h *Handler) StartDailySummaryTask() {
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	adminPrefix        = "admin"
+	adminResetSchedule = "reset"
+	adminGrant         = "grant"
+	adminRevoke        = "revoke"
+
+	// statsDays is how many days /admin_stats covers, today included
+	statsDays = 7
+	// broadcastInterval keeps broadcasts well under Telegram's limit of about 30
+	// messages a second
+	broadcastInterval = 50 * time.Millisecond
+	// maxMessageLen leaves room below Telegram's limit of 4096 characters
+	maxMessageLen = 4000
+)
+
+// adminCommands are shown in the command menu of admins only
+var adminCommands = []tgbotapi.BotCommand{
+	{Command: "admin_users", Description: "Пользователи и их роли"},
+	{Command: "admin_stats", Description: "Статистика сданных работ"},
+	{Command: "admin_user", Description: "Пользователь: данные и сброс расписания"},
+	{Command: "admin_broadcast", Description: "Сообщение всем пользователям"},
+}
+
+const adminHelp = "\n\n*Администрирование*\n" +
+	"*/admin_users* - Пользователи и их роли.\n" +
+	"*/admin_stats* - Сданные работы по дням и активные ученики.\n" +
+	"*/admin_user ID* - Данные пользователя, сброс расписания.\n" +
+	"*/admin_broadcast текст* - Сообщение всем пользователям."
+
+// isAdmin reports whether the user has the admin role or is configured as an admin
+func (h *Handler) isAdmin(user *storage.User) bool {
+	return user.Role == storage.RoleAdmin || h.admins[user.UserID]
+}
+
+// isAdminCommand reports whether the command is one of adminCommands
+func isAdminCommand(command string) bool {
+	return slices.ContainsFunc(adminCommands, func(c tgbotapi.BotCommand) bool { return c.Command == command })
+}
+
+// setAdminCommands adds the admin commands to the command menu in each admin's chat
+func (h *Handler) setAdminCommands(ctx context.Context) error {
+	users, err := h.db.GetAllUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find admins: %w", err)
+	}
+
+	admins := make(map[string]bool)
+	for userID := range h.admins {
+		admins[userID] = true
+	}
+	for _, user := range users {
+		if user.Role == storage.RoleAdmin {
+			admins[user.UserID] = true
+		}
+	}
+
+	for userID := range admins {
+		if err := h.setChatCommands(userID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setChatCommands sets the command menu in the user's chat, with the admin commands
+// or back to the menu everyone has
+func (h *Handler) setChatCommands(userID string, admin bool) error {
+	chatID, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid admin ID %q: %w", userID, err)
+	}
+
+	scope := tgbotapi.NewBotCommandScopeChat(chatID)
+	var config tgbotapi.Chattable = tgbotapi.NewDeleteMyCommandsWithScope(scope)
+	if admin {
+		config = tgbotapi.NewSetMyCommandsWithScope(scope, slices.Concat(botCommands, adminCommands)...)
+	}
+	if _, err := h.bot.Request(config); err != nil {
+		return fmt.Errorf("failed to set commands for %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (h *Handler) handleAdminUsers(message *tgbotapi.Message) {
+	ctx := context.Background()
+	users, err := h.db.GetAllUsers(ctx)
+	if err != nil {
+		logger.Error("Error getting users: %v", err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить пользователей, попробуйте позже")
+		return
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+
+	lines := []string{fmt.Sprintf("👥 Пользователи: %d\n%s\n", len(users), formatRoleCounts(users))}
+	for _, user := range users {
+		line := fmt.Sprintf("%s — %s, с %s", displayName(&user), formatRole(user.Role), user.CreatedAt.Format("02.01.2006"))
+		if h.isAdmin(&user) && user.Role != storage.RoleAdmin {
+			line += ", администратор"
+		}
+		if user.Username != "" {
+			line += ", ID " + user.UserID
+		}
+		if len(user.StudentIDs) > 0 {
+			line += fmt.Sprintf(", учеников: %d", len(user.StudentIDs))
+		}
+		lines = append(lines, line)
+	}
+	h.sendLines(message.Chat.ID, lines)
+}
+
+func (h *Handler) handleAdminStats(message *tgbotapi.Message) {
+	ctx := context.Background()
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-statsDays+1, 0, 0, 0, 0, now.Location())
+
+	homeworks, err := h.db.GetHomeworkUploadedSince(ctx, since)
+	if err != nil {
+		logger.Error("Error getting homework since %s: %v", since, err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить статистику, попробуйте позже")
+		return
+	}
+
+	users, err := h.db.GetAllUsers(ctx)
+	if err != nil {
+		logger.Error("Error getting users: %v", err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить статистику, попробуйте позже")
+		return
+	}
+
+	// Days are counted by upload time in the server's zone
+	submissions := make(map[string]int)
+	dayStudents := make(map[string]map[string]bool)
+	active := make(map[string]bool)
+	for _, homework := range homeworks {
+		day := storage.DateKey(homework.UploadedAt.In(now.Location()))
+		submissions[day]++
+		if dayStudents[day] == nil {
+			dayStudents[day] = make(map[string]bool)
+		}
+		dayStudents[day][homework.StudentID] = true
+		active[homework.StudentID] = true
+	}
+
+	text := fmt.Sprintf("📊 Статистика за %d дней\n\nПользователей: %d\n%s\nАктивных учеников: %d\n\nСдано работ по дням:\n",
+		statsDays, len(users), formatRoleCounts(users), len(active))
+	for i := 0; i < statsDays; i++ {
+		day := storage.DateKey(since.AddDate(0, 0, i))
+		text += fmt.Sprintf("%s — %d (учеников: %d)\n", formatDate(day), submissions[day], len(dayStudents[day]))
+	}
+	h.sendMessage(message.Chat.ID, text)
+}
+
+// handleAdminBroadcast sends the text to every user. Sending runs in the background
+// at a limited rate and the admin gets a report at the end.
+func (h *Handler) handleAdminBroadcast(message *tgbotapi.Message) {
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /admin_broadcast <текст>")
+		return
+	}
+
+	users, err := h.db.GetAllUsers(context.Background())
+	if err != nil {
+		logger.Error("Error getting users: %v", err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить пользователей, попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("Рассылка для %d пользователей началась.", len(users)))
+	go h.broadcast(message.Chat.ID, "📢 "+text, users)
+}
+
+func (h *Handler) broadcast(adminChatID int64, text string, users []storage.User) {
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+
+	sent := 0
+	for _, user := range users {
+		<-ticker.C
+		chatID, err := strconv.ParseInt(user.UserID, 10, 64)
+		if err != nil {
+			logger.Error("Error converting user ID %s: %v", user.UserID, err)
+			continue
+		}
+		if err := h.sendRateLimited(tgbotapi.NewMessage(chatID, text)); err != nil {
+			logger.Error("Error broadcasting to user %s: %v", user.UserID, err)
+			continue
+		}
+		sent++
+	}
+
+	logger.Info("Broadcast delivered to %d of %d users", sent, len(users))
+	h.sendMessage(adminChatID, fmt.Sprintf("Рассылка завершена: доставлено %d из %d.", sent, len(users)))
+}
+
+// sendRateLimited sends the message and, if Telegram asks to slow down, waits as long
+// as it says and tries once more
+func (h *Handler) sendRateLimited(msg tgbotapi.Chattable) error {
+	_, err := retryRateLimited(func() (tgbotapi.Message, error) {
+		return h.bot.Send(msg)
+	})
+	return err
+}
+
+// retryRateLimited calls send and, if Telegram asks to slow down, waits as long as it
+// says and calls it once more
+func retryRateLimited[T any](send func() (T, error)) (T, error) {
+	result, err := send()
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter == 0 {
+		return result, err
+	}
+
+	time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+	return send()
+}
+
+// handleAdminUser shows a user by ID or @username, with buttons to give or take the
+// admin role and to reset a student's timetable
+func (h *Handler) handleAdminUser(message *tgbotapi.Message) {
+	ctx := context.Background()
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /admin_user <ID или @username>")
+		return
+	}
+
+	var user *storage.User
+	var err error
+	if strings.HasPrefix(arg, "@") {
+		user, err = h.db.GetUserByUsername(ctx, arg)
+	} else {
+		user, err = h.db.GetUser(ctx, arg)
+	}
+	if err != nil {
+		logger.Error("Error getting user %s: %v", arg, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendMessage(message.Chat.ID, "Пользователь не найден.")
+		} else {
+			h.sendMessage(message.Chat.ID, "Не удалось получить пользователя, попробуйте позже")
+		}
+		return
+	}
+
+	text := fmt.Sprintf("👤 %s\nID: %s\nРоль: %s\nС нами с: %s\n",
+		displayName(user), user.UserID, formatRole(user.Role), user.CreatedAt.Format("02.01.2006"))
+	if h.isAdmin(user) && user.Role != storage.RoleAdmin {
+		text += "Администратор\n"
+	}
+	if user.Timezone != "" {
+		text += "Часовой пояс: " + user.Timezone + "\n"
+	}
+
+	if students := h.linkedStudents(ctx, user); len(students) > 0 {
+		text += "Ученики:\n"
+		for _, student := range students {
+			text += fmt.Sprintf("- %s (ID %s)\n", studentName(user, &student), student.UserID)
+		}
+	}
+
+	roleButton := tgbotapi.NewInlineKeyboardButtonData("🛡 Сделать администратором", adminPrefix+":"+adminGrant+":"+user.UserID)
+	if user.Role == storage.RoleAdmin {
+		roleButton = tgbotapi.NewInlineKeyboardButtonData("Снять роль администратора", adminPrefix+":"+adminRevoke+":"+user.UserID)
+	}
+	row := tgbotapi.NewInlineKeyboardRow(roleButton)
+
+	if user.Role == storage.RoleStudent {
+		if parents, err := h.parentsOf(ctx, user); err == nil && len(parents) > 0 {
+			text += "Родители:\n"
+			for _, parent := range parents {
+				text += fmt.Sprintf("- %s (ID %s)\n", displayName(&parent), parent.UserID)
+			}
+		}
+		text += "\n" + formatWeek(user.Schedule)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("🗑 Сбросить расписание", adminPrefix+":"+adminResetSchedule+":"+user.UserID))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Error sending message: %v", err)
+	}
+}
+
+func (h *Handler) handleAdminCallback(query *tgbotapi.CallbackQuery, data string) {
+	ctx := context.Background()
+	admin, err := h.db.GetUser(ctx, fmt.Sprintf("%d", query.From.ID))
+	if err != nil || !h.isAdmin(admin) {
+		h.answerCallback(query, "Только для администраторов")
+		return
+	}
+
+	action, userID, _ := strings.Cut(data, ":")
+	switch action {
+	case adminGrant, adminRevoke:
+		// Without the admin role the user picks a role of their own again
+		role := ""
+		if action == adminGrant {
+			role = storage.RoleAdmin
+		}
+		if err := h.setRole(ctx, userID, role); err != nil {
+			logger.Error("Error setting role of user %s: %v", userID, err)
+			h.answerCallback(query, "Не удалось сменить роль")
+			return
+		}
+		user, err := h.db.GetUser(ctx, userID)
+		if err == nil {
+			err = h.setChatCommands(userID, h.isAdmin(user))
+		}
+		if err != nil {
+			logger.Error("Error updating commands of user %s: %v", userID, err)
+		}
+		logger.Info("Admin %d set the role of user %s to %q", query.From.ID, userID, role)
+		h.answerCallback(query, "Роль изменена")
+		h.editCallbackMessage(query, fmt.Sprintf("Пользователь %s: %s.", userID, formatRole(role)))
+	case adminResetSchedule:
+		if err := h.db.SetSchedule(ctx, userID, storage.EmptySchedule()); err != nil {
+			logger.Error("Error resetting schedule of user %s: %v", userID, err)
+			h.answerCallback(query, "Не удалось сбросить расписание")
+			return
+		}
+		logger.Info("Admin %d reset the schedule of user %s", query.From.ID, userID)
+		h.answerCallback(query, "Расписание сброшено")
+		h.editCallbackMessage(query, fmt.Sprintf("Расписание пользователя %s сброшено.", userID))
+	default:
+		h.answerCallback(query, "")
+	}
+}
+
+func formatRole(role string) string {
+	if role == "" {
+		return "не выбрана"
+	}
+	return strings.ToLower(roleTitle(role))
+}
+
+func formatRoleCounts(users []storage.User) string {
+	counts := make(map[string]int)
+	for _, user := range users {
+		counts[user.Role]++
+	}
+
+	var parts []string
+	for _, role := range []string{storage.RoleStudent, storage.RoleParent, storage.RoleTutor, storage.RoleAdmin, ""} {
+		if counts[role] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", formatRole(role), counts[role]))
+		}
+	}
+	return "Роли: " + strings.Join(parts, ", ")
+}
+
+// sendLines sends the lines in as few messages as fit Telegram's length limit
+func (h *Handler) sendLines(chatID int64, lines []string) {
+	text := ""
+	for _, line := range lines {
+		if len(text)+len(line)+1 > maxMessageLen && text != "" {
+			h.sendMessage(chatID, text)
+			text = ""
+		}
+		text += line + "\n"
+	}
+	if text != "" {
+		h.sendMessage(chatID, text)
+	}
+}
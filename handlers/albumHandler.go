@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// albumWindow is how long an album is collected after its latest part arrived.
+// Telegram sends the parts of an album right after one another.
+const albumWindow = 2 * time.Second
+
+// album collects the parts of a media group, so they are submitted as one homework
+type album struct {
+	// message is the first part to arrive; replies go to its chat
+	message *tgbotapi.Message
+	// caption is the caption of whichever part has one
+	caption string
+	parts   []albumPart
+	timer   *time.Timer
+}
+
+type albumPart struct {
+	messageID int
+	file      homeworkFile
+}
+
+// addAlbumPart adds a part to its album. The album is submitted once no new part has
+// arrived for albumWindow.
+func (h *Handler) addAlbumPart(message *tgbotapi.Message, file homeworkFile) {
+	h.albumsLock.Lock()
+	defer h.albumsLock.Unlock()
+
+	id := message.MediaGroupID
+	a, ok := h.albums[id]
+	if !ok {
+		a = &album{message: message}
+		chatID := message.Chat.ID
+		a.timer = time.AfterFunc(albumWindow, func() {
+			h.runInChat(chatID, "album "+id, func() { h.flushAlbum(id) })
+		})
+		h.albums[id] = a
+	} else {
+		a.timer.Reset(albumWindow)
+	}
+
+	if a.caption == "" {
+		a.caption = message.Caption
+	}
+	a.parts = append(a.parts, albumPart{messageID: message.MessageID, file: file})
+}
+
+// FlushAlbums submits the albums of a chat that are still being collected, except the
+// album with mediaGroupID. The updater calls it before handling any other update of the
+// chat, so an album is saved before whatever was sent after it.
+func (h *Handler) FlushAlbums(chatID int64, mediaGroupID string) {
+	h.albumsLock.Lock()
+	var ids []string
+	for id, a := range h.albums {
+		if a.message.Chat.ID == chatID && id != mediaGroupID {
+			ids = append(ids, id)
+		}
+	}
+	h.albumsLock.Unlock()
+
+	for _, id := range ids {
+		h.flushAlbum(id)
+	}
+}
+
+// flushAlbum submits the collected parts in the order they were sent
+func (h *Handler) flushAlbum(id string) {
+	h.albumsLock.Lock()
+	a, ok := h.albums[id]
+	delete(h.albums, id)
+	h.albumsLock.Unlock()
+
+	// Already flushed by a later update of the chat, or by an earlier timer
+	if !ok {
+		return
+	}
+	a.timer.Stop()
+
+	sort.Slice(a.parts, func(i, j int) bool { return a.parts[i].messageID < a.parts[j].messageID })
+	files := make([]homeworkFile, len(a.parts))
+	for i, part := range a.parts {
+		files[i] = part.file
+	}
+	h.submitFiles(a.message, a.caption, files)
+}
+
+// maxAlbumSize is the most files Telegram puts in one media group
+const maxAlbumSize = 10
+
+// sendSubjectHomework sends the submissions of a subject in upload order. Several
+// photos go as albums of up to maxAlbumSize, one caption each. Albums can't have
+// buttons, so the review buttons follow in a message of their own and review the
+// latest photo, which decides the subject's status. Other files are sent one by one.
+func (h *Handler) sendSubjectHomework(ctx context.Context, chatID int64, subject string, homeworks []storage.Homework) error {
+	sorted := append([]storage.Homework(nil), homeworks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].UploadedAt.Before(sorted[j].UploadedAt) })
+
+	var photos []storage.Homework
+	var errs []error
+	for _, homework := range sorted {
+		if homework.Content.MediaType() == storage.MediaPhoto {
+			photos = append(photos, homework)
+			continue
+		}
+		if err := h.sendHomework(ctx, chatID, homework); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(photos) == 1 {
+		errs = append(errs, h.sendHomework(ctx, chatID, photos[0]))
+	}
+	if len(photos) > 1 {
+		errs = append(errs, h.sendPhotoAlbums(ctx, chatID, subject, photos))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *Handler) sendPhotoAlbums(ctx context.Context, chatID int64, subject string, photos []storage.Homework) error {
+	latest := photos[len(photos)-1]
+
+	// Albums of even size, so the last one never has a single photo
+	albums := (len(photos) + maxAlbumSize - 1) / maxAlbumSize
+	size := (len(photos) + albums - 1) / albums
+	for start := 0; start < len(photos); start += size {
+		chunk := photos[start:min(start+size, len(photos))]
+		caption := fmt.Sprintf("Предмет: %s\nСтр. %d–%d из %d\nЗагружено в: %s",
+			subject, start+1, start+len(chunk), len(photos),
+			chunk[len(chunk)-1].UploadedAt.Format("15:04 02.01.2006"))
+		caption += reviewCaption(latest.Review)
+
+		if err := h.sendAlbum(ctx, chatID, chunk, caption); err != nil {
+			return err
+		}
+	}
+
+	if !awaitsReview(latest.Review) {
+		return nil
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Проверьте домашку по %s (%d стр.)", subject, len(photos)))
+	msg.ReplyMarkup = reviewKeyboard(latest.ID)
+	if _, err := h.bot.Send(msg); err != nil {
+		return err
+	}
+
+	for _, photo := range photos {
+		if photo.Review.Requested || !awaitsReview(photo.Review) {
+			continue
+		}
+		if err := h.db.RequestReview(ctx, photo.ID); err != nil {
+			logger.Error("Error marking homework %s as sent for review: %v", photo.ID, err)
+		}
+	}
+	return nil
+}
+
+// sendAlbum sends photos as one media group with the caption under the first one.
+// Photos are sent by Telegram file ID; if Telegram rejects one, the whole album is
+// uploaded from the blob store and the new file IDs are remembered.
+func (h *Handler) sendAlbum(ctx context.Context, chatID int64, photos []storage.Homework, caption string) error {
+	sent, err := retryRateLimited(func() ([]tgbotapi.Message, error) {
+		return h.sendAlbumFiles(ctx, chatID, photos, caption, false)
+	})
+	if fileIDRejected(err) {
+		logger.Warning("Telegram rejected a file ID in an album, re-uploading: %v", err)
+		sent, err = retryRateLimited(func() ([]tgbotapi.Message, error) {
+			return h.sendAlbumFiles(ctx, chatID, photos, caption, true)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, message := range sent {
+		if i >= len(photos) {
+			break
+		}
+		fileID, fileUniqueID, ok := sentFile(message)
+		if ok && fileID != photos[i].Content.FileID {
+			if err := h.db.SetHomeworkFileID(ctx, photos[i].ID, fileID, fileUniqueID); err != nil {
+				logger.Error("Error saving file ID of homework %s: %v", photos[i].ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sendAlbumFiles sends photos by file ID where they have one, unless upload is set,
+// and streams the rest from the blob store
+func (h *Handler) sendAlbumFiles(ctx context.Context, chatID int64, photos []storage.Homework, caption string, upload bool) ([]tgbotapi.Message, error) {
+	media := make([]interface{}, len(photos))
+	for i, photo := range photos {
+		var file tgbotapi.RequestFileData = tgbotapi.FileID(photo.Content.FileID)
+		if upload || photo.Content.FileID == "" {
+			reader, err := h.blobs.Get(ctx, photo.Content.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open homework %s: %w", photo.ID, err)
+			}
+			defer reader.Close()
+			file = tgbotapi.FileReader{Name: uploadName(photo.Content), Reader: reader}
+		}
+
+		item := tgbotapi.NewInputMediaPhoto(file)
+		if i == 0 {
+			item.Caption = caption
+		}
+		media[i] = item
+	}
+
+	return h.bot.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, media))
+}
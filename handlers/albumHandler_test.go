@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+)
+
+func TestSendSubjectHomeworkAlbums(t *testing.T) {
+	tests := []struct {
+		photos     int
+		wantAlbums []int
+	}{
+		{photos: 1},
+		{photos: 2, wantAlbums: []int{2}},
+		{photos: 10, wantAlbums: []int{10}},
+		{photos: 11, wantAlbums: []int{6, 5}},
+		{photos: 20, wantAlbums: []int{10, 10}},
+		{photos: 21, wantAlbums: []int{7, 7, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d photos", tt.photos), func(t *testing.T) {
+			h, _, telegram := newTestHandler(t)
+			start := time.Date(2026, 10, 20, 18, 0, 0, 0, time.UTC)
+
+			var photos []storage.Homework
+			for i := 0; i < tt.photos; i++ {
+				photos = append(photos, storage.Homework{
+					ID:         fmt.Sprintf("%d", i+1),
+					StudentID:  testStudentID,
+					Subject:    "Алгебра",
+					Content:    storage.Content{Type: storage.MediaPhoto, FileID: fmt.Sprintf("file%d", i+1)},
+					UploadedAt: start.Add(time.Duration(i) * time.Minute),
+				})
+			}
+
+			if err := h.sendSubjectHomework(context.Background(), 2, "Алгебра", photos); err != nil {
+				t.Fatal(err)
+			}
+			if albums := telegram.albumSizes(); !slices.Equal(albums, tt.wantAlbums) {
+				t.Errorf("sent albums of %v photos, want %v", albums, tt.wantAlbums)
+			}
+			// Albums can't have buttons, so one message with them follows all albums
+			if sent := telegram.messages(); len(sent) != min(len(tt.wantAlbums), 1) {
+				t.Errorf("sent %q, want the review buttons once after albums", sent)
+			}
+		})
+	}
+}
+
+func TestSendAlbum(t *testing.T) {
+	tests := []struct {
+		name string
+		// failure is the error Telegram answers the first album with, if any
+		failure   *fakeFailure
+		wantCalls []fakeCall
+		wantErr   bool
+	}{
+		{name: "by file IDs", wantCalls: []fakeCall{{method: "sendMediaGroup"}}},
+		{
+			name:      "wrong file identifier",
+			failure:   &fakeFailure{code: http.StatusBadRequest, description: "Bad Request: wrong file identifier/HTTP URL specified"},
+			wantCalls: []fakeCall{{method: "sendMediaGroup"}, {method: "sendMediaGroup", upload: true}},
+		},
+		{
+			name:      "rate limited",
+			failure:   &fakeFailure{code: http.StatusTooManyRequests, description: "Too Many Requests: retry after 1", retryAfter: 1},
+			wantCalls: []fakeCall{{method: "sendMediaGroup"}, {method: "sendMediaGroup"}},
+		},
+		{
+			name:      "blocked",
+			failure:   &fakeFailure{code: http.StatusForbidden, description: "Forbidden: bot was blocked by the user"},
+			wantCalls: []fakeCall{{method: "sendMediaGroup"}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, _, telegram := newTestHandler(t)
+			if tt.failure != nil {
+				telegram.fail("sendMediaGroup", tt.failure.code, tt.failure.description, tt.failure.retryAfter)
+			}
+
+			var photos []storage.Homework
+			for i := 1; i <= 2; i++ {
+				ref := fmt.Sprintf("1/2026-10-20/page%d", i)
+				if err := h.blobs.Put(ctx, ref, strings.NewReader("page"), 4); err != nil {
+					t.Fatal(err)
+				}
+				photos = append(photos, storage.Homework{
+					ID:      fmt.Sprintf("%d", i),
+					Content: storage.Content{Type: storage.MediaPhoto, Ref: ref, FileID: fmt.Sprintf("file%d", i)},
+				})
+			}
+
+			err := h.sendAlbum(ctx, 2, photos, "Алгебра")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sendAlbum() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if calls := telegram.requests(); !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("requests = %+v, want %+v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+	"dashka-homework-bot/subjects"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleAlias lists the sender's subject aliases or adds one: /alias матеша = Алгебра
+func (h *Handler) handleAlias(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+	args := strings.TrimSpace(message.CommandArguments())
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка получения данных. Попробуйте позже")
+		return
+	}
+
+	if args == "" {
+		h.sendMessage(message.Chat.ID, formatAliases(user.SubjectAliases)+"\n"+
+			"Использование: /alias <сокращение> = <предмет>\nПример: /alias матеша = Алгебра\n"+
+			"Удалить: /unalias <сокращение>")
+		return
+	}
+
+	alias, subjectName, ok := strings.Cut(args, "=")
+	if !ok {
+		alias, subjectName, _ = strings.Cut(args, " ")
+	}
+	alias = subjects.Normalize(alias)
+	subjectName = strings.TrimSpace(subjectName)
+	if alias == "" || subjectName == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /alias <сокращение> = <предмет>\nПример: /alias матеша = Алгебра")
+		return
+	}
+
+	name, ok := scheduleSubject(user.Schedule, subjectName)
+	if !ok {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("В расписании нет предмета %q", subjectName))
+		return
+	}
+
+	if err := h.db.SetSubjectAlias(ctx, userID, alias, name); err != nil {
+		logger.Error("Error setting alias for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить сокращение. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("Теперь %q означает %s", alias, name))
+}
+
+func (h *Handler) handleUnalias(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	alias := subjects.Normalize(message.CommandArguments())
+	if alias == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /unalias <сокращение>")
+		return
+	}
+
+	if err := h.db.RemoveSubjectAlias(ctx, userID, alias); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendMessage(message.Chat.ID, fmt.Sprintf("Сокращение %q не найдено", alias))
+			return
+		}
+		logger.Error("Error removing alias for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось удалить сокращение. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("Сокращение %q удалено", alias))
+}
+
+// scheduleSubject returns the subject name as written in the schedule
+func scheduleSubject(schedule []storage.DaySchedule, name string) (string, bool) {
+	for _, day := range schedule {
+		for _, subject := range day.Subjects {
+			if subjects.Normalize(subject.SubjectName) == subjects.Normalize(name) {
+				return subject.SubjectName, true
+			}
+		}
+	}
+	return "", false
+}
+
+func formatAliases(aliases map[string]string) string {
+	if len(aliases) == 0 {
+		return "Сокращений пока нет.\n"
+	}
+
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	text := "Ваши сокращения:\n"
+	for _, alias := range names {
+		text += fmt.Sprintf("  %s → %s\n", alias, aliases[alias])
+	}
+	return text
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxAnswerLen leaves room for the caption when the answer is sent to parents
+const maxAnswerLen = 3500
+
+const answerHint = "Чтобы сдать домашку, отправьте фото или файл с подписью — названием предмета. " +
+	"Ответ можно написать текстом: «Английский: выучил слова 1-20»."
+
+// handleTextAnswer saves a student's text as homework. "Предмет: ответ" goes to the
+// next lesson of the subject; any other text goes to the subject picked under a
+// reminder, if there is one. Otherwise the sender gets a hint.
+func (h *Handler) handleTextAnswer(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	user, err := h.ensureUserInitialized(ctx, userID, message.From.UserName)
+	if err != nil {
+		logger.Error("Error initializing user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка инициализации, попробуйте позже")
+		return
+	}
+	if !h.checkUploader(message, user) {
+		return
+	}
+
+	text := strings.TrimSpace(message.Text)
+	if len([]rune(text)) > maxAnswerLen {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Ответ слишком длинный, максимум %d символов. Отправьте его файлом.", maxAnswerLen))
+		return
+	}
+
+	if subject, answer, found := strings.Cut(text, ":"); found && strings.TrimSpace(answer) != "" {
+		answer = strings.TrimSpace(answer)
+		lesson, options, err := h.resolveLesson(ctx, user, subject)
+		switch {
+		case err == nil && lesson != nil:
+			h.saveTextAnswer(ctx, message.Chat.ID, userID, *lesson, answer)
+			return
+		case err == nil:
+			h.askSubject(message, []homeworkFile{{mediaType: storage.MediaText, text: answer}}, options,
+				"Подходит несколько предметов. Выберите нужный:")
+			return
+		case !errors.Is(err, storage.ErrNotFound):
+			logger.Error("Error finding lesson for %q, user %s: %v", subject, userID, err)
+			h.sendMessage(message.Chat.ID, "Ошибка обработки домашки, попробуйте позже")
+			return
+		}
+		// The text before the colon is not a subject, e.g. a link
+	}
+
+	if lesson, ok := h.uploadTarget(userID); ok {
+		h.saveTextAnswer(ctx, message.Chat.ID, userID, lesson, text)
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, answerHint)
+}
+
+func (h *Handler) saveTextAnswer(ctx context.Context, chatID int64, userID string, lesson lessonOption, answer string) {
+	homeworkID, err := h.saveFile(ctx, userID, lesson, homeworkFile{mediaType: storage.MediaText, text: answer})
+	if err != nil {
+		logger.Error("Error saving text answer: %v", err)
+		h.sendMessage(chatID, "Ошибка сохранения домашки, попробуйте позже")
+		return
+	}
+
+	logger.Info("Saved homework with ID: %s for user: %s", homeworkID, userID)
+	h.sendMessage(chatID, fmt.Sprintf("Записал ответ для %s %s!", formatDate(lesson.date), lesson.subject))
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleTextAnswer(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      int64
+		text        string
+		wantSubject string
+		wantAnswer  string
+		wantReply   string
+	}{
+		{name: "subject and answer", userID: 1, text: "Алгебра: №5", wantSubject: "Алгебра", wantAnswer: "№5", wantReply: "Записал ответ"},
+		{name: "subject prefix", userID: 1, text: "рус: упр. 12", wantSubject: "Русский", wantAnswer: "упр. 12", wantReply: "Записал ответ"},
+		{name: "no subject", userID: 1, text: "привет", wantReply: answerHint},
+		{name: "colon in a link", userID: 1, text: "https://example.com", wantReply: answerHint},
+		{name: "parent", userID: 2, text: "Алгебра: №5", wantReply: "Загружать домашку могут только ученики"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, db, telegram := newTestHandler(t)
+
+			h.HandleText(textMessage(tt.userID, tt.text))
+
+			sent := telegram.messages()
+			if len(sent) != 1 || !strings.HasPrefix(sent[0], tt.wantReply) {
+				t.Errorf("sent %q, want a reply starting with %q", sent, tt.wantReply)
+			}
+
+			homeworks, err := db.GetHomeworkUploadedSince(context.Background(), time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSubject == "" {
+				if len(homeworks) != 0 {
+					t.Errorf("saved %+v, want nothing", homeworks)
+				}
+				return
+			}
+			if len(homeworks) != 1 || homeworks[0].Subject != tt.wantSubject || homeworks[0].Content.Text != tt.wantAnswer {
+				t.Errorf("saved %+v, want %q for %s", homeworks, tt.wantAnswer, tt.wantSubject)
+			}
+		})
+	}
+}
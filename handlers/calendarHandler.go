@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dayOffTitle explains a reason returned by Calendar.DayOff
+func dayOffTitle(reason string) string {
+	if _, ok := weekdayTitles[reason]; ok {
+		return "выходной"
+	}
+	if reason == "" {
+		return "нет занятий"
+	}
+	return reason
+}
+
+func (h *Handler) handleCalendar(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, _, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, formatCalendar(storage.CalendarOf(target))+"\n"+
+		"/daysoff [ученик] <дни> — выходные дни недели\n"+
+		"/vacation [ученик] <дд.мм-дд.мм> [название] — добавить каникулы\n"+
+		"/holiday [ученик] <дд.мм> [название] — добавить праздник\n"+
+		"/removebreak [ученик] <дд.мм> — удалить каникулы или праздник на эту дату\n"+
+		"Календарь можно загрузить файлом .ics с подписью «календарь»."+studentArgUsage)
+}
+
+func (h *Handler) handleDaysOff(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	if args == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /daysoff [ученик] <день1>, <день2>\nПример: /daysoff Сб, Вс\nБез выходных: /daysoff нет"+studentArgUsage)
+		return
+	}
+
+	daysOff := []string{}
+	if !strings.EqualFold(args, "нет") {
+		for _, arg := range strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' }) {
+			dayName, ok := parseDay(arg)
+			if !ok {
+				h.sendMessage(message.Chat.ID, fmt.Sprintf("Не понимаю день недели %q. Пример: Воскресенье или Вс", arg))
+				return
+			}
+			daysOff = append(daysOff, dayName)
+		}
+	}
+
+	calendar := storage.CalendarOf(target)
+	calendar.DaysOff = daysOff
+	h.saveCalendar(ctx, message.Chat.ID, target.UserID, calendar)
+}
+
+func (h *Handler) handleVacation(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	start, end, name, ok := parseDateRange(args, time.Now())
+	if !ok {
+		h.sendMessage(message.Chat.ID, "Использование: /vacation [ученик] <дд.мм-дд.мм> [название]\nПример: /vacation 27.10-04.11 Осенние каникулы"+studentArgUsage)
+		return
+	}
+	if name == "" {
+		name = "каникулы"
+	}
+
+	calendar := storage.CalendarOf(target).Merge(storage.Calendar{
+		Vacations: []storage.Vacation{{Name: name, Start: start, End: end}},
+	})
+	h.saveCalendar(ctx, message.Chat.ID, target.UserID, calendar)
+}
+
+func (h *Handler) handleHoliday(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	dateArg, name, _ := strings.Cut(args, " ")
+	date, ok := parseDate(dateArg)
+	if !ok {
+		h.sendMessage(message.Chat.ID, "Использование: /holiday [ученик] <дд.мм> [название]\nПример: /holiday 04.11 День народного единства"+studentArgUsage)
+		return
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "праздник"
+	}
+
+	calendar := storage.CalendarOf(target).Merge(storage.Calendar{
+		Holidays: []storage.Holiday{{Name: name, Date: date}},
+	})
+	h.saveCalendar(ctx, message.Chat.ID, target.UserID, calendar)
+}
+
+func (h *Handler) handleRemoveBreak(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	date, ok := parseDate(args)
+	if !ok {
+		h.sendMessage(message.Chat.ID, "Использование: /removebreak [ученик] <дд.мм>"+studentArgUsage)
+		return
+	}
+
+	calendar := storage.CalendarOf(target)
+	removed := false
+	holidays := calendar.Holidays[:0]
+	for _, holiday := range calendar.Holidays {
+		if holiday.Date == date {
+			removed = true
+			continue
+		}
+		holidays = append(holidays, holiday)
+	}
+	vacations := calendar.Vacations[:0]
+	for _, vacation := range calendar.Vacations {
+		if vacation.Start <= date && date <= vacation.End {
+			removed = true
+			continue
+		}
+		vacations = append(vacations, vacation)
+	}
+
+	if !removed {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("На %s нет ни каникул, ни праздника", formatDate(date)))
+		return
+	}
+
+	calendar.Holidays = holidays
+	calendar.Vacations = vacations
+	h.saveCalendar(ctx, message.Chat.ID, target.UserID, calendar)
+}
+
+func (h *Handler) saveCalendar(ctx context.Context, chatID int64, userID string, calendar storage.Calendar) {
+	if err := h.db.SetCalendar(ctx, userID, calendar); err != nil {
+		logger.Error("Error saving calendar for user %s: %v", userID, err)
+		h.sendMessage(chatID, "Не удалось сохранить календарь. Попробуйте позже")
+		return
+	}
+	h.sendMessage(chatID, "Календарь обновлен.\n\n"+formatCalendar(calendar))
+}
+
+// parseDateRange reads "дд.мм-дд.мм" or two dates separated by a space, followed by an
+// optional name. Dates without a year are read relative to now, and a range whose end
+// has no year and falls before the start runs into the next year.
+func parseDateRange(args string, now time.Time) (string, string, string, bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", "", "", false
+	}
+
+	var startArg, endArg string
+	rest := fields[1:]
+	if first, second, ok := strings.Cut(fields[0], "-"); ok && strings.Contains(first, ".") {
+		startArg, endArg = first, second
+	} else if len(fields) >= 2 {
+		startArg, endArg = fields[0], fields[1]
+		rest = fields[2:]
+	} else {
+		return "", "", "", false
+	}
+
+	start, ok := parseDateAt(startArg, now)
+	if !ok {
+		return "", "", "", false
+	}
+	end, ok := parseDateAt(endArg, now)
+	if ok && end < start && isShortDate(endArg) {
+		startTime, _ := time.Parse(storage.DateLayout, start)
+		end, ok = parseDateAt(endArg, startTime)
+	}
+	if !ok || end < start {
+		return "", "", "", false
+	}
+	return start, end, strings.Join(rest, " "), true
+}
+
+func formatCalendar(calendar storage.Calendar) string {
+	text := "🗓 Учебный календарь\n\nВыходные дни недели: "
+	if len(calendar.DaysOff) == 0 {
+		text += "нет"
+	}
+	for i, day := range calendar.DaysOff {
+		if i > 0 {
+			text += ", "
+		}
+		text += dayTitle(day)
+	}
+	text += "\n"
+
+	// Past vacations and holidays are kept but not worth showing
+	today := storage.DateKey(time.Now())
+	var vacations, holidays []string
+	for _, vacation := range calendar.Vacations {
+		if vacation.End >= today {
+			vacations = append(vacations, fmt.Sprintf("  %s — %s: %s\n", formatDate(vacation.Start), formatDate(vacation.End), vacation.Name))
+		}
+	}
+	for _, holiday := range calendar.Holidays {
+		if holiday.Date >= today {
+			holidays = append(holidays, fmt.Sprintf("  %s: %s\n", formatDate(holiday.Date), holiday.Name))
+		}
+	}
+
+	if len(vacations) > 0 {
+		text += "\nКаникулы:\n" + strings.Join(vacations, "")
+	}
+	if len(holidays) > 0 {
+		text += "\nПраздники:\n" + strings.Join(holidays, "")
+	}
+	return text
+}
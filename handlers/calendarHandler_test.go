@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	december := time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		args      string
+		now       time.Time
+		wantStart string
+		wantEnd   string
+		wantName  string
+		wantOK    bool
+	}{
+		{name: "dash", args: "27.10-04.11 Осенние каникулы", now: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			wantStart: "2026-10-27", wantEnd: "2026-11-04", wantName: "Осенние каникулы", wantOK: true},
+		{name: "space", args: "27.10 04.11", now: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			wantStart: "2026-10-27", wantEnd: "2026-11-04", wantOK: true},
+		{name: "over new year", args: "29.12-08.01", now: december, wantStart: "2026-12-29", wantEnd: "2027-01-08", wantOK: true},
+		{name: "after new year", args: "05.01-08.01", now: december, wantStart: "2027-01-05", wantEnd: "2027-01-08", wantOK: true},
+		{name: "full dates", args: "2026-12-29 2027-01-08", now: december, wantStart: "2026-12-29", wantEnd: "2027-01-08", wantOK: true},
+		{name: "end before start", args: "10.05-01.05", now: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "full end before start", args: "2027-01-08 2026-12-29", now: december},
+		{name: "one date", args: "29.12", now: december},
+		{name: "empty", args: "", now: december},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, name, ok := parseDateRange(tt.args, tt.now)
+			if ok != tt.wantOK || ok && (start != tt.wantStart || end != tt.wantEnd || name != tt.wantName) {
+				t.Errorf("parseDateRange(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+					tt.args, start, end, name, ok, tt.wantStart, tt.wantEnd, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
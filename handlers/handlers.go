@@ -1,40 +1,210 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"dashka-homework-bot/blobstore"
 	"dashka-homework-bot/logger"
-	"dashka-homework-bot/storage/mongo"
+	"dashka-homework-bot/storage"
+	"dashka-homework-bot/subjects"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type Handler struct {
 	bot             *tgbotapi.BotAPI
-	db              *mongo.HomeworkDatabase
-	mediaGroups     map[string]string
-	mediaGroupsLock sync.Mutex
-	lastCleanup     time.Time
+	db              storage.Storage
+	blobs           blobstore.Store
+	albums          map[string]*album
+	albumsLock      sync.Mutex
+	pendingImports  map[string]pendingImport
+	importsLock     sync.Mutex
+	pendingUploads  map[string]*pendingUpload
+	uploadsLock     sync.Mutex
+	uploadTargets   map[string]uploadTarget
+	pendingComments map[string]pendingComment
+	commentsLock    sync.Mutex
+	pendingRenames  map[string]pendingRename
+	renamesLock     sync.Mutex
+	// admins are the user IDs the operator configured as admins
+	admins map[string]bool
+	// runInChat runs work that does not come from an update, such as flushing an
+	// album, in order with the updates of a chat. See SetChatRunner.
+	runInChat func(chatID int64, name string, run func())
 }
 
-func NewHandler(bot *tgbotapi.BotAPI, db *mongo.HomeworkDatabase) *Handler {
+// NewHandler creates the handlers. adminIDs are the Telegram user IDs allowed to use
+// the admin commands.
+func NewHandler(bot *tgbotapi.BotAPI, db storage.Storage, blobs blobstore.Store, adminIDs []string) *Handler {
+	admins := make(map[string]bool)
+	for _, id := range adminIDs {
+		admins[id] = true
+	}
+
 	return &Handler{
-		bot:         bot,
-		db:          db,
-		mediaGroups: make(map[string]string),
-		lastCleanup: time.Now(),
+		bot:             bot,
+		db:              db,
+		blobs:           blobs,
+		albums:          make(map[string]*album),
+		runInChat:       func(_ int64, _ string, run func()) { run() },
+		pendingImports:  make(map[string]pendingImport),
+		pendingUploads:  make(map[string]*pendingUpload),
+		uploadTargets:   make(map[string]uploadTarget),
+		pendingComments: make(map[string]pendingComment),
+		pendingRenames:  make(map[string]pendingRename),
+		admins:          admins,
+	}
+}
+
+// SetChatRunner makes the handler run its own work for a chat, such as flushing an
+// album when no more parts arrive, through run, so it never overlaps the chat's updates.
+// Without it the work runs on the goroutine that triggered it.
+func (h *Handler) SetChatRunner(run func(chatID int64, name string, run func())) {
+	h.runInChat = run
+}
+
+// lessonSearchDays is how far ahead HandleMessage looks for the next lesson of a subject
+const lessonSearchDays = 7
+
+// nextDate returns tomorrow's date in the user's time zone. Without one it is the zone
+// of a linked parent, as for reminders.
+func (h *Handler) nextDate(ctx context.Context, user *storage.User) string {
+	zoned := *user
+	if zoned.Timezone == "" {
+		parents, err := h.parentsOf(ctx, user)
+		if err != nil {
+			logger.Error("Error getting parents of %s: %v", user.UserID, err)
+		}
+		zoned.Timezone = reminderTimezone(zoned, parents)
+	}
+	return nextDateAt(userLocation(zoned), time.Now())
+}
+
+// nextDateAt returns the date of the day after now in loc
+func nextDateAt(loc *time.Location, now time.Time) string {
+	return storage.DateKey(now.In(loc).AddDate(0, 0, 1))
+}
+
+// formatDate renders a LessonDay date for messages, e.g. "Понедельник, 20.10"
+func formatDate(date string) string {
+	t, err := time.Parse(storage.DateLayout, date)
+	if err != nil {
+		return date
+	}
+	return fmt.Sprintf("%s, %s", dayTitle(t.Weekday().String()), t.Format("02.01"))
+}
+
+// shortDateLookback is how far back a date without a year may lie; an earlier one
+// means next year, e.g. /holiday 05.01 entered in December
+const shortDateLookback = 6 // months
+
+// parseDate accepts dd.mm, dd.mm.yyyy or yyyy-mm-dd and returns a LessonDay date
+func parseDate(s string) (string, bool) {
+	return parseDateAt(s, time.Now())
+}
+
+// parseDateAt is parseDate with dd.mm read relative to now
+func parseDateAt(s string, now time.Time) (string, bool) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(storage.DateLayout, s); err == nil {
+		return storage.DateKey(t), true
+	}
+	if t, err := time.Parse("02.01.2006", s); err == nil {
+		return storage.DateKey(t), true
+	}
+	if t, err := time.Parse("02.01", s); err == nil {
+		year := now.Year()
+		cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, -shortDateLookback, 0)
+		if time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Before(cutoff) {
+			year++
+		}
+		// 29.02 would turn into 01.03 in a year without it
+		date := time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if date.Month() != t.Month() {
+			return "", false
+		}
+		return storage.DateKey(date), true
+	}
+	return "", false
+}
+
+// isShortDate reports whether s is a dd.mm date without a year
+func isShortDate(s string) bool {
+	_, err := time.Parse("02.01", strings.TrimSpace(s))
+	return err == nil
+}
+
+// lessonOption is a lesson homework can be submitted for
+type lessonOption struct {
+	date    string
+	subject string
+}
+
+// resolveLesson finds the next lesson the caption refers to among the lessons of the
+// coming days, starting from tomorrow. When the caption fits several subjects, the
+// lesson is nil and the candidates are returned instead.
+func (h *Handler) resolveLesson(ctx context.Context, user *storage.User, caption string) (*lessonOption, []lessonOption, error) {
+	upcoming, err := h.upcomingLessons(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, len(upcoming))
+	for i, lesson := range upcoming {
+		names[i] = lesson.subject
 	}
+
+	match, ambiguous := subjects.Resolve(caption, names, user.SubjectAliases)
+	if match == "" && len(ambiguous) == 0 {
+		return nil, nil, fmt.Errorf("no lesson matching %q in the next %d days: %w", caption, lessonSearchDays, storage.ErrNotFound)
+	}
+
+	var options []lessonOption
+	for _, lesson := range upcoming {
+		if lesson.subject == match {
+			return &lesson, nil, nil
+		}
+		for _, name := range ambiguous {
+			if lesson.subject == name {
+				options = append(options, lesson)
+			}
+		}
+	}
+	return nil, options, nil
 }
 
-func getNextDayName() string {
-	tomorrow := time.Now().Add(24 * time.Hour)
-	return tomorrow.Weekday().String()
+// upcomingLessons lists each subject of the coming school days once, with the date of its next lesson
+func (h *Handler) upcomingLessons(ctx context.Context, user *storage.User) ([]lessonOption, error) {
+	var lessons []lessonOption
+	seen := make(map[string]bool)
+	calendar := storage.CalendarOf(user)
+	now := time.Now()
+	for i := 1; i <= lessonSearchDays; i++ {
+		date := storage.DateKey(now.AddDate(0, 0, i))
+		if _, off := calendar.DayOff(date); off {
+			continue
+		}
+		day, err := h.db.GetLessonsForDate(ctx, user.UserID, date)
+		if err != nil {
+			return nil, err
+		}
+		for _, subject := range day.Subjects {
+			if !seen[subject.SubjectName] {
+				seen[subject.SubjectName] = true
+				lessons = append(lessons, lessonOption{date: date, subject: subject.SubjectName})
+			}
+		}
+	}
+	return lessons, nil
 }
 
 func (h *Handler) HandleCommand(message *tgbotapi.Message) {
@@ -43,181 +213,314 @@ func (h *Handler) HandleCommand(message *tgbotapi.Message) {
 	username := message.From.UserName
 
 	ctx := context.Background()
-	if err := h.ensureUserInitialized(ctx, userID, username); err != nil {
+	user, err := h.ensureUserInitialized(ctx, userID, username)
+	if err != nil {
 		logger.Error("Error initializing user %s: %v", userID, err)
 		h.sendMessage(message.Chat.ID, "Ошибка инициализации, попробуйте позже")
 		return
 	}
 
+	if !h.checkRole(message, user, message.Command()) {
+		return
+	}
+
 	switch message.Command() {
 	case "start":
-		nextDay := getNextDayName()
-		msg := tgbotapi.NewMessage(message.Chat.ID,
-			fmt.Sprintf("Добро пожаловать в Бота для домашних заданий!\n\n"+
-				"Чтобы отправить домашку на завтра (%s):\n"+
-				"Отправьте снимки с названием предмета в подписи\n"+
-				"Пример: 'Математика'\n\n"+
-				"2. Родители могут добавлять студентов с помощью команды `/addstudent @username`.\n"+
-				"3. Родители могут проверять статус домашнего задания с помощью команды `/checkhw`.\n\n"+
-				"Используйте /help, чтобы увидеть все доступные команды.", nextDay))
-		h.bot.Send(msg)
+		if token, ok := strings.CutPrefix(message.CommandArguments(), invitePayload); ok {
+			h.acceptInvite(message, user, token)
+			return
+		}
+		if user.Role == "" {
+			h.askRole(message.Chat.ID, "Добро пожаловать в Бота для домашних заданий! Кто вы?")
+			return
+		}
+		h.sendWelcome(ctx, message.Chat.ID, user)
+	case "role":
+		h.handleRole(message, user)
+	case "admin_users":
+		h.handleAdminUsers(message)
+	case "admin_stats":
+		h.handleAdminStats(message)
+	case "admin_broadcast":
+		h.handleAdminBroadcast(message)
+	case "admin_user":
+		h.handleAdminUser(message)
 	case "help":
 		helpText := "📚 *Помощь по Боту для домашних заданий*\n\n" +
 			"Вот доступные команды:\n\n" +
 			"*/start* - Запустить бота и увидеть инструкции.\n" +
 			"*/help* - Показать это сообщение с помощью.\n" +
-			"*/addstudent @username* - Добавить студента в ваши контакты (для родителей).\n" +
+			"*/role* - Сменить роль: ученик, родитель или репетитор.\n" +
+			"*/invite* - Ссылка-приглашение для родителя (для учеников).\n" +
+			"*/addstudent @username* - Запросить у студента доступ к его домашке (для родителей).\n" +
+			"*/mystudents* - Ваши ученики: переименовать или удалить (для родителей).\n" +
+			"*/unlink @username* - Отключить ученика или родителя.\n" +
 			"*/checkhw* - Проверить статус домашнего задания ваших студентов (для родителей).\n" +
-			"*/schedule* - Посмотреть расписание на завтра.\n\n" +
+			"Под домашкой в /checkhw и сводке есть кнопки «Принять» и «На доработку».\n" +
+			"*/history дд.мм* - Статус домашки к урокам выбранной даты.\n" +
+			"*/reminders ЧЧ:ММ ЧЧ:ММ пояс* - Когда напоминать о несданной домашке (off — отключить).\n" +
+			"*/summarytime ЧЧ:ММ пояс* - Когда присылать ежедневную сводку (для родителей).\n" +
+			"*/schedule* - Посмотреть расписание на завтра.\n" +
+			"*/task предмет задание* - Записать, что задали (можно указать дату дд.мм перед предметом).\n" +
+			"*/setschedule день предмет1, предмет2* - Задать уроки на день.\n" +
+			"*/addlesson день предмет* - Добавить урок.\n" +
+			"*/removelesson день предмет* - Удалить урок.\n" +
+			"*/template название* - Заменить расписание шаблоном.\n" +
+			"*/alias сокращение = предмет* - Свое название для предмета в подписи.\n" +
+			"*/unalias сокращение* - Удалить сокращение.\n" +
+			"*/calendar* - Учебный календарь: выходные, каникулы и праздники.\n" +
+			"*/daysoff дни* - Выходные дни недели.\n" +
+			"*/vacation дд.мм-дд.мм название* - Добавить каникулы.\n" +
+			"*/holiday дд.мм название* - Добавить праздник.\n" +
+			"*/removebreak дд.мм* - Удалить каникулы или праздник.\n" +
+			"Родители могут менять расписание и календарь своего студента, указав первым аргументом его @username, ID или имя из /mystudents.\n" +
+			"Расписание можно загрузить файлом .csv (строки вида: день,предмет1,предмет2) или .ics с подписью «расписание», календарь каникул — файлом .ics с подписью «календарь». " +
+			"Родители указывают ученика в подписи файла.\n\n" +
 			"Чтобы отправить домашку:\n" +
-			"1. Сделайте фото(снимки) вашего домашнего задания.\n" +
-			"2. Добавьте подпись с названием предмета (например, 'Математика').\n" +
-			"3. Отправьте фото(снимки) боту.\n\n" +
-			"Пример: Отправьте фото с подписью 'Математика', чтобы отправить домашку по математике."
+			"1. Сделайте фото(снимки) вашего домашнего задания. Можно также отправить файл (Word, PDF), голосовое, аудио, видео или видеосообщение.\n" +
+			"2. Добавьте подпись с названием предмета (например, 'Алгебра' или 'алг'). Без подписи или если подходит несколько предметов, бот предложит выбрать предмет кнопкой.\n" +
+			"3. Отправьте фото(снимки) или файлы боту.\n\n" +
+			"Пример: Отправьте фото с подписью 'Математика', чтобы отправить домашку по математике.\n" +
+			"Короткий ответ или ссылку можно отправить текстом: 'Английский: выучил слова 1-20'."
+		if h.isAdmin(user) {
+			helpText += adminHelp
+		}
 		msg := tgbotapi.NewMessage(message.Chat.ID, helpText)
 		msg.ParseMode = "Markdown" // Использовать форматирование Markdown
 		h.bot.Send(msg)
 	case "schedule":
-		// Get schedule for specific user
-		ctx := context.Background()
-		nextDay := getNextDayName()
-		schedule, err := h.db.GetScheduleForDay(ctx, userID, nextDay)
-		if err != nil {
-			logger.Error("Error getting schedule for user %s: %v", userID, err)
-			h.sendMessage(message.Chat.ID, "Ошибка получения расписания. Попробуйте позже")
-			return
-		}
-
-		scheduleText := fmt.Sprintf("Завтрашнее (%s) расписание:\n", nextDay)
-		for i, subject := range schedule.Subjects {
-			scheduleText += fmt.Sprintf("%d. %s\n", i+1, subject.SubjectName)
-		}
-		msg := tgbotapi.NewMessage(message.Chat.ID, scheduleText)
-		h.bot.Send(msg)
+		h.handleSchedule(message)
 	case "addstudent":
 		h.handleAddStudent(message)
+	case "invite":
+		h.handleInvite(message)
+	case "unlink":
+		h.handleUnlink(message)
+	case "mystudents":
+		h.handleMyStudents(message)
 	case "checkhw":
 		h.handleCheckHomework(message)
+	case "history":
+		h.handleHistory(message)
+	case "setschedule":
+		h.handleSetSchedule(message)
+	case "addlesson":
+		h.handleAddLesson(message)
+	case "removelesson":
+		h.handleRemoveLesson(message)
+	case "template":
+		h.handleTemplate(message)
+	case "importconfirm":
+		h.handleImportConfirm(message)
+	case "importcancel":
+		h.handleImportCancel(message)
+	case "alias":
+		h.handleAlias(message)
+	case "unalias":
+		h.handleUnalias(message)
+	case "summarytime":
+		h.handleSummaryTime(message)
+	case "reminders":
+		h.handleReminders(message)
+	case "task":
+		h.handleTask(message)
+	case "calendar":
+		h.handleCalendar(message)
+	case "daysoff":
+		h.handleDaysOff(message)
+	case "vacation":
+		h.handleVacation(message)
+	case "holiday":
+		h.handleHoliday(message)
+	case "removebreak":
+		h.handleRemoveBreak(message)
 	default:
 		msg := tgbotapi.NewMessage(message.Chat.ID, "Неизвестная команда. Используйте /help, чтобы увидеть доступные команды.")
 		h.bot.Send(msg)
 	}
 }
 
+// HandleMessage handles a homework file. The parts of an album are collected first
+// and submitted together.
 func (h *Handler) HandleMessage(message *tgbotapi.Message) {
-	h.cleanupMediaGroups()
+	file, ok := messageFile(message)
+	if !ok {
+		msg := tgbotapi.NewMessage(message.Chat.ID,
+			"Пожалуйста, отправьте снимки вашего домашнего задания и подпишите названием предмета.")
+		h.bot.Send(msg)
+		return
+	}
+
+	if message.MediaGroupID != "" {
+		h.addAlbumPart(message, file)
+		return
+	}
+	h.submitFiles(message, message.Caption, []homeworkFile{file})
+}
 
+// submitFiles saves the files of a message or an album as homework for the lesson the
+// caption names. Without a caption they go to the subject picked under a reminder, or
+// the student picks one.
+func (h *Handler) submitFiles(message *tgbotapi.Message, caption string, files []homeworkFile) {
 	// Ensure user is initialized
 	userID := fmt.Sprintf("%d", message.From.ID)
 	username := message.From.UserName
 
 	ctx := context.Background()
-	if err := h.ensureUserInitialized(ctx, userID, username); err != nil {
+	user, err := h.ensureUserInitialized(ctx, userID, username)
+	if err != nil {
 		logger.Error("Error initializing user %s: %v", userID, err)
 		h.sendMessage(message.Chat.ID, "Извините, произошла ошибка при инициализации вашего аккаунта. Пожалуйста, попробуйте позже.")
 		return
 	}
 
-	if message.Photo == nil {
-		msg := tgbotapi.NewMessage(message.Chat.ID,
-			"Пожалуйста, отправьте снимки вашего домашнего задания и подпишите названием предмета.")
-		h.bot.Send(msg)
+	if !h.checkUploader(message, user) {
 		return
 	}
 
-	caption := message.Caption
-	if caption == "" && message.MediaGroupID != "" {
-		h.mediaGroupsLock.Lock()
-		caption = h.mediaGroups[message.MediaGroupID]
-		h.mediaGroupsLock.Unlock()
+	if len(files) == 1 && files[0].size > maxDownloadSize {
+		h.sendMessage(message.Chat.ID, "Файл больше 20 МБ, бот не сможет его скачать. Отправьте файл поменьше или фото.")
+		return
 	}
 
-	if message.MediaGroupID != "" && message.Caption != "" {
-		h.mediaGroupsLock.Lock()
-		h.mediaGroups[message.MediaGroupID] = message.Caption
-		h.mediaGroupsLock.Unlock()
+	var lesson *lessonOption
+	if caption == "" {
+		target, ok := h.uploadTarget(userID)
+		if !ok {
+			h.askSubjectForUncaptioned(ctx, message, files)
+			return
+		}
+		lesson = &target
+	} else {
+		var options []lessonOption
+		lesson, options, err = h.resolveLesson(ctx, user, caption)
+		if err != nil {
+			logger.Error("Error finding lesson for %q, user %s: %v", caption, userID, err)
+			if errors.Is(err, storage.ErrNotFound) {
+				h.sendMessage(message.Chat.ID, fmt.Sprintf("Не нашел урок %q в расписании на ближайшую неделю. Проверьте подпись, /alias или /setschedule", caption))
+			} else {
+				h.sendMessage(message.Chat.ID, "Ошибка обработки домашки, попробуйте позже")
+			}
+			return
+		}
+
+		if lesson == nil {
+			// Several subjects fit the caption, let the student pick
+			h.askSubject(message, files, options, "Подпись подходит к нескольким предметам. Выберите нужный:")
+			return
+		}
 	}
 
-	if caption == "" {
-		msg := tgbotapi.NewMessage(message.Chat.ID,
-			"Пожалуйста, добавьте подпись с названием предмета (например, 'Математика')")
-		h.bot.Send(msg)
-		return
+	// The progress message is turned into the result, so a submission gets one reply
+	processingMsg := tgbotapi.NewMessage(message.Chat.ID,
+		fmt.Sprintf("Обрабатываю домашку для %s %s...", formatDate(lesson.date), lesson.subject))
+	processing, err := h.bot.Send(processingMsg)
+	if err != nil {
+		logger.Error("Error sending message: %v", err)
 	}
 
-	nextDay := getNextDayName()
-	subject := strings.Title(caption)
+	result := h.saveFiles(ctx, userID, *lesson, files)
+	if err == nil {
+		edit := tgbotapi.NewEditMessageText(message.Chat.ID, processing.MessageID, result)
+		if _, err = h.bot.Send(edit); err == nil {
+			return
+		}
+		logger.Error("Error editing message: %v", err)
+	}
+	h.sendMessage(message.Chat.ID, result)
+}
+
+// saveFiles saves the pages of a submission for the lesson and returns the reply for
+// the student, naming the pages that could not be saved
+func (h *Handler) saveFiles(ctx context.Context, userID string, lesson lessonOption, files []homeworkFile) string {
+	var failed []string
+	for i, file := range files {
+		homeworkID, err := h.saveFile(ctx, userID, lesson, file)
+		if err != nil {
+			logger.Error("Error saving page %d of homework: %v", i+1, err)
+			failed = append(failed, strconv.Itoa(i+1))
+			continue
+		}
+		logger.Info("Saved homework with ID: %s for user: %s", homeworkID, userID)
+	}
 
-	if message.MediaGroupID == "" || message.Caption != "" {
-		processingMsg := tgbotapi.NewMessage(message.Chat.ID,
-			fmt.Sprintf("Обрабатываю фотографии для %s %s...", nextDay, subject))
-		h.bot.Send(processingMsg)
+	saved := len(files) - len(failed)
+	switch {
+	case saved == 0:
+		return "Ошибка сохранения домашки, попробуйте позже"
+	case len(files) == 1:
+		return fmt.Sprintf("Успешно сохранил домашку для %s %s!", formatDate(lesson.date), lesson.subject)
 	}
 
-	photoSize := message.Photo[len(message.Photo)-1]
+	text := fmt.Sprintf("Сохранил %d стр. для %s %s!", saved, formatDate(lesson.date), lesson.subject)
+	if len(failed) > 0 {
+		text += fmt.Sprintf("\n⚠️ Не удалось сохранить стр. %s, отправьте заново.", strings.Join(failed, ", "))
+	}
+	return text
+}
 
-	file, err := h.bot.GetFile(tgbotapi.FileConfig{FileID: photoSize.FileID})
-	if err != nil {
-		logger.Error("Error getting file: %v", err)
-		if message.MediaGroupID == "" {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка обработки фотографий, попробуйте позже")
-			h.bot.Send(msg)
-		}
-		return
+// saveFile downloads a file from Telegram and stores it as homework for the lesson.
+// Text answers are stored as they are.
+func (h *Handler) saveFile(ctx context.Context, userID string, lesson lessonOption, file homeworkFile) (string, error) {
+	if file.size > maxDownloadSize {
+		return "", fmt.Errorf("file of %d bytes is over the download limit", file.size)
+	}
+	if file.mediaType == storage.MediaText {
+		return h.db.SaveHomework(ctx, userID, lesson.date, lesson.subject, storage.Content{Type: storage.MediaText, Text: file.text})
 	}
 
-	photoBytes, err := downloadFile(file.Link(h.bot.Token))
+	telegramFile, err := h.bot.GetFile(tgbotapi.FileConfig{FileID: file.fileID})
 	if err != nil {
-		logger.Error("Error downloading file: %v", err)
-		if message.MediaGroupID == "" {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка загрузки фото, попробуйте позже")
-			h.bot.Send(msg)
-		}
-		return
+		return "", fmt.Errorf("failed to get file: %w", err)
 	}
 
-	// Updated to include userID in SaveHomework call
-	homeworkID, err := h.db.SaveHomework(
-		context.Background(),
-		userID,
-		nextDay,
-		subject,
-		photoBytes,
-	)
+	data, err := h.downloadFile(telegramFile.Link(h.bot.Token))
 	if err != nil {
-		logger.Error("Error saving homework: %v", err)
-		if message.MediaGroupID == "" {
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Ошибка сохранения фото, попробуйте позже")
-			h.bot.Send(msg)
-		}
-		return
+		return "", fmt.Errorf("failed to download file: %w", err)
 	}
 
-	logger.Info("Saved homework with ID: %s for user: %s", homeworkID, userID)
+	return h.storeHomework(ctx, userID, lesson.date, lesson.subject, data, file)
+}
 
-	if message.MediaGroupID == "" || message.Caption != "" {
-		msg := tgbotapi.NewMessage(message.Chat.ID,
-			fmt.Sprintf("Успешно сохранил домашку для %s %s!", nextDay, subject))
-		h.bot.Send(msg)
-	}
+// botCommands is the command menu everyone gets
+var botCommands = []tgbotapi.BotCommand{
+	{Command: "start", Description: "Запустить бота и увидеть инструкции"},
+	{Command: "help", Description: "Показать сообщение с помощью"},
+	{Command: "role", Description: "Сменить роль: ученик, родитель или репетитор"},
+	{Command: "invite", Description: "Ссылка-приглашение для родителя (для учеников)"},
+	{Command: "addstudent", Description: "Запросить доступ к домашке студента (для родителей)"},
+	{Command: "mystudents", Description: "Ваши ученики: переименовать или удалить (для родителей)"},
+	{Command: "unlink", Description: "Отключить ученика или родителя"},
+	{Command: "checkhw", Description: "Проверить статус домашнего задания ваших студентов (для родителей)"},
+	{Command: "schedule", Description: "Посмотреть расписание на завтра"},
+	{Command: "history", Description: "Статус домашки к урокам выбранной даты"},
+	{Command: "reminders", Description: "Время напоминаний о несданной домашке"},
+	{Command: "summarytime", Description: "Время и часовой пояс ежедневной сводки (для родителей)"},
+	{Command: "task", Description: "Записать, что задали по предмету"},
+	{Command: "setschedule", Description: "Задать уроки на день недели"},
+	{Command: "addlesson", Description: "Добавить урок в расписание"},
+	{Command: "removelesson", Description: "Удалить урок из расписания"},
+	{Command: "template", Description: "Заменить расписание шаблоном"},
+	{Command: "calendar", Description: "Учебный календарь: выходные, каникулы и праздники"},
+	{Command: "daysoff", Description: "Выходные дни недели"},
+	{Command: "vacation", Description: "Добавить каникулы"},
+	{Command: "holiday", Description: "Добавить праздник"},
+	{Command: "removebreak", Description: "Удалить каникулы или праздник"},
+	{Command: "alias", Description: "Свое название для предмета в подписи"},
+	{Command: "unalias", Description: "Удалить сокращение предмета"},
 }
 
 func (h *Handler) SetBotCommands() error {
-	commands := []tgbotapi.BotCommand{
-		{Command: "start", Description: "Запустить бота и увидеть инструкции"},
-		{Command: "help", Description: "Показать сообщение с помощью"},
-		{Command: "addstudent", Description: "Добавить студента в ваши контакты (для родителей)"},
-		{Command: "checkhw", Description: "Проверить статус домашнего задания ваших студентов (для родителей)"},
-		{Command: "schedule", Description: "Посмотреть расписание на завтра"},
+	config := tgbotapi.NewSetMyCommands(botCommands...)
+	if _, err := h.bot.Request(config); err != nil {
+		return err
 	}
-
-	config := tgbotapi.NewSetMyCommands(commands...)
-	_, err := h.bot.Request(config)
-	return err
+	return h.setAdminCommands(context.Background())
 }
 
-// New helper function to ensure user is initialized
-func (h *Handler) ensureUserInitialized(ctx context.Context, userID, username string) error {
+// ensureUserInitialized creates the user on first contact, makes sure students have a
+// timetable and returns the user as stored
+func (h *Handler) ensureUserInitialized(ctx context.Context, userID, username string) (*storage.User, error) {
 	// Create user (this should be idempotent)
 	err := h.db.CreateUser(ctx, userID, username)
 	if err != nil {
@@ -225,35 +528,112 @@ func (h *Handler) ensureUserInitialized(ctx context.Context, userID, username st
 		// Continue anyway as the user might already exist
 	}
 
-	// Initialize schedule (this should be idempotent)
-	err = h.db.InitializeSchedule(ctx, userID)
+	user, err := h.db.GetUser(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to initialize schedule: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	return nil
+	// Only students have a timetable (this should be idempotent)
+	if user.Role == storage.RoleStudent {
+		if err := h.db.InitializeSchedule(ctx, userID); err != nil {
+			return nil, fmt.Errorf("failed to initialize schedule: %w", err)
+		}
+	}
+
+	return user, nil
 }
 
-// Existing helper functions remain the same
-func (h *Handler) cleanupMediaGroups() {
-	if time.Since(h.lastCleanup) < time.Hour {
-		return
+// storeHomework puts the file into the blob store and records the submission
+// together with its Telegram file ID
+func (h *Handler) storeHomework(ctx context.Context, userID, date, subject string, data []byte, file homeworkFile) (string, error) {
+	checksum := blobstore.Checksum(data)
+	content := storage.Content{
+		Ref:          storage.ContentKey(userID, date, checksum),
+		Size:         int64(len(data)),
+		Checksum:     checksum,
+		FileID:       file.fileID,
+		FileUniqueID: file.fileUniqueID,
+		Type:         file.mediaType,
+		FileName:     file.fileName,
+	}
+
+	if err := h.blobs.Put(ctx, content.Ref, bytes.NewReader(data), content.Size); err != nil {
+		return "", fmt.Errorf("failed to store homework file: %w", err)
+	}
+
+	// The blob is not removed if saving fails: an earlier identical upload may share it
+	return h.db.SaveHomework(ctx, userID, date, subject, content)
+}
+
+// sendHomework sends a submission the way the student sent it and remembers the file
+// ID of a fresh upload for next time. Unreviewed submissions are sent with review
+// buttons; a video note has no caption, so its caption and buttons follow it in a
+// separate message. A text answer is a message of its own.
+func (h *Handler) sendHomework(ctx context.Context, chatID int64, homework storage.Homework) error {
+	caption := fmt.Sprintf("Предмет: %s\nЗагружено в: %s",
+		homework.Subject,
+		homework.UploadedAt.Format("15:04 02.01.2006"))
+	if homework.Content.MediaType() == storage.MediaText {
+		caption += "\n\n📝 " + homework.Content.Text
+	}
+	caption += reviewCaption(homework.Review)
+
+	// Submissions nobody has reviewed yet get Approve/Reject buttons
+	var markup interface{}
+	reviewable := awaitsReview(homework.Review)
+	if reviewable {
+		markup = reviewKeyboard(homework.ID)
+	}
+
+	var sent tgbotapi.Message
+	var err error
+	switch homework.Content.MediaType() {
+	case storage.MediaText:
+		msg := tgbotapi.NewMessage(chatID, caption)
+		msg.ReplyMarkup = markup
+		_, err = h.bot.Send(msg)
+	case storage.MediaVideoNote:
+		if sent, err = h.sendContent(ctx, chatID, homework, "", nil); err == nil {
+			msg := tgbotapi.NewMessage(chatID, caption)
+			msg.ReplyMarkup = markup
+			_, err = h.bot.Send(msg)
+		}
+	default:
+		sent, err = h.sendContent(ctx, chatID, homework, caption, markup)
+	}
+	if err != nil {
+		return err
 	}
 
-	h.mediaGroupsLock.Lock()
-	defer h.mediaGroupsLock.Unlock()
+	if reviewable && !homework.Review.Requested {
+		if err := h.db.RequestReview(ctx, homework.ID); err != nil {
+			logger.Error("Error marking homework %s as sent for review: %v", homework.ID, err)
+		}
+	}
 
-	h.mediaGroups = make(map[string]string)
-	h.lastCleanup = time.Now()
+	if fileID, fileUniqueID, ok := sentFile(sent); ok && fileID != homework.Content.FileID {
+		if err := h.db.SetHomeworkFileID(ctx, homework.ID, fileID, fileUniqueID); err != nil {
+			logger.Error("Error saving file ID of homework %s: %v", homework.ID, err)
+		}
+	}
+	return nil
 }
 
-func downloadFile(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// downloadFile fetches a file from Telegram with the bot's HTTP client
+func (h *Handler) downloadFile(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.bot.Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
 	return io.ReadAll(resp.Body)
 }
 
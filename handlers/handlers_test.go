@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	blobmemory "dashka-homework-bot/blobstore/memory"
+	"dashka-homework-bot/storage"
+	"dashka-homework-bot/storage/memory"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testStudentID = "1"
+	testParentID  = "2"
+)
+
+// fakeTelegram answers the Bot API requests of the handlers and records the texts of
+// the messages sent and edited, and the sizes of the albums sent. Files are served
+// from files by file ID. Methods given failures answer with them, one per request.
+type fakeTelegram struct {
+	mu       sync.Mutex
+	sent     []string
+	edited   []string
+	albums   []int
+	calls    []fakeCall
+	files    map[string]string
+	failures map[string][]fakeFailure
+}
+
+// fakeCall is a Bot API request; upload is set when it carried files rather than file IDs
+type fakeCall struct {
+	method string
+	upload bool
+}
+
+// fakeFailure is an error Telegram answers a request with
+type fakeFailure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+func (f *fakeTelegram) RoundTrip(r *http.Request) (*http.Response, error) {
+	upload := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+	if upload {
+		if err := r.ParseMultipartForm(maxDownloadSize); err != nil {
+			return nil, err
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		f.mu.Lock()
+		data, ok := f.files[method]
+		f.mu.Unlock()
+		if !ok {
+			return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: io.NopCloser(strings.NewReader(""))}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(data))}, nil
+	}
+
+	f.mu.Lock()
+	// getMe comes from creating the bot rather than from the handlers
+	if method != "getMe" {
+		f.calls = append(f.calls, fakeCall{method: method, upload: upload})
+	}
+	var failure *fakeFailure
+	if queued := f.failures[method]; len(queued) > 0 {
+		failure, f.failures[method] = &queued[0], queued[1:]
+	}
+	f.mu.Unlock()
+	if failure != nil {
+		return jsonResponse(map[string]any{
+			"ok":          false,
+			"error_code":  failure.code,
+			"description": failure.description,
+			"parameters":  map[string]any{"retry_after": failure.retryAfter},
+		})
+	}
+
+	var result any = true
+	switch method {
+	case "getFile":
+		fileID := r.Form.Get("file_id")
+		result = tgbotapi.File{FileID: fileID, FilePath: "documents/" + fileID}
+	case "getMe":
+		result = tgbotapi.User{ID: 100, IsBot: true, UserName: "test_bot"}
+	case "sendMessage":
+		f.mu.Lock()
+		f.sent = append(f.sent, r.Form.Get("text"))
+		f.mu.Unlock()
+		result = tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1}}
+	case "editMessageText":
+		f.mu.Lock()
+		f.edited = append(f.edited, r.Form.Get("text"))
+		f.mu.Unlock()
+		result = tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1}}
+	case "sendPhoto", "sendDocument", "sendVoice", "sendAudio", "sendVideo", "sendVideoNote":
+		result = tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: 1}}
+	case "sendMediaGroup":
+		var media []json.RawMessage
+		if err := json.Unmarshal([]byte(r.Form.Get("media")), &media); err != nil {
+			return nil, err
+		}
+		f.mu.Lock()
+		f.albums = append(f.albums, len(media))
+		f.mu.Unlock()
+		result = make([]tgbotapi.Message, len(media))
+	}
+
+	return jsonResponse(map[string]any{"ok": true, "result": result})
+}
+
+// jsonResponse is a Bot API answer with the body
+func jsonResponse(body map[string]any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(data))),
+	}, nil
+}
+
+// messages returns the texts sent so far
+func (f *fakeTelegram) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.sent...)
+}
+
+// edits returns the new texts of the messages edited so far
+func (f *fakeTelegram) edits() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.edited...)
+}
+
+// setFile makes a file with the ID available for download
+func (f *fakeTelegram) setFile(fileID, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.files == nil {
+		f.files = make(map[string]string)
+	}
+	f.files[fileID] = data
+}
+
+// fail makes the next request to the method answer with the error. Telegram asks to
+// retry after so many seconds when retryAfter is set.
+func (f *fakeTelegram) fail(method string, code int, description string, retryAfter int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures == nil {
+		f.failures = make(map[string][]fakeFailure)
+	}
+	f.failures[method] = append(f.failures[method], fakeFailure{code: code, description: description, retryAfter: retryAfter})
+}
+
+// requests returns the Bot API requests the handlers made so far
+func (f *fakeTelegram) requests() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeCall(nil), f.calls...)
+}
+
+// albumSizes returns how many photos each album sent so far had
+func (f *fakeTelegram) albumSizes() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.albums...)
+}
+
+// newTestHandler returns a handler backed by memory storage and a fake Bot API. It
+// has a student with Алгебра and Русский every day and a parent linked to them.
+func newTestHandler(t *testing.T) (*Handler, *memory.HomeworkDatabase, *fakeTelegram) {
+	t.Helper()
+	telegram := &fakeTelegram{}
+	bot, err := tgbotapi.NewBotAPIWithClient("TEST", tgbotapi.APIEndpoint, &http.Client{Transport: telegram})
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+
+	ctx := context.Background()
+	db := memory.NewHomeworkDatabase()
+	users := []struct{ id, username, role string }{
+		{testStudentID, "student", storage.RoleStudent},
+		{testParentID, "parent", storage.RoleParent},
+	}
+	for _, user := range users {
+		if err := db.CreateUser(ctx, user.id, user.username); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SetRole(ctx, user.id, user.role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schedule := storage.EmptySchedule()
+	for i := range schedule {
+		schedule[i].Subjects = []storage.Subject{{SubjectName: "Алгебра"}, {SubjectName: "Русский"}}
+	}
+	if err := db.SetSchedule(ctx, testStudentID, schedule); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddStudentContact(ctx, testParentID, testStudentID); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewHandler(bot, db, blobmemory.NewStore(), nil), db, telegram
+}
+
+// textMessage is a private message with text from the user
+func textMessage(userID int64, text string) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: userID},
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		Text:      text,
+	}
+}
+
+// commandMessage is a private message with a command from the user
+func commandMessage(userID int64, text string) *tgbotapi.Message {
+	message := textMessage(userID, text)
+	command, _, _ := strings.Cut(text, " ")
+	message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	return message
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		now    time.Time
+		want   string
+		wantOK bool
+	}{
+		{name: "iso", s: "2027-01-05", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), want: "2027-01-05", wantOK: true},
+		{name: "with year", s: "05.01.2027", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), want: "2027-01-05", wantOK: true},
+		{name: "few months back", s: "14.10", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), want: "2026-10-14", wantOK: true},
+		{name: "later this year", s: "01.09", now: time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC), want: "2027-09-01", wantOK: true},
+		{name: "next year", s: "05.01", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), want: "2027-01-05", wantOK: true},
+		{name: "long past", s: "05.03", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), want: "2027-03-05", wantOK: true},
+		{name: "leap day in a leap year", s: "29.02", now: time.Date(2028, 1, 10, 0, 0, 0, 0, time.UTC), want: "2028-02-29", wantOK: true},
+		{name: "leap day in another year", s: "29.02", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), wantOK: false},
+		{name: "no such day", s: "31.04", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), wantOK: false},
+		{name: "not a date", s: "завтра", now: time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC), wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseDateAt(tt.s, tt.now)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("parseDateAt(%q) = %q, %v, want %q, %v", tt.s, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNextDateAt(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22:30 UTC is already the next day in Moscow
+	now := time.Date(2026, 10, 20, 22, 30, 0, 0, time.UTC)
+	tests := []struct {
+		loc  *time.Location
+		want string
+	}{
+		{loc: time.UTC, want: "2026-10-21"},
+		{loc: moscow, want: "2026-10-22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.loc.String(), func(t *testing.T) {
+			if got := nextDateAt(tt.loc, now); got != tt.want {
+				t.Errorf("nextDateAt(%s) = %s, want %s", tt.loc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDate(t *testing.T) {
+	// 25 hours apart, so tomorrow is never the same date in both
+	const east, west = "Pacific/Kiritimati", "Pacific/Pago_Pago"
+	tests := []struct {
+		name            string
+		studentTimezone string
+		parentTimezone  string
+		wantTimezone    string
+	}{
+		{name: "own zone", studentTimezone: west, parentTimezone: east, wantTimezone: west},
+		{name: "parent's zone", parentTimezone: east, wantTimezone: east},
+		{name: "server's zone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			if err := db.SetReminders(ctx, testStudentID, nil, false, tt.studentTimezone); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetSummarySchedule(ctx, testParentID, "20:00", tt.parentTimezone); err != nil {
+				t.Fatal(err)
+			}
+			student, err := db.GetUser(ctx, testStudentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := nextDateAt(userLocation(storage.User{Timezone: tt.wantTimezone}), time.Now())
+			if got := h.nextDate(ctx, student); got != want {
+				t.Errorf("nextDate() = %s, want %s", got, want)
+			}
+			h.handleSchedule(commandMessage(1, "/schedule"))
+			if sent := telegram.messages(); len(sent) != 1 || !strings.Contains(sent[0], formatDate(want)) {
+				t.Errorf("sent %q, want the lessons of %s", sent, formatDate(want))
+			}
+		})
+	}
+}
+
+func TestSubmitFilesRepliesOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    int
+		wantEdit string
+	}{
+		{name: "single file", files: 1, wantEdit: "Успешно сохранил домашку"},
+		{name: "album", files: 3, wantEdit: "Сохранил 3 стр."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, telegram := newTestHandler(t)
+			var files []homeworkFile
+			for i := 0; i < tt.files; i++ {
+				files = append(files, homeworkFile{mediaType: storage.MediaText, text: "№5"})
+			}
+
+			h.submitFiles(textMessage(1, ""), "Алгебра", files)
+
+			// The progress message is edited into the result instead of a second reply
+			if sent := telegram.messages(); len(sent) != 1 || !strings.HasPrefix(sent[0], "Обрабатываю") {
+				t.Errorf("sent %q, want only the progress message", sent)
+			}
+			if edits := telegram.edits(); len(edits) != 1 || !strings.HasPrefix(edits[0], tt.wantEdit) {
+				t.Errorf("edited to %q, want %q", edits, tt.wantEdit)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/importer"
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxImportFileSize = 1 << 20
+	importTTL         = 30 * time.Minute
+)
+
+// pendingImport is a parsed timetable waiting for the user to confirm it
+type pendingImport struct {
+	targetUserID string
+	schedule     []storage.DaySchedule
+	// calendar is set instead of schedule when the file holds holidays and vacations
+	calendar  *storage.Calendar
+	createdAt time.Time
+}
+
+// Keywords at the start of a document caption that send a .csv or .ics file to the
+// importer: a timetable, or a school calendar for calendarKeyword
+const (
+	scheduleKeyword = "расписание"
+	calendarKeyword = "календарь"
+)
+
+// HandleDocument parses an uploaded CSV or .ics timetable, or an .ics school calendar
+// when the caption starts with "календарь", and shows a preview. Nothing is saved
+// before /importconfirm. Any other file is homework, and so is a .csv or .ics file
+// whose caption names one of the student's lessons and asks for no import.
+func (h *Handler) HandleDocument(message *tgbotapi.Message) {
+	document := message.Document
+	if !importer.Supported(document.FileName) {
+		h.HandleMessage(message)
+		return
+	}
+
+	userID := fmt.Sprintf("%d", message.From.ID)
+	ctx := context.Background()
+	user, err := h.ensureUserInitialized(ctx, userID, message.From.UserName)
+	if err != nil {
+		logger.Error("Error initializing user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка инициализации, попробуйте позже")
+		return
+	}
+	if user.Role == "" {
+		h.askRole(message.Chat.ID, "Сначала выберите, кто вы:")
+		return
+	}
+
+	keyword, args := importKeyword(message.Caption)
+	if keyword == "" && h.isSubmission(ctx, user, args) {
+		h.HandleMessage(message)
+		return
+	}
+
+	if document.FileSize > maxImportFileSize {
+		h.sendMessage(message.Chat.ID, "Файл слишком большой. Максимальный размер — 1 МБ")
+		return
+	}
+
+	isCalendar := keyword == calendarKeyword
+	if isCalendar && strings.ToLower(filepath.Ext(document.FileName)) != ".ics" {
+		h.sendMessage(message.Chat.ID, "Календарь загружается файлом .ics")
+		return
+	}
+
+	target, _, ok := h.targetOrReply(ctx, message, args)
+	if !ok {
+		return
+	}
+
+	file, err := h.bot.GetFile(tgbotapi.FileConfig{FileID: document.FileID})
+	if err != nil {
+		logger.Error("Error getting file: %v", err)
+		h.sendMessage(message.Chat.ID, "Ошибка получения файла, попробуйте позже")
+		return
+	}
+
+	data, err := h.downloadFile(file.Link(h.bot.Token))
+	if err != nil {
+		logger.Error("Error downloading file: %v", err)
+		h.sendMessage(message.Chat.ID, "Ошибка загрузки файла, попробуйте позже")
+		return
+	}
+
+	if isCalendar {
+		calendar, err := importer.ParseCalendarICS(data)
+		if err != nil {
+			h.replyImportError(message.Chat.ID, document.FileName, err)
+			return
+		}
+
+		h.setPendingImport(userID, pendingImport{targetUserID: target.UserID, calendar: &calendar})
+		h.sendMessage(message.Chat.ID, "Проверьте календарь из файла.\n\n"+formatCalendar(calendar)+
+			"\n/importconfirm — добавить каникулы и праздники в календарь\n/importcancel — отменить")
+		return
+	}
+
+	schedule, err := importer.Parse(document.FileName, data)
+	if err != nil {
+		h.replyImportError(message.Chat.ID, document.FileName, err)
+		return
+	}
+
+	h.setPendingImport(userID, pendingImport{targetUserID: target.UserID, schedule: schedule})
+	h.sendMessage(message.Chat.ID, "Проверьте расписание из файла.\n\n"+formatWeek(schedule)+
+		"\n/importconfirm — сохранить (текущее расписание будет заменено)\n/importcancel — отменить")
+}
+
+// importKeyword splits the import keyword the caption starts with, if any, from the
+// rest of the caption
+func importKeyword(caption string) (string, string) {
+	caption = strings.TrimSpace(caption)
+	first, rest, _ := strings.Cut(caption, " ")
+	for _, keyword := range []string{scheduleKeyword, calendarKeyword} {
+		if strings.EqualFold(first, keyword) {
+			return keyword, strings.TrimSpace(rest)
+		}
+	}
+	return "", caption
+}
+
+// isSubmission reports whether a student's document is homework: the caption names
+// one of their lessons, or there is no caption and a subject was picked under a reminder
+func (h *Handler) isSubmission(ctx context.Context, user *storage.User, caption string) bool {
+	if user.Role != storage.RoleStudent {
+		return false
+	}
+	if caption == "" {
+		_, ok := h.uploadTarget(user.UserID)
+		return ok
+	}
+	lesson, options, err := h.resolveLesson(ctx, user, caption)
+	return err == nil && (lesson != nil || len(options) > 0)
+}
+
+func (h *Handler) replyImportError(chatID int64, fileName string, err error) {
+	var lineErrs importer.Errors
+	if errors.As(err, &lineErrs) {
+		h.sendMessage(chatID, "Файл не импортирован, исправьте ошибки и отправьте его снова:\n\n"+lineErrs.Error())
+		return
+	}
+	logger.Error("Error parsing %s: %v", fileName, err)
+	h.sendMessage(chatID, "Не удалось прочитать файл")
+}
+
+func (h *Handler) setPendingImport(userID string, pending pendingImport) {
+	pending.createdAt = time.Now()
+	h.importsLock.Lock()
+	h.pendingImports[userID] = pending
+	h.importsLock.Unlock()
+}
+
+func (h *Handler) handleImportConfirm(message *tgbotapi.Message) {
+	userID := fmt.Sprintf("%d", message.From.ID)
+	pending, ok := h.takePendingImport(userID)
+	if !ok {
+		h.sendMessage(message.Chat.ID, "Нет файла, ожидающего подтверждения. Отправьте файл .csv или .ics")
+		return
+	}
+
+	ctx := context.Background()
+	if pending.calendar != nil {
+		h.confirmCalendarImport(ctx, message.Chat.ID, pending)
+		return
+	}
+
+	if err := h.db.SetSchedule(ctx, pending.targetUserID, pending.schedule); err != nil {
+		logger.Error("Error importing schedule for user %s: %v", pending.targetUserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить расписание. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, "Расписание сохранено ✅")
+}
+
+// confirmCalendarImport adds the imported holidays and vacations to the calendar,
+// keeping the weekly days off
+func (h *Handler) confirmCalendarImport(ctx context.Context, chatID int64, pending pendingImport) {
+	target, err := h.db.GetUser(ctx, pending.targetUserID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", pending.targetUserID, err)
+		h.sendMessage(chatID, "Не удалось сохранить календарь. Попробуйте позже")
+		return
+	}
+
+	h.saveCalendar(ctx, chatID, target.UserID, storage.CalendarOf(target).Merge(*pending.calendar))
+}
+
+func (h *Handler) handleImportCancel(message *tgbotapi.Message) {
+	userID := fmt.Sprintf("%d", message.From.ID)
+	if _, ok := h.takePendingImport(userID); !ok {
+		h.sendMessage(message.Chat.ID, "Нет файла, ожидающего подтверждения.")
+		return
+	}
+	h.sendMessage(message.Chat.ID, "Импорт отменен.")
+}
+
+func (h *Handler) takePendingImport(userID string) (pendingImport, bool) {
+	h.importsLock.Lock()
+	defer h.importsLock.Unlock()
+
+	pending, ok := h.pendingImports[userID]
+	delete(h.pendingImports, userID)
+	if !ok || time.Since(pending.createdAt) > importTTL {
+		return pendingImport{}, false
+	}
+	return pending, true
+}
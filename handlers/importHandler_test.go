@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// documentMessage is a private message with a document from the user
+func documentMessage(userID int64, fileID, fileName, caption string) *tgbotapi.Message {
+	message := textMessage(userID, "")
+	message.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: fileID, FileName: fileName, FileSize: 100}
+	message.Caption = caption
+	return message
+}
+
+func TestHandleDocumentRouting(t *testing.T) {
+	const timetable = "Понедельник,Алгебра,Физика\n"
+	tests := []struct {
+		name     string
+		senderID int64
+		fileName string
+		caption  string
+		// wantHomework means the file is saved as homework rather than imported
+		wantHomework bool
+	}{
+		{name: "csv captioned with a subject", senderID: 1, fileName: "results.csv", caption: "Алгебра", wantHomework: true},
+		{name: "ics captioned with an alias", senderID: 1, fileName: "event.ics", caption: "алг", wantHomework: true},
+		{name: "csv without a caption", senderID: 1, fileName: "timetable.csv"},
+		{name: "keyword", senderID: 1, fileName: "timetable.csv", caption: "Расписание"},
+		{name: "caption names no lesson", senderID: 1, fileName: "timetable.csv", caption: "Информатика"},
+		{name: "parent names the student", senderID: 2, fileName: "timetable.csv", caption: "1"},
+		{name: "parent with keyword", senderID: 2, fileName: "timetable.csv", caption: "расписание @student"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			telegram.setFile("file1", timetable)
+
+			h.HandleDocument(documentMessage(tt.senderID, "file1", tt.fileName, tt.caption))
+
+			homeworks, err := db.GetHomeworkUploadedSince(ctx, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved := len(homeworks) > 0; saved != tt.wantHomework {
+				t.Errorf("saved %d homeworks, want homework: %v", len(homeworks), tt.wantHomework)
+			}
+			_, pending := h.takePendingImport(testParentID)
+			if !pending {
+				_, pending = h.takePendingImport(testStudentID)
+			}
+			if pending == tt.wantHomework {
+				t.Errorf("import pending = %v, want %v (sent %q)", pending, !tt.wantHomework, telegram.messages())
+			}
+		})
+	}
+}
+
+func TestImportFlow(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+		// wantSubjects is Monday of the saved timetable
+		wantSubjects []string
+	}{
+		{name: "confirm", command: "/importconfirm", want: "Расписание сохранено", wantSubjects: []string{"Физика", "Химия"}},
+		{name: "cancel", command: "/importcancel", want: "Импорт отменен", wantSubjects: []string{"Алгебра", "Русский"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			telegram.setFile("file1", "день,предметы\nПн,Физика,Химия\n")
+
+			h.HandleDocument(documentMessage(1, "file1", "timetable.csv", ""))
+			if sent := telegram.messages(); len(sent) != 1 || !strings.HasPrefix(sent[0], "Проверьте расписание из файла") ||
+				!strings.Contains(sent[0], "Физика") {
+				t.Fatalf("sent %q, want a preview of the timetable", sent)
+			}
+
+			h.HandleCommand(commandMessage(1, tt.command))
+			if sent := telegram.messages(); !strings.HasPrefix(sent[len(sent)-1], tt.want) {
+				t.Errorf("replied %q, want %q", sent[len(sent)-1], tt.want)
+			}
+
+			day, err := db.GetScheduleForDay(ctx, testStudentID, time.Monday.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var subjects []string
+			for _, subject := range day.Subjects {
+				subjects = append(subjects, subject.SubjectName)
+			}
+			if !slices.Equal(subjects, tt.wantSubjects) {
+				t.Errorf("Monday = %v, want %v", subjects, tt.wantSubjects)
+			}
+
+			// The preview is used up either way
+			h.HandleCommand(commandMessage(1, "/importconfirm"))
+			if sent := telegram.messages(); !strings.HasPrefix(sent[len(sent)-1], "Нет файла") {
+				t.Errorf("replied %q to a second /importconfirm", sent[len(sent)-1])
+			}
+		})
+	}
+}
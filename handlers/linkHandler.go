@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	linkPrefix  = "link"
+	linkApprove = "ok"
+	linkDecline = "no"
+
+	// invitePayload starts the /start argument of an invite deep link
+	invitePayload = "link_"
+
+	// pickStudentRequestID marks users shared with the /addstudent keyboard button
+	pickStudentRequestID = 1
+)
+
+// SharedUser is a user picked with a request_users keyboard button
+type SharedUser struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username,omitempty"`
+}
+
+// UsersShared is the users_shared field of a message. The Telegram library predates
+// it, so the updater decodes it separately.
+type UsersShared struct {
+	RequestID int          `json:"request_id"`
+	Users     []SharedUser `json:"users"`
+}
+
+// requestUsersButton is a reply keyboard button that lets the user pick someone from
+// their chats. The library's KeyboardButton has no request_users.
+type requestUsersButton struct {
+	Text         string `json:"text"`
+	RequestUsers struct {
+		RequestID       int  `json:"request_id"`
+		UserIsBot       bool `json:"user_is_bot"`
+		MaxQuantity     int  `json:"max_quantity"`
+		RequestUsername bool `json:"request_username"`
+	} `json:"request_users"`
+}
+
+type requestUsersKeyboard struct {
+	Keyboard        [][]requestUsersButton `json:"keyboard"`
+	ResizeKeyboard  bool                   `json:"resize_keyboard"`
+	OneTimeKeyboard bool                   `json:"one_time_keyboard"`
+}
+
+func pickStudentKeyboard() requestUsersKeyboard {
+	button := requestUsersButton{Text: "👤 Выбрать ученика"}
+	button.RequestUsers.RequestID = pickStudentRequestID
+	button.RequestUsers.MaxQuantity = 1
+	button.RequestUsers.RequestUsername = true
+	return requestUsersKeyboard{
+		Keyboard:        [][]requestUsersButton{{button}},
+		ResizeKeyboard:  true,
+		OneTimeKeyboard: true,
+	}
+}
+
+// HandleUsersShared sends a link request to the student a parent picked with the
+// /addstudent keyboard button
+func (h *Handler) HandleUsersShared(message *tgbotapi.Message, shared UsersShared) {
+	userID := fmt.Sprintf("%d", message.From.ID)
+	ctx := context.Background()
+	user, err := h.ensureUserInitialized(ctx, userID, message.From.UserName)
+	if err != nil {
+		logger.Error("Error initializing user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка инициализации, попробуйте позже")
+		return
+	}
+
+	if shared.RequestID != pickStudentRequestID || !h.checkRole(message, user, "addstudent") {
+		return
+	}
+
+	// The keyboard has done its job
+	msg := tgbotapi.NewMessage(message.Chat.ID, "Ищу ученика...")
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Error sending message: %v", err)
+	}
+
+	for _, picked := range shared.Users {
+		student, err := h.db.GetUser(ctx, fmt.Sprintf("%d", picked.UserID))
+		if err != nil {
+			logger.Error("Error finding shared student %d for parent %s: %v", picked.UserID, userID, err)
+			h.replyStudentNotFound(message.Chat.ID, err)
+			continue
+		}
+		h.addStudent(ctx, message, student)
+	}
+}
+
+// displayName is how a user is named to the other side of a link
+func displayName(user *storage.User) string {
+	if user.Username == "" {
+		return "ID " + user.UserID
+	}
+	return "@" + user.Username
+}
+
+// handleInvite gives the student a one-time link that connects a parent to them
+func (h *Handler) handleInvite(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	token, err := newToken()
+	if err != nil {
+		logger.Error("Error generating invite token: %v", err)
+		h.sendMessage(message.Chat.ID, "Не удалось создать приглашение, попробуйте позже")
+		return
+	}
+
+	invite := storage.Invite{Token: token, StudentID: userID, ExpiresAt: time.Now().Add(storage.InviteTTL)}
+	if err := h.db.CreateInvite(ctx, invite); err != nil {
+		logger.Error("Error creating invite for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось создать приглашение, попробуйте позже")
+		return
+	}
+
+	link := fmt.Sprintf("https://t.me/%s?start=%s%s", h.bot.Self.UserName, invitePayload, token)
+	h.sendMessage(message.Chat.ID, "Перешлите эту ссылку родителю. Открыв ее, он будет получать вашу домашку и сводки:\n\n"+
+		link+"\n\nСсылка одноразовая и действует 24 часа. Отключить родителя можно командой /unlink.")
+}
+
+// acceptInvite links the sender of /start link_<token> to the student who created the
+// invite. Someone who opens an invite before picking a role becomes a parent.
+func (h *Handler) acceptInvite(message *tgbotapi.Message, user *storage.User, token string) {
+	ctx := context.Background()
+	parentID := fmt.Sprintf("%d", message.From.ID)
+
+	if user.Role != "" && !storage.IsSupervisor(user.Role) {
+		h.sendMessage(message.Chat.ID, "Это приглашение для родителя или репетитора. Если это вы, смените роль командой /role и откройте ссылку еще раз.")
+		return
+	}
+
+	// The invite is checked before it is used up, so opening a link that isn't meant
+	// for the sender leaves it valid
+	invite, err := h.db.GetInvite(ctx, token)
+	if err == nil && invite.ParentID != "" {
+		err = fmt.Errorf("invite %s is a link request: %w", token, storage.ErrNotFound)
+	}
+	if err == nil && invite.StudentID == parentID {
+		h.sendMessage(message.Chat.ID, "Это ваше собственное приглашение. Перешлите ссылку родителю.")
+		return
+	}
+	if err == nil {
+		// Whoever takes the invite first gets it
+		_, err = h.db.TakeInvite(ctx, token)
+	}
+	if err != nil {
+		logger.Error("Error accepting invite by %s: %v", parentID, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendMessage(message.Chat.ID, "Приглашение недействительно или устарело. Попросите ученика отправить /invite еще раз.")
+		} else {
+			h.sendMessage(message.Chat.ID, "Не удалось принять приглашение, попробуйте позже")
+		}
+		return
+	}
+
+	// The role changes only once the invite is really used
+	if user.Role == "" {
+		if err := h.setRole(ctx, parentID, storage.RoleParent); err != nil {
+			logger.Error("Error setting role of user %s: %v", parentID, err)
+			h.sendMessage(message.Chat.ID, "Не удалось принять приглашение, попробуйте позже")
+			return
+		}
+		user.Role = storage.RoleParent
+	}
+
+	h.linkParent(ctx, message.Chat.ID, parentID, invite.StudentID)
+}
+
+// requestLink asks the student to approve a parent who found them by username
+func (h *Handler) requestLink(ctx context.Context, chatID int64, parent, student *storage.User) error {
+	studentID, err := strconv.ParseInt(student.UserID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid student ID %s: %w", student.UserID, err)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	invite := storage.Invite{Token: token, StudentID: student.UserID, ParentID: parent.UserID, ExpiresAt: time.Now().Add(storage.InviteTTL)}
+	if err := h.db.CreateInvite(ctx, invite); err != nil {
+		return err
+	}
+
+	msg := tgbotapi.NewMessage(studentID, fmt.Sprintf("%s хочет получать вашу домашку и сводки. Разрешить?", displayName(parent)))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Разрешить", linkPrefix+":"+token+":"+linkApprove),
+		tgbotapi.NewInlineKeyboardButtonData("🚫 Отклонить", linkPrefix+":"+token+":"+linkDecline),
+	))
+	if _, err := h.bot.Send(msg); err != nil {
+		return fmt.Errorf("failed to send link request: %w", err)
+	}
+
+	h.sendMessage(chatID, fmt.Sprintf("Запрос отправлен %s. Как только ученик его подтвердит, вы сможете проверять домашку через /checkhw.", displayName(student)))
+	return nil
+}
+
+func (h *Handler) handleLinkCallback(query *tgbotapi.CallbackQuery, data string) {
+	ctx := context.Background()
+	token, action, _ := strings.Cut(data, ":")
+	studentID := fmt.Sprintf("%d", query.From.ID)
+
+	// Only the student the request was sent to uses it up
+	invite, err := h.db.GetInvite(ctx, token)
+	if err == nil && (invite.StudentID != studentID || invite.ParentID == "") {
+		err = fmt.Errorf("link request %s is not for %s: %w", token, studentID, storage.ErrNotFound)
+	}
+	if err == nil {
+		_, err = h.db.TakeInvite(ctx, token)
+	}
+	if err != nil {
+		logger.Error("Error answering link request %s by %s: %v", token, studentID, err)
+		h.answerCallback(query, "")
+		h.editCallbackMessage(query, "Запрос устарел. Родитель может отправить его снова.")
+		return
+	}
+
+	h.answerCallback(query, "")
+	parentChatID, err := strconv.ParseInt(invite.ParentID, 10, 64)
+	if err != nil {
+		logger.Error("Error converting parent ID: %v", err)
+		return
+	}
+
+	if action != linkApprove {
+		h.editCallbackMessage(query, "Запрос отклонен.")
+		h.sendMessage(parentChatID, "Ученик отклонил ваш запрос.")
+		return
+	}
+
+	h.editCallbackMessage(query, "Запрос одобрен ✅")
+	h.linkParent(ctx, query.From.ID, invite.ParentID, studentID)
+}
+
+// linkParent adds the student to the parent's contacts and tells both sides
+func (h *Handler) linkParent(ctx context.Context, chatID int64, parentID, studentID string) {
+	parent, err := h.db.GetUser(ctx, parentID)
+	if err == nil {
+		var student *storage.User
+		student, err = h.db.GetUser(ctx, studentID)
+		if err == nil {
+			err = h.db.AddStudentContact(ctx, parentID, studentID)
+		}
+		if err == nil {
+			// The student may now fall back to the parent's time zone
+			h.resetReminders(ctx, []storage.User{*student})
+			h.notifyLinked(parent, student)
+			return
+		}
+	}
+
+	logger.Error("Error linking parent %s to student %s: %v", parentID, studentID, err)
+	h.sendMessage(chatID, "Не удалось связать аккаунты, попробуйте позже")
+}
+
+func (h *Handler) notifyLinked(parent, student *storage.User) {
+	if id, err := strconv.ParseInt(parent.UserID, 10, 64); err == nil {
+		h.sendMessage(id, fmt.Sprintf("Вы связаны с %s. Теперь вы можете проверять его домашку с помощью /checkhw", displayName(student)))
+	}
+	if id, err := strconv.ParseInt(student.UserID, 10, 64); err == nil {
+		h.sendMessage(id, fmt.Sprintf("%s теперь получает вашу домашку и сводки. Отключить: /unlink", displayName(parent)))
+	}
+}
+
+// parentsOf returns the users linked to the student. The role does not matter, so the
+// student sees and can revoke every link.
+func (h *Handler) parentsOf(ctx context.Context, student *storage.User) ([]storage.User, error) {
+	return h.db.GetParentsOf(ctx, student.UserID)
+}
+
+// handleUnlink removes a link from either side: a parent names the student, a
+// student names the parent. Without arguments it lists the current links.
+func (h *Handler) handleUnlink(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить вашу информацию. Пожалуйста, попробуйте снова.")
+		return
+	}
+
+	parents, err := h.parentsOf(ctx, user)
+	if err != nil {
+		logger.Error("Error getting parents of %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить вашу информацию. Пожалуйста, попробуйте снова.")
+		return
+	}
+
+	students := h.linkedStudents(ctx, user)
+
+	name := strings.TrimSpace(message.CommandArguments())
+	if name == "" {
+		h.sendMessage(message.Chat.ID, formatLinks(user, students, parents)+
+			"\nИспользование: /unlink @username или ID — отключить ученика или родителя")
+		return
+	}
+
+	// A parent drops one of their students
+	for _, student := range students {
+		if matchesUser(&student, name) {
+			h.unlinkStudent(ctx, message.Chat.ID, user, &student)
+			return
+		}
+	}
+
+	// A student drops one of their parents
+	for _, parent := range parents {
+		if matchesUser(&parent, name) {
+			if err := h.db.RemoveStudentContact(ctx, parent.UserID, user.UserID); err != nil {
+				logger.Error("Error unlinking %s from %s: %v", user.UserID, parent.UserID, err)
+				h.sendMessage(message.Chat.ID, "Не удалось отключить родителя, попробуйте позже")
+				return
+			}
+			h.sendMessage(message.Chat.ID, fmt.Sprintf("%s больше не получает вашу домашку.", displayName(&parent)))
+			if id, err := strconv.ParseInt(parent.UserID, 10, 64); err == nil {
+				h.sendMessage(id, fmt.Sprintf("%s отключил вас, вы больше не будете получать его домашку.", displayName(user)))
+			}
+			return
+		}
+	}
+
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("У вас нет связи с %s.", name))
+}
+
+// matchesUser reports whether arg names the user, as @username or by user ID
+func matchesUser(user *storage.User, arg string) bool {
+	if arg == user.UserID {
+		return true
+	}
+	username := strings.TrimPrefix(arg, "@")
+	return user.Username != "" && strings.EqualFold(user.Username, username)
+}
+
+// unlinkStudent stops the parent's notifications about the student and tells both sides
+func (h *Handler) unlinkStudent(ctx context.Context, chatID int64, parent, student *storage.User) bool {
+	if err := h.db.RemoveStudentContact(ctx, parent.UserID, student.UserID); err != nil {
+		logger.Error("Error unlinking %s from %s: %v", student.UserID, parent.UserID, err)
+		h.sendMessage(chatID, "Не удалось отключить ученика, попробуйте позже")
+		return false
+	}
+
+	h.sendMessage(chatID, fmt.Sprintf("%s отключен, вы больше не будете получать его домашку.", studentName(parent, student)))
+	if id, err := strconv.ParseInt(student.UserID, 10, 64); err == nil {
+		h.sendMessage(id, fmt.Sprintf("%s больше не получает вашу домашку.", displayName(parent)))
+	}
+	return true
+}
+
+func formatLinks(user *storage.User, students, parents []storage.User) string {
+	if len(students) == 0 && len(parents) == 0 {
+		return "У вас пока нет связанных учеников или родителей.\n"
+	}
+
+	text := ""
+	if len(students) > 0 {
+		text += "Ваши ученики:\n"
+		for _, student := range students {
+			text += "- " + studentName(user, &student) + "\n"
+		}
+	}
+	if len(parents) > 0 {
+		text += "Вашу домашку получают:\n"
+		for _, parent := range parents {
+			text += "- " + displayName(&parent) + "\n"
+		}
+	}
+	return text
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestAcceptInvite(t *testing.T) {
+	const newUserID = "3"
+	tests := []struct {
+		name       string
+		userID     int64
+		invite     *storage.Invite
+		token      string
+		wantRole   string
+		wantLinked bool
+		// wantKept means the invite can still be used afterwards
+		wantKept bool
+	}{
+		{name: "new user", userID: 3, invite: &storage.Invite{StudentID: testStudentID}, token: "token",
+			wantRole: storage.RoleParent, wantLinked: true},
+		{name: "expired", userID: 3, invite: &storage.Invite{StudentID: testStudentID, ExpiresAt: time.Now().Add(-time.Minute)}, token: "token",
+			wantRole: ""},
+		{name: "unknown token", userID: 3, token: "unknown", wantRole: ""},
+		{name: "link request", userID: 3, invite: &storage.Invite{StudentID: testStudentID, ParentID: testParentID}, token: "token",
+			wantRole: "", wantKept: true},
+		{name: "own invite", userID: 1, invite: &storage.Invite{StudentID: testStudentID}, token: "token",
+			wantRole: storage.RoleStudent, wantKept: true},
+		{name: "student of someone else", userID: 1, invite: &storage.Invite{StudentID: newUserID}, token: "token",
+			wantRole: storage.RoleStudent, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			if err := db.CreateUser(ctx, newUserID, "new"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.invite != nil {
+				invite := *tt.invite
+				invite.Token = "token"
+				if invite.ExpiresAt.IsZero() {
+					invite.ExpiresAt = time.Now().Add(storage.InviteTTL)
+				}
+				if err := db.CreateInvite(ctx, invite); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			userID := fmt.Sprintf("%d", tt.userID)
+			user, err := h.ensureUserInitialized(ctx, userID, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.acceptInvite(commandMessage(tt.userID, "/start "+invitePayload+tt.token), user, tt.token)
+
+			if user, err = db.GetUser(ctx, userID); err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", user.Role, tt.wantRole)
+			}
+			if linked := slices.Contains(user.StudentIDs, testStudentID); linked != tt.wantLinked {
+				t.Errorf("linked = %v, want %v", linked, tt.wantLinked)
+			}
+			if _, err := db.GetInvite(ctx, "token"); (err == nil) != tt.wantKept {
+				t.Errorf("GetInvite() error = %v, want the invite kept: %v", err, tt.wantKept)
+			}
+			if len(telegram.messages()) == 0 {
+				t.Error("sent nothing, want a reply")
+			}
+		})
+	}
+}
+
+func TestHandleLinkCallback(t *testing.T) {
+	const newParentID = "3"
+	tests := []struct {
+		name       string
+		studentID  int64
+		action     string
+		wantLinked bool
+		wantKept   bool
+	}{
+		{name: "approve", studentID: 1, action: linkApprove, wantLinked: true},
+		{name: "decline", studentID: 1, action: linkDecline},
+		{name: "someone else's request", studentID: 2, action: linkApprove, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, _ := newTestHandler(t)
+			if err := db.CreateUser(ctx, newParentID, "new"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetRole(ctx, newParentID, storage.RoleParent); err != nil {
+				t.Fatal(err)
+			}
+			invite := storage.Invite{Token: "token", StudentID: testStudentID, ParentID: newParentID, ExpiresAt: time.Now().Add(storage.InviteTTL)}
+			if err := db.CreateInvite(ctx, invite); err != nil {
+				t.Fatal(err)
+			}
+
+			query := &tgbotapi.CallbackQuery{
+				ID:      "1",
+				From:    &tgbotapi.User{ID: tt.studentID},
+				Message: textMessage(tt.studentID, ""),
+			}
+			h.handleLinkCallback(query, "token:"+tt.action)
+
+			parent, err := db.GetUser(ctx, newParentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := slices.Contains(parent.StudentIDs, testStudentID); linked != tt.wantLinked {
+				t.Errorf("linked = %v, want %v", linked, tt.wantLinked)
+			}
+			if _, err := db.GetInvite(ctx, "token"); (err == nil) != tt.wantKept {
+				t.Errorf("GetInvite() error = %v, want the request kept: %v", err, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestHandleUsersShared(t *testing.T) {
+	const newStudentID = 3
+	tests := []struct {
+		name      string
+		senderID  int64
+		requestID int
+		pickedID  int64
+		// want is the start of the message the picked student or the sender gets last
+		want string
+	}{
+		{name: "new student", senderID: 2, requestID: pickStudentRequestID, pickedID: newStudentID, want: "@parent хочет получать"},
+		{name: "already linked", senderID: 2, requestID: pickStudentRequestID, pickedID: 1, want: "@student уже в ваших контактах"},
+		{name: "self", senderID: 2, requestID: pickStudentRequestID, pickedID: 2, want: "Нельзя добавить самого себя"},
+		{name: "never wrote to the bot", senderID: 2, requestID: pickStudentRequestID, pickedID: 4, want: "Ученик не найден"},
+		{name: "other button", senderID: 2, requestID: pickStudentRequestID + 1, pickedID: newStudentID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, db, telegram := newTestHandler(t)
+			if err := db.CreateUser(context.Background(), fmt.Sprintf("%d", newStudentID), "new"); err != nil {
+				t.Fatal(err)
+			}
+
+			shared := UsersShared{RequestID: tt.requestID, Users: []SharedUser{{UserID: tt.pickedID}}}
+			message := textMessage(tt.senderID, "")
+			message.From.UserName = "parent"
+			h.HandleUsersShared(message, shared)
+
+			sent := telegram.messages()
+			if tt.want == "" {
+				if len(sent) > 0 {
+					t.Errorf("sent %q, want nothing", sent)
+				}
+				return
+			}
+			if len(sent) < 2 || !strings.HasPrefix(sent[1], tt.want) {
+				t.Errorf("sent %q, want %q after the keyboard is removed", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnlinkAfterRoleSwitch(t *testing.T) {
+	tests := []struct {
+		name string
+		// stale means the role changed without dropping the links, as before setRole did
+		stale bool
+	}{
+		{name: "role switch drops links"},
+		{name: "stale link is revocable", stale: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+
+			switchRole := h.setRole
+			if tt.stale {
+				switchRole = db.SetRole
+			}
+			if err := switchRole(ctx, testParentID, storage.RoleStudent); err != nil {
+				t.Fatal(err)
+			}
+
+			// The student sees every link left and can drop it
+			h.handleUnlink(commandMessage(1, "/unlink @parent"))
+			if err := h.setRole(ctx, testParentID, storage.RoleParent); err != nil {
+				t.Fatal(err)
+			}
+
+			parent, err := db.GetUser(ctx, testParentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Contains(parent.StudentIDs, testStudentID) {
+				t.Errorf("student IDs = %v, want the student unlinked", parent.StudentIDs)
+			}
+			if sent := telegram.messages(); len(sent) == 0 || !strings.Contains(strings.Join(sent, "\n"), "больше не получает вашу домашку") {
+				t.Errorf("sent %q, want the student told about the unlink", sent)
+			}
+		})
+	}
+}
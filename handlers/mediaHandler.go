@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxDownloadSize is the largest file the Bot API lets bots download
+const maxDownloadSize = 20 << 20
+
+// homeworkFile is a file of a submission as Telegram sent it, or a text answer
+type homeworkFile struct {
+	mediaType    string
+	fileID       string
+	fileUniqueID string
+	fileName     string
+	size         int
+	// text is the answer of a MediaText submission
+	text string
+}
+
+// mediaTitles name each kind of file in messages
+var mediaTitles = map[string]string{
+	storage.MediaPhoto:     "фото",
+	storage.MediaDocument:  "файл",
+	storage.MediaVoice:     "голосовое",
+	storage.MediaAudio:     "аудио",
+	storage.MediaVideo:     "видео",
+	storage.MediaVideoNote: "видеосообщение",
+	storage.MediaText:      "ответ",
+}
+
+// messageFile returns the photo, document, voice, audio, video or video note of a message
+func messageFile(message *tgbotapi.Message) (homeworkFile, bool) {
+	switch {
+	case len(message.Photo) > 0:
+		p := message.Photo[len(message.Photo)-1]
+		return homeworkFile{mediaType: storage.MediaPhoto, fileID: p.FileID, fileUniqueID: p.FileUniqueID, size: p.FileSize}, true
+	case message.Document != nil:
+		d := message.Document
+		return homeworkFile{mediaType: storage.MediaDocument, fileID: d.FileID, fileUniqueID: d.FileUniqueID, fileName: d.FileName, size: d.FileSize}, true
+	case message.Voice != nil:
+		v := message.Voice
+		return homeworkFile{mediaType: storage.MediaVoice, fileID: v.FileID, fileUniqueID: v.FileUniqueID, size: v.FileSize}, true
+	case message.Audio != nil:
+		a := message.Audio
+		return homeworkFile{mediaType: storage.MediaAudio, fileID: a.FileID, fileUniqueID: a.FileUniqueID, fileName: a.FileName, size: a.FileSize}, true
+	case message.Video != nil:
+		v := message.Video
+		return homeworkFile{mediaType: storage.MediaVideo, fileID: v.FileID, fileUniqueID: v.FileUniqueID, fileName: v.FileName, size: v.FileSize}, true
+	case message.VideoNote != nil:
+		v := message.VideoNote
+		return homeworkFile{mediaType: storage.MediaVideoNote, fileID: v.FileID, fileUniqueID: v.FileUniqueID, size: v.FileSize}, true
+	}
+	return homeworkFile{}, false
+}
+
+// uploadName is the file name a submission is re-uploaded with when its file ID is gone
+func uploadName(content storage.Content) string {
+	if content.FileName != "" {
+		return content.FileName
+	}
+	switch content.MediaType() {
+	case storage.MediaDocument:
+		return "homework"
+	case storage.MediaVoice:
+		return "homework.ogg"
+	case storage.MediaAudio:
+		return "homework.mp3"
+	case storage.MediaVideo, storage.MediaVideoNote:
+		return "homework.mp4"
+	}
+	return "homework.jpg"
+}
+
+// contentMessage builds a message sending the file the way the student sent it.
+// Video notes can't have a caption, so theirs is ignored.
+func contentMessage(chatID int64, content storage.Content, file tgbotapi.RequestFileData, caption string, markup interface{}) tgbotapi.Chattable {
+	switch content.MediaType() {
+	case storage.MediaDocument:
+		msg := tgbotapi.NewDocument(chatID, file)
+		msg.Caption, msg.ReplyMarkup = caption, markup
+		return msg
+	case storage.MediaVoice:
+		msg := tgbotapi.NewVoice(chatID, file)
+		msg.Caption, msg.ReplyMarkup = caption, markup
+		return msg
+	case storage.MediaAudio:
+		msg := tgbotapi.NewAudio(chatID, file)
+		msg.Caption, msg.ReplyMarkup = caption, markup
+		return msg
+	case storage.MediaVideo:
+		msg := tgbotapi.NewVideo(chatID, file)
+		msg.Caption, msg.ReplyMarkup = caption, markup
+		return msg
+	case storage.MediaVideoNote:
+		msg := tgbotapi.NewVideoNote(chatID, 0, file)
+		msg.ReplyMarkup = markup
+		return msg
+	}
+	msg := tgbotapi.NewPhoto(chatID, file)
+	msg.Caption, msg.ReplyMarkup = caption, markup
+	return msg
+}
+
+// sentFile returns the Telegram file of a message sent by contentMessage
+func sentFile(sent tgbotapi.Message) (string, string, bool) {
+	switch {
+	case len(sent.Photo) > 0:
+		largest := sent.Photo[len(sent.Photo)-1]
+		return largest.FileID, largest.FileUniqueID, true
+	case sent.Document != nil:
+		return sent.Document.FileID, sent.Document.FileUniqueID, true
+	case sent.Voice != nil:
+		return sent.Voice.FileID, sent.Voice.FileUniqueID, true
+	case sent.Audio != nil:
+		return sent.Audio.FileID, sent.Audio.FileUniqueID, true
+	case sent.Video != nil:
+		return sent.Video.FileID, sent.Video.FileUniqueID, true
+	case sent.VideoNote != nil:
+		return sent.VideoNote.FileID, sent.VideoNote.FileUniqueID, true
+	}
+	return "", "", false
+}
+
+// sendContent sends a submission by its Telegram file ID. If Telegram rejects the ID,
+// or there is none, the bytes are streamed from the blob store instead.
+func (h *Handler) sendContent(ctx context.Context, chatID int64, homework storage.Homework, caption string, markup interface{}) (tgbotapi.Message, error) {
+	if homework.Content.FileID != "" {
+		sent, err := retryRateLimited(func() (tgbotapi.Message, error) {
+			return h.bot.Send(contentMessage(chatID, homework.Content, tgbotapi.FileID(homework.Content.FileID), caption, markup))
+		})
+		if !fileIDRejected(err) {
+			return sent, err
+		}
+		logger.Warning("Telegram rejected file ID of homework %s, re-uploading: %v", homework.ID, err)
+	}
+
+	return retryRateLimited(func() (tgbotapi.Message, error) {
+		reader, err := h.blobs.Get(ctx, homework.Content.Ref)
+		if err != nil {
+			return tgbotapi.Message{}, fmt.Errorf("failed to open homework %s: %w", homework.ID, err)
+		}
+		defer reader.Close()
+
+		file := tgbotapi.FileReader{Name: uploadName(homework.Content), Reader: reader}
+		return h.bot.Send(contentMessage(chatID, homework.Content, file, caption, markup))
+	})
+}
+
+// fileIDRejected reports whether Telegram refused a file ID itself, e.g. because the
+// file is gone from its servers. Blocked chats and rate limits are not this.
+func fileIDRejected(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+		return false
+	}
+	// Expired references come as e.g. "FILE_REFERENCE_EXPIRED"
+	description := strings.ToLower(strings.ReplaceAll(apiErr.Message, "_", " "))
+	return strings.Contains(description, "wrong file identifier") || strings.Contains(description, "file reference")
+}
+
+// formatFileCounts describes the files of a subject, e.g. "2 фото, 1 голосовое"
+func formatFileCounts(homeworks []storage.Homework) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, homework := range homeworks {
+		mediaType := homework.Content.MediaType()
+		if counts[mediaType] == 0 {
+			order = append(order, mediaType)
+		}
+		counts[mediaType]++
+	}
+
+	parts := make([]string, len(order))
+	for i, mediaType := range order {
+		parts[i] = fmt.Sprintf("%d %s", counts[mediaType], mediaTitles[mediaType])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSendContent(t *testing.T) {
+	tests := []struct {
+		name string
+		// failure is the error Telegram answers the first send with, if any
+		failure   *fakeFailure
+		wantCalls []fakeCall
+		wantErr   bool
+	}{
+		{name: "by file ID", wantCalls: []fakeCall{{method: "sendDocument"}}},
+		{
+			name:      "wrong file identifier",
+			failure:   &fakeFailure{code: http.StatusBadRequest, description: "Bad Request: wrong file identifier/HTTP URL specified"},
+			wantCalls: []fakeCall{{method: "sendDocument"}, {method: "sendDocument", upload: true}},
+		},
+		{
+			name:      "expired file reference",
+			failure:   &fakeFailure{code: http.StatusBadRequest, description: "Bad Request: FILE_REFERENCE_EXPIRED"},
+			wantCalls: []fakeCall{{method: "sendDocument"}, {method: "sendDocument", upload: true}},
+		},
+		{
+			name:      "rate limited",
+			failure:   &fakeFailure{code: http.StatusTooManyRequests, description: "Too Many Requests: retry after 1", retryAfter: 1},
+			wantCalls: []fakeCall{{method: "sendDocument"}, {method: "sendDocument"}},
+		},
+		{
+			name:      "blocked",
+			failure:   &fakeFailure{code: http.StatusForbidden, description: "Forbidden: bot was blocked by the user"},
+			wantCalls: []fakeCall{{method: "sendDocument"}},
+			wantErr:   true,
+		},
+		{
+			name:      "chat not found",
+			failure:   &fakeFailure{code: http.StatusBadRequest, description: "Bad Request: chat not found"},
+			wantCalls: []fakeCall{{method: "sendDocument"}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, _, telegram := newTestHandler(t)
+			const data = "answers"
+			if err := h.blobs.Put(ctx, "1/2026-10-20/answers", strings.NewReader(data), int64(len(data))); err != nil {
+				t.Fatal(err)
+			}
+			if tt.failure != nil {
+				telegram.fail("sendDocument", tt.failure.code, tt.failure.description, tt.failure.retryAfter)
+			}
+
+			homework := storage.Homework{
+				ID:      "1",
+				Content: storage.Content{Type: storage.MediaDocument, Ref: "1/2026-10-20/answers", FileID: "file1", FileName: "answers.pdf"},
+			}
+			_, err := h.sendContent(ctx, 2, homework, "Алгебра", nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sendContent() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if calls := telegram.requests(); !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("requests = %+v, want %+v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSubmitMediaTypes(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		// attach puts the file into the message the way Telegram does
+		attach     func(message *tgbotapi.Message)
+		wantMethod string
+	}{
+		{
+			mediaType: storage.MediaDocument,
+			attach: func(m *tgbotapi.Message) {
+				m.Document = &tgbotapi.Document{FileID: "file1", FileName: "answers.pdf", FileSize: 4}
+			},
+			wantMethod: "sendDocument",
+		},
+		{
+			mediaType:  storage.MediaVoice,
+			attach:     func(m *tgbotapi.Message) { m.Voice = &tgbotapi.Voice{FileID: "file1", FileSize: 4} },
+			wantMethod: "sendVoice",
+		},
+		{
+			mediaType: storage.MediaAudio,
+			attach: func(m *tgbotapi.Message) {
+				m.Audio = &tgbotapi.Audio{FileID: "file1", FileName: "poem.mp3", FileSize: 4}
+			},
+			wantMethod: "sendAudio",
+		},
+		{
+			mediaType:  storage.MediaVideo,
+			attach:     func(m *tgbotapi.Message) { m.Video = &tgbotapi.Video{FileID: "file1", FileSize: 4} },
+			wantMethod: "sendVideo",
+		},
+		{
+			mediaType:  storage.MediaVideoNote,
+			attach:     func(m *tgbotapi.Message) { m.VideoNote = &tgbotapi.VideoNote{FileID: "file1", FileSize: 4} },
+			wantMethod: "sendVideoNote",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			telegram.setFile("file1", "data")
+
+			message := textMessage(1, "")
+			tt.attach(message)
+			if tt.mediaType == storage.MediaVideoNote {
+				// Video notes can't have a caption, so the lesson is picked under a reminder
+				student, err := db.GetUser(ctx, testStudentID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: 1}, Message: textMessage(1, "")}
+				h.handleUploadCallback(query, h.nextDate(ctx, student)+":"+subjectKey("Алгебра"))
+			} else {
+				message.Caption = "Алгебра"
+			}
+			h.HandleMessage(message)
+
+			homeworks, err := db.GetHomeworkUploadedSince(ctx, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(homeworks) != 1 {
+				t.Fatalf("saved %d homeworks, want 1 (sent %q)", len(homeworks), telegram.messages())
+			}
+			homework := homeworks[0]
+			if homework.Subject != "Алгебра" || homework.Content.MediaType() != tt.mediaType || homework.Content.FileID != "file1" {
+				t.Errorf("saved %s as %q with file %q, want Алгебра as %q with file1",
+					homework.Subject, homework.Content.MediaType(), homework.Content.FileID, tt.mediaType)
+			}
+
+			before := len(telegram.requests())
+			if err := h.sendHomework(ctx, 2, homework); err != nil {
+				t.Fatal(err)
+			}
+			calls := telegram.requests()[before:]
+			if !slices.Contains(calls, fakeCall{method: tt.wantMethod}) {
+				t.Errorf("sent back with %+v, want %s by file ID", calls, tt.wantMethod)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	uploadTTL = 30 * time.Minute
+
+	pickPrefix = "pick"
+	pickCancel = "x"
+)
+
+// pendingUpload holds files whose subject has to be picked by the student
+type pendingUpload struct {
+	userID    string
+	chatID    int64
+	files     []homeworkFile
+	options   []lessonOption
+	createdAt time.Time
+}
+
+// askSubject keeps the files until the student picks one of the options from an inline
+// keyboard
+func (h *Handler) askSubject(message *tgbotapi.Message, files []homeworkFile, options []lessonOption, prompt string) {
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	h.uploadsLock.Lock()
+	h.cleanupPendingUploads()
+	token, err := newToken()
+	if err != nil {
+		h.uploadsLock.Unlock()
+		logger.Error("Error generating upload token: %v", err)
+		h.sendMessage(message.Chat.ID, "Ошибка обработки домашки, попробуйте позже")
+		return
+	}
+	h.pendingUploads[token] = &pendingUpload{
+		userID:    userID,
+		chatID:    message.Chat.ID,
+		files:     files,
+		options:   options,
+		createdAt: time.Now(),
+	}
+	h.uploadsLock.Unlock()
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, option := range options {
+		label := fmt.Sprintf("%s (%s)", option.subject, formatDate(option.date))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, pickData(token, strconv.Itoa(i)))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", pickData(token, pickCancel))))
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, prompt)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Error sending subject picker: %v", err)
+	}
+}
+
+// askSubjectForUncaptioned offers the subjects of the next school day for files sent
+// without a caption
+func (h *Handler) askSubjectForUncaptioned(ctx context.Context, message *tgbotapi.Message, files []homeworkFile) {
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка обработки домашки, попробуйте позже")
+		return
+	}
+
+	upcoming, err := h.upcomingLessons(ctx, user)
+	if err != nil {
+		logger.Error("Error getting schedule for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка обработки домашки, попробуйте позже")
+		return
+	}
+
+	// Lessons of the nearest school day come first and alone, if there are any
+	options := upcoming
+	for i, lesson := range upcoming {
+		if lesson.date != upcoming[0].date {
+			options = upcoming[:i]
+			break
+		}
+	}
+
+	if len(options) == 0 {
+		h.sendMessage(message.Chat.ID, "В расписании на ближайшую неделю нет уроков. Добавьте их командой /setschedule")
+		return
+	}
+
+	h.askSubject(message, files, options, "К какому предмету это домашнее задание?")
+}
+
+// HandleCallback handles presses of inline keyboard buttons
+func (h *Handler) HandleCallback(query *tgbotapi.CallbackQuery) {
+	prefix, data, _ := strings.Cut(query.Data, ":")
+	switch prefix {
+	case pickPrefix:
+		h.handlePickSubject(query, data)
+	case reviewPrefix:
+		h.handleReviewCallback(query, data)
+	case uploadPrefix:
+		h.handleUploadCallback(query, data)
+	case linkPrefix:
+		h.handleLinkCallback(query, data)
+	case studentsPrefix:
+		h.handleStudentsCallback(query, data)
+	case rolePrefix:
+		h.handleRoleCallback(query, data)
+	case adminPrefix:
+		h.handleAdminCallback(query, data)
+	default:
+		h.answerCallback(query, "")
+	}
+}
+
+func (h *Handler) handlePickSubject(query *tgbotapi.CallbackQuery, data string) {
+	token, choice, _ := strings.Cut(data, ":")
+	userID := fmt.Sprintf("%d", query.From.ID)
+
+	// The upload is used up only by a valid choice of its owner, so a stale or bad
+	// button keeps the files
+	h.uploadsLock.Lock()
+	pending, ok := h.pendingUploads[token]
+	if !ok || time.Since(pending.createdAt) > uploadTTL {
+		h.uploadsLock.Unlock()
+		h.answerCallback(query, "Выбор устарел, отправьте домашку еще раз")
+		return
+	}
+	if pending.userID != userID {
+		h.uploadsLock.Unlock()
+		h.answerCallback(query, "Это не ваша домашка")
+		return
+	}
+
+	var lesson lessonOption
+	if choice != pickCancel {
+		i, err := strconv.Atoi(choice)
+		if err != nil || i < 0 || i >= len(pending.options) {
+			h.uploadsLock.Unlock()
+			h.answerCallback(query, "Неизвестный вариант")
+			return
+		}
+		lesson = pending.options[i]
+	}
+	delete(h.pendingUploads, token)
+	h.uploadsLock.Unlock()
+
+	h.answerCallback(query, "")
+	if choice == pickCancel {
+		h.editCallbackMessage(query, "Загрузка отменена.")
+		return
+	}
+
+	h.editCallbackMessage(query, h.saveFiles(context.Background(), userID, lesson, pending.files))
+}
+
+func (h *Handler) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := h.bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		logger.Error("Error answering callback: %v", err)
+	}
+}
+
+// editCallbackMessage replaces the keyboard message with text
+func (h *Handler) editCallbackMessage(query *tgbotapi.CallbackQuery, text string) {
+	if query.Message == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	if _, err := h.bot.Send(edit); err != nil {
+		logger.Error("Error editing message: %v", err)
+	}
+}
+
+// cleanupPendingUploads drops uploads nobody picked a subject for. The caller holds uploadsLock.
+func (h *Handler) cleanupPendingUploads() {
+	for token, pending := range h.pendingUploads {
+		if time.Since(pending.createdAt) > uploadTTL {
+			delete(h.pendingUploads, token)
+		}
+	}
+}
+
+func pickData(token, choice string) string {
+	return pickPrefix + ":" + token + ":" + choice
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestHandlePickSubject(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int64
+		choice    string
+		wantKept  bool
+		wantSaved int
+	}{
+		{name: "subject", userID: 1, choice: "1", wantSaved: 1},
+		{name: "cancel", userID: 1, choice: pickCancel},
+		{name: "unknown option", userID: 1, choice: "5", wantKept: true},
+		{name: "not a number", userID: 1, choice: "abc", wantKept: true},
+		{name: "someone else", userID: 2, choice: "1", wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, _ := newTestHandler(t)
+			h.pendingUploads["token"] = &pendingUpload{
+				userID:    testStudentID,
+				chatID:    1,
+				files:     []homeworkFile{{mediaType: storage.MediaText, text: "№5"}},
+				options:   []lessonOption{{date: "2026-10-20", subject: "Алгебра"}, {date: "2026-10-20", subject: "Русский"}},
+				createdAt: time.Now(),
+			}
+
+			query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: tt.userID}, Message: textMessage(tt.userID, "")}
+			h.handlePickSubject(query, "token:"+tt.choice)
+
+			if _, kept := h.pendingUploads["token"]; kept != tt.wantKept {
+				t.Errorf("upload kept = %v, want %v", kept, tt.wantKept)
+			}
+			homeworks, err := db.GetHomeworkUploadedSince(ctx, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(homeworks) != tt.wantSaved {
+				t.Fatalf("saved %+v, want %d submissions", homeworks, tt.wantSaved)
+			}
+			if tt.wantSaved > 0 && homeworks[0].Subject != "Русский" {
+				t.Errorf("saved for %s, want Русский", homeworks[0].Subject)
+			}
+		})
+	}
+}
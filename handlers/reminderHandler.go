@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/blobstore"
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	uploadPrefix = "upload"
+	// uploadTargetTTL is how long photos without a caption go to the subject picked
+	// under a reminder
+	uploadTargetTTL = 15 * time.Minute
+)
+
+// uploadTarget is the lesson uncaptioned photos are saved to after a reminder button
+type uploadTarget struct {
+	lesson    lessonOption
+	createdAt time.Time
+}
+
+// reminderTimes returns the student's reminder times, or nil when reminders are off
+func reminderTimes(user storage.User) []string {
+	if user.RemindersOff {
+		return nil
+	}
+	if len(user.ReminderTimes) == 0 {
+		return storage.DefaultReminderTimes
+	}
+	return user.ReminderTimes
+}
+
+// reminderTimezone is the time zone of the student's reminders: their own, or else
+// the zone of a linked parent. Empty means the server's zone.
+func reminderTimezone(student storage.User, parents []storage.User) string {
+	if student.Timezone != "" {
+		return student.Timezone
+	}
+	for _, parent := range parents {
+		if parent.Timezone != "" {
+			return parent.Timezone
+		}
+	}
+	return ""
+}
+
+// reminderClocks returns the reminder times of today and tomorrow in loc, in order
+func reminderClocks(times []string, loc *time.Location, now time.Time) []time.Time {
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	var clocks []time.Time
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, 1)} {
+		for _, clock := range times {
+			if offset, ok := clockOffset(clock); ok {
+				clocks = append(clocks, day.Add(offset))
+			}
+		}
+	}
+	sort.Slice(clocks, func(i, j int) bool { return clocks[i].Before(clocks[j]) })
+	return clocks
+}
+
+// nextReminder returns the first reminder time after now, or zero when there is none
+func nextReminder(times []string, loc *time.Location, now time.Time) time.Time {
+	for _, at := range reminderClocks(times, loc, now) {
+		if at.After(now) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// lastReminder returns today's last reminder time at or before now, or zero when
+// there is none yet
+func lastReminder(times []string, loc *time.Location, now time.Time) time.Time {
+	var last time.Time
+	for _, at := range reminderClocks(times, loc, now) {
+		if !at.After(now) {
+			last = at
+		}
+	}
+	return last
+}
+
+// SendDueReminders reminds every student whose reminder time has passed about
+// tomorrow's subjects that still have no submission, and works out their next one
+func (h *Handler) SendDueReminders(now time.Time) error {
+	ctx := context.Background()
+
+	students, err := h.db.GetRemindersDue(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to find students: %w", err)
+	}
+
+	for _, student := range students {
+		parents, err := h.parentsOf(ctx, &student)
+		if err != nil {
+			logger.Error("Error getting parents of %s: %v", student.UserID, err)
+		}
+		student.Timezone = reminderTimezone(student, parents)
+		loc := userLocation(student)
+
+		// The next reminder is stored first, so a crash cannot send this one twice
+		times := reminderTimes(student)
+		if err := h.db.SetNextReminder(ctx, student.UserID, nextReminder(times, loc, now)); err != nil {
+			logger.Error("Error setting next reminder of student %s: %v", student.UserID, err)
+			continue
+		}
+
+		// Reminders missed on earlier days, e.g. while the bot was down, are stale,
+		// only one of today's still goes out
+		due := student.NextReminderAt
+		if last := lastReminder(times, loc, now); due.IsZero() || last.IsZero() || last.Before(due) {
+			continue
+		}
+		h.sendReminder(ctx, student, now.In(loc))
+	}
+
+	return nil
+}
+
+// resetReminders has the next reminders of the students worked out again, e.g. after
+// the time zone they fall back to changed
+func (h *Handler) resetReminders(ctx context.Context, students []storage.User) {
+	for _, student := range students {
+		if err := h.db.SetNextReminder(ctx, student.UserID, time.Time{}); err != nil {
+			logger.Error("Error resetting reminders of student %s: %v", student.UserID, err)
+		}
+	}
+}
+
+// subjectKey is a short stand-in for a subject name in callback data, which is
+// limited to 64 bytes
+func subjectKey(name string) string {
+	return blobstore.Checksum([]byte(name))[:8]
+}
+
+func (h *Handler) sendReminder(ctx context.Context, student storage.User, local time.Time) {
+	nextDate := storage.DateKey(local.AddDate(0, 0, 1))
+	if _, off := storage.CalendarOf(&student).DayOff(nextDate); off {
+		return
+	}
+	_, incomplete, _, err := h.db.GetHomeworkStatus(ctx, student.UserID, nextDate)
+	if err != nil {
+		logger.Error("Error getting homework status for student %s: %v", student.UserID, err)
+		return
+	}
+	// Everything is submitted, nothing to remind about
+	if len(incomplete) == 0 {
+		return
+	}
+
+	studentID, err := strconv.ParseInt(student.UserID, 10, 64)
+	if err != nil {
+		logger.Error("Error converting student ID: %v", err)
+		return
+	}
+
+	// Buttons name the subject by key, so timetable edits before the tap can't
+	// change which subject it means
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, name := range incomplete {
+		data := fmt.Sprintf("%s:%s:%s", uploadPrefix, nextDate, subjectKey(name))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📷 "+name, data)))
+	}
+
+	text := fmt.Sprintf("⏰ Еще нет домашки на %s:\n", formatDate(nextDate))
+	for _, name := range incomplete {
+		text += "- " + name + "\n"
+	}
+	text += "\nНажмите на предмет и отправьте фото."
+
+	msg := tgbotapi.NewMessage(studentID, text)
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Error sending reminder to student %s: %v", student.UserID, err)
+	}
+}
+
+// handleUploadCallback makes the next uncaptioned photos go to the tapped subject
+func (h *Handler) handleUploadCallback(query *tgbotapi.CallbackQuery, data string) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", query.From.ID)
+
+	date, key, _ := strings.Cut(data, ":")
+	day, err := h.db.GetLessonsForDate(ctx, userID, date)
+	if err != nil {
+		logger.Error("Error getting lessons %s for user %s: %v", date, userID, err)
+		h.answerCallback(query, "Урок не найден, отправьте фото с подписью")
+		return
+	}
+
+	var lesson lessonOption
+	for _, subject := range day.Subjects {
+		if subjectKey(subject.SubjectName) == key {
+			lesson = lessonOption{date: date, subject: subject.SubjectName}
+			break
+		}
+	}
+	if lesson.subject == "" {
+		h.answerCallback(query, "Этого урока больше нет в расписании, отправьте фото с подписью")
+		return
+	}
+
+	h.uploadsLock.Lock()
+	h.uploadTargets[userID] = uploadTarget{lesson: lesson, createdAt: time.Now()}
+	h.uploadsLock.Unlock()
+
+	h.answerCallback(query, "")
+	if query.Message != nil {
+		h.sendMessage(query.Message.Chat.ID, fmt.Sprintf("Отправьте фото, файл, голосовое или ответ текстом по %s на %s, подпись не нужна.", lesson.subject, formatDate(lesson.date)))
+	}
+}
+
+// uploadTarget returns the lesson picked under a reminder, if it is still fresh
+func (h *Handler) uploadTarget(userID string) (lessonOption, bool) {
+	h.uploadsLock.Lock()
+	defer h.uploadsLock.Unlock()
+
+	target, ok := h.uploadTargets[userID]
+	if !ok || time.Since(target.createdAt) > uploadTargetTTL {
+		delete(h.uploadTargets, userID)
+		return lessonOption{}, false
+	}
+	return target.lesson, true
+}
+
+// handleReminders shows or changes the student's reminder times and time zone:
+// /reminders 18:00 20:00 Europe/Moscow, or /reminders off
+func (h *Handler) handleReminders(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка получения данных. Попробуйте позже")
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		h.sendMessage(message.Chat.ID, h.formatReminders(ctx, *user)+"\n\n"+
+			"Использование: /reminders <ЧЧ:ММ> [ЧЧ:ММ ...] [часовой пояс]\n"+
+			"Пример: /reminders 18:00 20:00 Europe/Moscow\nОтключить: /reminders off")
+		return
+	}
+
+	var times []string
+	off := false
+	timezone := user.Timezone
+	for _, arg := range args {
+		if strings.EqualFold(arg, "off") || strings.EqualFold(arg, "нет") {
+			off = true
+			continue
+		}
+		if t, err := time.Parse(storage.TimeLayout, arg); err == nil {
+			times = append(times, t.Format(storage.TimeLayout))
+			continue
+		}
+		if _, err := time.LoadLocation(arg); err == nil && arg != "Local" {
+			timezone = arg
+			continue
+		}
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Не понимаю %q. Укажите время как 18:00 и часовой пояс как Europe/Moscow", arg))
+		return
+	}
+	if off && len(times) > 0 {
+		h.sendMessage(message.Chat.ID, "Укажите время напоминаний или off, но не то и другое сразу")
+		return
+	}
+	// Only a time zone was given, the times stay as they were
+	if !off && len(times) == 0 {
+		times, off = user.ReminderTimes, user.RemindersOff
+	}
+
+	if err := h.db.SetReminders(ctx, userID, times, off, timezone); err != nil {
+		logger.Error("Error setting reminders for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить настройки. Попробуйте позже")
+		return
+	}
+
+	user.ReminderTimes, user.RemindersOff, user.Timezone = times, off, timezone
+	h.sendMessage(message.Chat.ID, h.formatReminders(ctx, *user))
+}
+
+// formatReminders describes when the student is reminded and in which time zone
+func (h *Handler) formatReminders(ctx context.Context, student storage.User) string {
+	times := reminderTimes(student)
+	if len(times) == 0 {
+		return "Напоминания о домашке отключены."
+	}
+
+	zone := student.Timezone
+	if zone == "" {
+		parents, err := h.parentsOf(ctx, &student)
+		if err != nil {
+			logger.Error("Error getting parents of %s: %v", student.UserID, err)
+		}
+		if zone = reminderTimezone(student, parents); zone != "" {
+			zone += ", как у родителя"
+		}
+	}
+	if zone == "" {
+		zone = "время сервера"
+	}
+	return fmt.Sprintf("Напоминания о несданной домашке приходят в %s (%s).", strings.Join(times, ", "), zone)
+}
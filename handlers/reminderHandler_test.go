@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestHandleReminders(t *testing.T) {
+	tests := []struct {
+		name           string
+		parentTimezone string
+		args           []string
+		want           string
+	}{
+		{name: "defaults", args: []string{""}, want: "Напоминания о несданной домашке приходят в 18:00, 20:00 (время сервера).\n\nИспользование"},
+		{name: "parent's zone", parentTimezone: "Asia/Yekaterinburg", args: []string{"19:00"},
+			want: "Напоминания о несданной домашке приходят в 19:00 (Asia/Yekaterinburg, как у родителя)."},
+		{name: "own zone", parentTimezone: "Asia/Yekaterinburg", args: []string{"19:00 Europe/Moscow"},
+			want: "Напоминания о несданной домашке приходят в 19:00 (Europe/Moscow)."},
+		{name: "zone only keeps the times", args: []string{"17:30 21:00", "Europe/Kaliningrad"},
+			want: "Напоминания о несданной домашке приходят в 17:30, 21:00 (Europe/Kaliningrad)."},
+		{name: "off", args: []string{"off"}, want: "Напоминания о домашке отключены."},
+		{name: "bad argument", args: []string{"Moscow"}, want: "Не понимаю \"Moscow\". Укажите время как 18:00 и часовой пояс как Europe/Moscow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, db, telegram := newTestHandler(t)
+			if tt.parentTimezone != "" {
+				if err := db.SetSummarySchedule(context.Background(), testParentID, "", tt.parentTimezone); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, args := range tt.args {
+				h.handleReminders(commandMessage(1, "/reminders "+args))
+			}
+
+			sent := telegram.messages()
+			if len(sent) != len(tt.args) || !strings.HasPrefix(sent[len(sent)-1], tt.want) {
+				t.Errorf("sent %q, want the last message to start with %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminderTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		student string
+		parents []string
+		want    string
+	}{
+		{name: "own zone", student: "Europe/Moscow", parents: []string{"Asia/Omsk"}, want: "Europe/Moscow"},
+		{name: "parent's zone", parents: []string{"", "Asia/Omsk"}, want: "Asia/Omsk"},
+		{name: "no zone", parents: []string{""}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parents []storage.User
+			for _, zone := range tt.parents {
+				parents = append(parents, storage.User{Timezone: zone})
+			}
+			if got := reminderTimezone(storage.User{Timezone: tt.student}, parents); got != tt.want {
+				t.Errorf("reminderTimezone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendDueReminders(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reminders are due at 18:00 on Monday for Tuesday's lessons
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, moscow) }
+
+	tests := []struct {
+		name     string
+		checks   []time.Time
+		wantSent int
+		wantNext time.Time
+	}{
+		{name: "first check works out the time", checks: []time.Time{at(19, 17, 0)}, wantNext: at(19, 18, 0)},
+		{name: "due", checks: []time.Time{at(19, 17, 0), at(19, 18, 0)}, wantSent: 1, wantNext: at(20, 18, 0)},
+		{name: "sent once", checks: []time.Time{at(19, 17, 0), at(19, 18, 0), at(19, 18, 1)}, wantSent: 1, wantNext: at(20, 18, 0)},
+		{name: "late after a restart", checks: []time.Time{at(19, 17, 0), at(19, 23, 30)}, wantSent: 1, wantNext: at(20, 18, 0)},
+		{name: "missed day", checks: []time.Time{at(18, 17, 0), at(19, 18, 30)}, wantSent: 1, wantNext: at(20, 18, 0)},
+		{name: "stale before today's time", checks: []time.Time{at(18, 17, 0), at(19, 9, 0)}, wantNext: at(19, 18, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			if err := db.SetReminders(ctx, testStudentID, []string{"18:00"}, false, "Europe/Moscow"); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, now := range tt.checks {
+				if err := h.SendDueReminders(now); err != nil {
+					t.Fatalf("SendDueReminders() error = %v", err)
+				}
+			}
+
+			if sent := telegram.messages(); len(sent) != tt.wantSent {
+				t.Errorf("sent %q, want %d reminders", sent, tt.wantSent)
+			}
+			student, err := db.GetUser(ctx, testStudentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !student.NextReminderAt.Equal(tt.wantNext) {
+				t.Errorf("NextReminderAt = %v, want %v", student.NextReminderAt, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestHandleUploadCallback(t *testing.T) {
+	const date = "2026-10-20"
+	tests := []struct {
+		name        string
+		subjects    []string
+		wantSubject string
+	}{
+		{name: "unchanged timetable", subjects: []string{"Алгебра", "Русский"}, wantSubject: "Русский"},
+		{name: "lessons moved", subjects: []string{"Физика", "Алгебра", "Русский"}, wantSubject: "Русский"},
+		{name: "lesson removed", subjects: []string{"Алгебра"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, _ := newTestHandler(t)
+
+			// The timetable changes after the reminder with a Русский button went out
+			day := storage.DaySchedule{DayName: time.Tuesday.String()}
+			for _, name := range tt.subjects {
+				day.Subjects = append(day.Subjects, storage.Subject{SubjectName: name})
+			}
+			if err := db.SetDaySchedule(ctx, testStudentID, day); err != nil {
+				t.Fatal(err)
+			}
+
+			query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: 1}, Message: textMessage(1, "")}
+			h.handleUploadCallback(query, date+":"+subjectKey("Русский"))
+
+			lesson, ok := h.uploadTarget(testStudentID)
+			if ok != (tt.wantSubject != "") || lesson.subject != tt.wantSubject {
+				t.Errorf("uploadTarget() = %+v, %v, want %q", lesson, ok, tt.wantSubject)
+			}
+		})
+	}
+}
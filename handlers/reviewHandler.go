@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	reviewPrefix  = "review"
+	reviewApprove = "ok"
+	reviewReject  = "redo"
+
+	commentTTL = 30 * time.Minute
+	// noComment rejects a submission without a comment
+	noComment = "-"
+)
+
+// pendingComment is a rejection waiting for the parent's comment
+type pendingComment struct {
+	homeworkID string
+	chatID     int64
+	messageID  int
+	caption    string
+	// inText is set when the buttons came in a text message, as for video notes
+	inText    bool
+	createdAt time.Time
+}
+
+func reviewKeyboard(homeworkID string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Принять", reviewPrefix+":"+homeworkID+":"+reviewApprove),
+		tgbotapi.NewInlineKeyboardButtonData("❗ На доработку", reviewPrefix+":"+homeworkID+":"+reviewReject),
+	))
+}
+
+// awaitsReview reports whether nobody has reviewed the submission yet
+func awaitsReview(review storage.Review) bool {
+	return review.Status == "" || review.Status == storage.StatusSubmitted
+}
+
+// reviewCaption describes a finished review for a photo caption
+func reviewCaption(review storage.Review) string {
+	switch review.Status {
+	case storage.StatusApproved:
+		return "\n✅ Принято"
+	case storage.StatusRejected:
+		if review.Comment == "" {
+			return "\n❗ На доработку"
+		}
+		return "\n❗ На доработку: " + review.Comment
+	}
+	return ""
+}
+
+func (h *Handler) handleReviewCallback(query *tgbotapi.CallbackQuery, data string) {
+	ctx := context.Background()
+	homeworkID, action, _ := strings.Cut(data, ":")
+	reviewerID := fmt.Sprintf("%d", query.From.ID)
+
+	homework, err := h.reviewableHomework(ctx, reviewerID, homeworkID)
+	if err != nil {
+		logger.Error("Error reviewing homework %s by %s: %v", homeworkID, reviewerID, err)
+		h.answerCallback(query, "Проверять домашку могут только родители ученика")
+		return
+	}
+
+	caption, inText := "", false
+	if query.Message != nil {
+		caption = query.Message.Caption
+		if query.Message.Text != "" {
+			caption, inText = query.Message.Text, true
+		}
+	}
+
+	switch action {
+	case reviewApprove:
+		if err := h.db.ReviewHomework(ctx, homework.ID, storage.StatusApproved, reviewerID, ""); err != nil {
+			logger.Error("Error approving homework %s: %v", homework.ID, err)
+			h.answerCallback(query, "Не удалось сохранить, попробуйте позже")
+			return
+		}
+		h.answerCallback(query, "Принято")
+		h.editReviewCaption(query, inText, caption+reviewCaption(storage.Review{Status: storage.StatusApproved}))
+	case reviewReject:
+		if query.Message == nil {
+			h.answerCallback(query, "")
+			return
+		}
+		h.commentsLock.Lock()
+		h.pendingComments[reviewerID] = pendingComment{
+			homeworkID: homework.ID,
+			chatID:     query.Message.Chat.ID,
+			messageID:  query.Message.MessageID,
+			caption:    caption,
+			inText:     inText,
+			createdAt:  time.Now(),
+		}
+		h.commentsLock.Unlock()
+
+		h.answerCallback(query, "")
+		h.sendMessage(query.Message.Chat.ID, fmt.Sprintf("Напишите одним сообщением, что нужно исправить по %s. "+
+			"Отправьте «%s», чтобы вернуть без комментария.", homework.Subject, noComment))
+	default:
+		h.answerCallback(query, "")
+	}
+}
+
+// HandleText handles plain text messages: a student name or rejection comment the
+// sender owes, or else a text answer
+func (h *Handler) HandleText(message *tgbotapi.Message) {
+	reviewerID := fmt.Sprintf("%d", message.From.ID)
+
+	if rename, ok := h.takePendingRename(reviewerID); ok {
+		h.renameStudent(message, rename)
+		return
+	}
+
+	h.commentsLock.Lock()
+	pending, ok := h.pendingComments[reviewerID]
+	delete(h.pendingComments, reviewerID)
+	h.commentsLock.Unlock()
+
+	if !ok || time.Since(pending.createdAt) > commentTTL {
+		h.handleTextAnswer(message)
+		return
+	}
+
+	comment := strings.TrimSpace(message.Text)
+	if comment == noComment {
+		comment = ""
+	}
+	h.rejectHomework(pending, reviewerID, comment)
+}
+
+func (h *Handler) rejectHomework(pending pendingComment, reviewerID, comment string) {
+	ctx := context.Background()
+
+	homework, err := h.reviewableHomework(ctx, reviewerID, pending.homeworkID)
+	if err != nil {
+		logger.Error("Error rejecting homework %s by %s: %v", pending.homeworkID, reviewerID, err)
+		h.sendMessage(pending.chatID, "Не удалось вернуть домашку, попробуйте позже")
+		return
+	}
+
+	if err := h.db.ReviewHomework(ctx, homework.ID, storage.StatusRejected, reviewerID, comment); err != nil {
+		logger.Error("Error rejecting homework %s: %v", homework.ID, err)
+		h.sendMessage(pending.chatID, "Не удалось вернуть домашку, попробуйте позже")
+		return
+	}
+
+	review := storage.Review{Status: storage.StatusRejected, Comment: comment}
+	edit := reviewEdit(pending.chatID, pending.messageID, pending.inText, pending.caption+reviewCaption(review))
+	if _, err := h.bot.Send(edit); err != nil {
+		logger.Error("Error editing message: %v", err)
+	}
+
+	studentID, err := strconv.ParseInt(homework.StudentID, 10, 64)
+	if err != nil {
+		logger.Error("Error converting student ID: %v", err)
+		return
+	}
+
+	text := fmt.Sprintf("❗ Домашку по %s на %s нужно переделать.", homework.Subject, formatDate(homework.Date))
+	if comment != "" {
+		text += "\nКомментарий: " + comment
+	}
+	text += fmt.Sprintf("\nОтправьте исправленную домашку с подписью «%s».", homework.Subject)
+	h.sendMessage(studentID, text)
+	h.sendMessage(pending.chatID, "Домашка возвращена ученику на доработку.")
+}
+
+// reviewableHomework returns the submission if the reviewer is a parent of its student
+func (h *Handler) reviewableHomework(ctx context.Context, reviewerID, homeworkID string) (*storage.Homework, error) {
+	homework, err := h.db.GetHomework(ctx, homeworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewer, err := h.db.GetUser(ctx, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	student, err := h.db.GetUser(ctx, homework.StudentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isLinkedParent(reviewer, student) {
+		return nil, fmt.Errorf("user %s is not a parent of %s", reviewerID, homework.StudentID)
+	}
+	return homework, nil
+}
+
+func (h *Handler) editReviewCaption(query *tgbotapi.CallbackQuery, inText bool, caption string) {
+	if query.Message == nil {
+		return
+	}
+	edit := reviewEdit(query.Message.Chat.ID, query.Message.MessageID, inText, caption)
+	if _, err := h.bot.Send(edit); err != nil {
+		logger.Error("Error editing message: %v", err)
+	}
+}
+
+// reviewEdit replaces the caption of a reviewed submission, or the text of the message
+// with its buttons when the submission can't have a caption
+func reviewEdit(chatID int64, messageID int, inText bool, text string) tgbotapi.Chattable {
+	if inText {
+		return tgbotapi.NewEditMessageText(chatID, messageID, text)
+	}
+	return tgbotapi.NewEditMessageCaption(chatID, messageID, text)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestHandleReviewCallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		reviewerID int64
+		action     string
+		// comment is the parent's reply after asking for a redo
+		comment     string
+		wantStatus  string
+		wantComment string
+		wantEdit    string
+	}{
+		{name: "approve", reviewerID: 2, action: reviewApprove, wantStatus: storage.StatusApproved, wantEdit: "✅ Принято"},
+		{name: "reject with comment", reviewerID: 2, action: reviewReject, comment: "Перепиши №5",
+			wantStatus: storage.StatusRejected, wantComment: "Перепиши №5", wantEdit: "❗ На доработку: Перепиши №5"},
+		{name: "reject without comment", reviewerID: 2, action: reviewReject, comment: noComment,
+			wantStatus: storage.StatusRejected, wantEdit: "❗ На доработку"},
+		{name: "not a parent", reviewerID: 1, action: reviewApprove, wantStatus: storage.StatusSubmitted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			homeworkID, err := db.SaveHomework(ctx, testStudentID, "2026-10-20", "Алгебра", storage.Content{Type: storage.MediaText, Text: "№5"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Submissions without a caption get their buttons in a text message
+			query := &tgbotapi.CallbackQuery{
+				ID:      "1",
+				From:    &tgbotapi.User{ID: tt.reviewerID},
+				Message: textMessage(tt.reviewerID, "Алгебра"),
+			}
+			h.handleReviewCallback(query, homeworkID+":"+tt.action)
+			if tt.comment != "" {
+				h.HandleText(textMessage(tt.reviewerID, tt.comment))
+			}
+
+			homework, err := db.GetHomework(ctx, homeworkID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if homework.Review.Status != tt.wantStatus || homework.Review.Comment != tt.wantComment {
+				t.Errorf("review = %q, %q, want %q, %q", homework.Review.Status, homework.Review.Comment, tt.wantStatus, tt.wantComment)
+			}
+
+			edits := telegram.edits()
+			if tt.wantEdit == "" && len(edits) > 0 {
+				t.Errorf("edited to %q, want no edit", edits)
+			}
+			if tt.wantEdit != "" && (len(edits) != 1 || !strings.HasSuffix(edits[0], tt.wantEdit)) {
+				t.Errorf("edited to %q, want %q", edits, tt.wantEdit)
+			}
+		})
+	}
+}
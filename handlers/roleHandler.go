@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const rolePrefix = "role"
+
+var roleTitles = map[string]string{
+	storage.RoleStudent: "Ученик",
+	storage.RoleParent:  "Родитель",
+	storage.RoleTutor:   "Репетитор",
+	storage.RoleAdmin:   "Администратор",
+}
+
+// selectableRoles are the roles users pick themselves
+var selectableRoles = []string{storage.RoleStudent, storage.RoleParent, storage.RoleTutor}
+
+// commandRoles limits commands to some roles. Commands not listed here are open to
+// everyone who has picked a role, except adminCommands, which only admins may use
+// whatever their role.
+var commandRoles = map[string][]string{
+	"schedule":   {storage.RoleStudent},
+	"invite":     {storage.RoleStudent},
+	"reminders":  {storage.RoleStudent},
+	"alias":      {storage.RoleStudent},
+	"unalias":    {storage.RoleStudent},
+	"addstudent": storage.SupervisorRoles,
+	"checkhw":    storage.SupervisorRoles,
+	"mystudents": storage.SupervisorRoles,
+}
+
+// onboardingCommands work before the user has picked a role
+var onboardingCommands = map[string]bool{
+	"start": true,
+	"help":  true,
+	"role":  true,
+}
+
+func roleTitle(role string) string {
+	if title, ok := roleTitles[role]; ok {
+		return title
+	}
+	return role
+}
+
+func roleKeyboard() tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, role := range selectableRoles {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(roleTitle(role), rolePrefix+":"+role))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+func (h *Handler) askRole(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = roleKeyboard()
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Error sending message: %v", err)
+	}
+}
+
+// checkRole tells the user when their role may not use the command
+func (h *Handler) checkRole(message *tgbotapi.Message, user *storage.User, command string) bool {
+	if isAdminCommand(command) {
+		if h.isAdmin(user) {
+			return true
+		}
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Команда /%s доступна только администраторам.", command))
+		return false
+	}
+
+	if user.Role == "" {
+		if onboardingCommands[command] {
+			return true
+		}
+		h.askRole(message.Chat.ID, "Сначала выберите, кто вы:")
+		return false
+	}
+
+	roles, limited := commandRoles[command]
+	if !limited || slices.Contains(roles, user.Role) {
+		return true
+	}
+
+	titles := make([]string, len(roles))
+	for i, role := range roles {
+		titles[i] = strings.ToLower(roleTitle(role))
+	}
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("Команда /%s доступна только для ролей: %s. Ваша роль: %s, сменить — /role",
+		command, strings.Join(titles, ", "), strings.ToLower(roleTitle(user.Role))))
+	return false
+}
+
+// checkUploader tells the user when they may not submit homework
+func (h *Handler) checkUploader(message *tgbotapi.Message, user *storage.User) bool {
+	switch user.Role {
+	case storage.RoleStudent:
+		return true
+	case "":
+		h.askRole(message.Chat.ID, "Сначала выберите, кто вы:")
+	default:
+		h.sendMessage(message.Chat.ID, "Загружать домашку могут только ученики. Проверить домашку ваших учеников: /checkhw")
+	}
+	return false
+}
+
+// handleRole shows the sender's role with buttons to change it
+func (h *Handler) handleRole(message *tgbotapi.Message, user *storage.User) {
+	if user.Role == "" {
+		h.askRole(message.Chat.ID, "Выберите, кто вы:")
+		return
+	}
+	h.askRole(message.Chat.ID, fmt.Sprintf("Ваша роль: %s. Выберите новую:", strings.ToLower(roleTitle(user.Role))))
+}
+
+func (h *Handler) handleRoleCallback(query *tgbotapi.CallbackQuery, role string) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", query.From.ID)
+
+	if !slices.Contains(selectableRoles, role) {
+		h.answerCallback(query, "Неизвестная роль")
+		return
+	}
+
+	user, err := h.ensureUserInitialized(ctx, userID, query.From.UserName)
+	if err != nil {
+		logger.Error("Error initializing user %s: %v", userID, err)
+		h.answerCallback(query, "Ошибка, попробуйте позже")
+		return
+	}
+
+	if err := h.setRole(ctx, userID, role); err != nil {
+		logger.Error("Error setting role of user %s: %v", userID, err)
+		h.answerCallback(query, "Не удалось сохранить роль, попробуйте позже")
+		return
+	}
+
+	h.answerCallback(query, "")
+	h.editCallbackMessage(query, "Ваша роль: "+strings.ToLower(roleTitle(role)))
+	user.Role = role
+	h.sendWelcome(ctx, query.From.ID, user)
+}
+
+// setRole saves the role; students get an empty timetable if they have none. A user
+// who is no longer a parent or tutor loses their students, who are told about it.
+func (h *Handler) setRole(ctx context.Context, userID, role string) error {
+	if err := h.db.SetRole(ctx, userID, role); err != nil {
+		return err
+	}
+	if !storage.IsSupervisor(role) {
+		if err := h.unlinkAllStudents(ctx, userID); err != nil {
+			return err
+		}
+	}
+	if role == storage.RoleStudent {
+		return h.db.InitializeSchedule(ctx, userID)
+	}
+	return nil
+}
+
+// unlinkAllStudents drops every student linked to the user and tells each of them
+func (h *Handler) unlinkAllStudents(ctx context.Context, userID string) error {
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, studentID := range user.StudentIDs {
+		if err := h.db.RemoveStudentContact(ctx, userID, studentID); err != nil {
+			return fmt.Errorf("failed to unlink student %s: %w", studentID, err)
+		}
+		if id, err := strconv.ParseInt(studentID, 10, 64); err == nil {
+			h.sendMessage(id, fmt.Sprintf("%s больше не получает вашу домашку.", displayName(user)))
+		}
+	}
+	return nil
+}
+
+// sendWelcome explains what the bot does for the role
+func (h *Handler) sendWelcome(ctx context.Context, chatID int64, user *storage.User) {
+	var text string
+	if user.Role == storage.RoleStudent {
+		text = fmt.Sprintf("Добро пожаловать в Бота для домашних заданий!\n\n"+
+			"Чтобы отправить домашку к ближайшему уроку (начиная с завтра, %s):\n"+
+			"Отправьте снимки с названием предмета в подписи\n"+
+			"Пример: 'Математика'\n\n"+
+			"Чтобы родитель видел вашу домашку, отправьте ему ссылку из /invite.\n\n"+
+			"Расписание сначала пустое: заполните его командами /setschedule и /addlesson "+
+			"или выберите шаблон через /template.\n\n"+
+			"Используйте /help, чтобы увидеть все доступные команды.", formatDate(h.nextDate(ctx, user)))
+	} else {
+		text = "Добро пожаловать в Бота для домашних заданий!\n\n" +
+			"1. Добавьте ученика командой /addstudent или попросите его отправить вам ссылку из /invite. Ученик должен подтвердить связь.\n" +
+			"2. Проверяйте статус домашнего задания командой /checkhw, ежедневная сводка придет сама (время — /summarytime).\n" +
+			"3. Расписание и календарь ученика можно менять, указав первым аргументом его @username, ID или имя из /mystudents, например /setschedule Маша Пн Алгебра.\n\n" +
+			"Используйте /help, чтобы увидеть все доступные команды."
+	}
+	h.sendMessage(chatID, text)
+}
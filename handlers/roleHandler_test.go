@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestCheckRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID string
+		admin  bool
+		// role replaces the user's role when set
+		role    string
+		command string
+		want    bool
+	}{
+		{name: "student command", userID: testStudentID, command: "schedule", want: true},
+		{name: "parent command by a student", userID: testStudentID, command: "checkhw", want: false},
+		{name: "admin command by a student", userID: testStudentID, command: "admin_stats", want: false},
+		{name: "admin command by an admin", userID: testStudentID, admin: true, command: "admin_stats", want: true},
+		{name: "admin keeps student commands", userID: testStudentID, admin: true, command: "schedule", want: true},
+		{name: "admin keeps parent commands", userID: testParentID, admin: true, command: "checkhw", want: true},
+		{name: "admin gets no other role's commands", userID: testParentID, admin: true, command: "schedule", want: false},
+		{name: "admin command by the admin role", userID: testParentID, role: storage.RoleAdmin, command: "admin_stats", want: true},
+		{name: "admin role gets common commands", userID: testParentID, role: storage.RoleAdmin, command: "unlink", want: true},
+		{name: "admin role gets no parent commands", userID: testParentID, role: storage.RoleAdmin, command: "checkhw", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, db, telegram := newTestHandler(t)
+			if tt.admin {
+				h.admins[tt.userID] = true
+			}
+			if tt.role != "" {
+				if err := db.SetRole(context.Background(), tt.userID, tt.role); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			user, err := h.ensureUserInitialized(context.Background(), tt.userID, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			message := textMessage(1, "/"+tt.command)
+			if got := h.checkRole(message, user, tt.command); got != tt.want {
+				t.Errorf("checkRole() = %v, want %v", got, tt.want)
+			}
+			if sent := telegram.messages(); tt.want == (len(sent) > 0) {
+				t.Errorf("sent %q", sent)
+			}
+		})
+	}
+}
+
+func TestAdminKeepsRole(t *testing.T) {
+	ctx := context.Background()
+	h, _, _ := newTestHandler(t)
+	h.admins[testParentID] = true
+
+	// The role an admin picks is kept, and they stay an admin
+	if err := h.setRole(ctx, testParentID, storage.RoleTutor); err != nil {
+		t.Fatal(err)
+	}
+	user, err := h.ensureUserInitialized(ctx, testParentID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != storage.RoleTutor || !h.isAdmin(user) {
+		t.Errorf("role = %q, admin = %v, want tutor and admin", user.Role, h.isAdmin(user))
+	}
+}
+
+func TestHandleAdminCallbackRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		senderID int64
+		action   string
+		wantRole string
+	}{
+		{name: "grant", senderID: 3, action: adminGrant, wantRole: storage.RoleAdmin},
+		{name: "revoke", senderID: 3, action: adminRevoke, wantRole: ""},
+		{name: "not an admin", senderID: 1, action: adminGrant, wantRole: storage.RoleParent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, _ := newTestHandler(t)
+			// The admin is one only by role
+			if err := db.CreateUser(ctx, "3", "admin"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetRole(ctx, "3", storage.RoleAdmin); err != nil {
+				t.Fatal(err)
+			}
+
+			query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: tt.senderID}, Message: textMessage(tt.senderID, "")}
+			h.handleAdminCallback(query, tt.action+":"+testParentID)
+
+			user, err := db.GetUser(ctx, testParentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", user.Role, tt.wantRole)
+			}
+			if h.isAdmin(user) != (tt.wantRole == storage.RoleAdmin) {
+				t.Errorf("isAdmin() = %v with role %q", h.isAdmin(user), user.Role)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"dashka-homework-bot/importer"
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var weekdayTitles = map[string]string{
+	"Monday":    "Понедельник",
+	"Tuesday":   "Вторник",
+	"Wednesday": "Среда",
+	"Thursday":  "Четверг",
+	"Friday":    "Пятница",
+	"Saturday":  "Суббота",
+	"Sunday":    "Воскресенье",
+}
+
+// parseDay converts a Russian or English weekday name to the stored DayName
+func parseDay(s string) (string, bool) {
+	day, ok := importer.ParseWeekday(s)
+	if !ok {
+		return "", false
+	}
+	return day.String(), true
+}
+
+func dayTitle(dayName string) string {
+	if title, ok := weekdayTitles[dayName]; ok {
+		return title
+	}
+	return dayName
+}
+
+// studentArgUsage explains the optional student argument of schedule and calendar commands
+const studentArgUsage = "\n[ученик] — @username, ID или имя из /mystudents; без него меняется ваше расписание"
+
+// resolveScheduleTarget returns whose schedule a command edits: the sender by default,
+// or a linked student when the arguments start with their @username, user ID or the
+// name the parent gave them. The remaining arguments are returned alongside.
+func (h *Handler) resolveScheduleTarget(ctx context.Context, fromID int64, args string) (*storage.User, string, error) {
+	args = strings.TrimSpace(args)
+	userID := fmt.Sprintf("%d", fromID)
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !strings.HasPrefix(args, "@") {
+		studentID, rest := matchLinkedStudent(user, args)
+		if studentID == "" {
+			return user, args, nil
+		}
+		student, err := h.db.GetUser(ctx, studentID)
+		return student, rest, err
+	}
+
+	fields := strings.SplitN(args, " ", 2)
+	rest := ""
+	if len(fields) == 2 {
+		rest = strings.TrimSpace(fields[1])
+	}
+
+	student, err := h.db.GetUserByUsername(ctx, fields[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !isLinkedParent(user, student) {
+		return nil, "", fmt.Errorf("user %s is not linked to %s", userID, fields[0])
+	}
+
+	return student, rest, nil
+}
+
+// matchLinkedStudent finds the linked student whose user ID or given name the
+// arguments start with and returns their ID with the rest of the arguments. The
+// longest name wins, so "Маша Большая" is not taken for "Маша".
+func matchLinkedStudent(parent *storage.User, args string) (string, string) {
+	words := strings.Fields(args)
+	var studentID string
+	matched := 0
+	for _, id := range parent.StudentIDs {
+		for _, name := range []string{id, parent.StudentNames[id]} {
+			nameWords := strings.Fields(name)
+			if len(nameWords) <= matched || len(nameWords) > len(words) {
+				continue
+			}
+			if wordsEqualFold(words[:len(nameWords)], nameWords) {
+				studentID, matched = id, len(nameWords)
+			}
+		}
+	}
+	return studentID, cutWords(args, matched)
+}
+
+func wordsEqualFold(a, b []string) bool {
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cutWords drops the first n words of s
+func cutWords(s string, n int) string {
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		s = s[end:]
+	}
+	return strings.TrimSpace(s)
+}
+
+func isLinkedParent(parent, student *storage.User) bool {
+	for _, id := range parent.StudentIDs {
+		if id == student.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) handleSetSchedule(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	dayArg, subjectsArg, _ := strings.Cut(args, " ")
+	if dayArg == "" {
+		h.sendMessage(message.Chat.ID, formatWeek(target.Schedule)+"\n"+
+			"Использование: /setschedule [ученик] <день> <предмет1>, <предмет2>, ...\n"+
+			"Пример: /setschedule Понедельник Алгебра, Русский, История"+studentArgUsage)
+		return
+	}
+
+	dayName, ok := parseDay(dayArg)
+	if !ok {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Не понимаю день недели %q. Пример: Понедельник или Пн", dayArg))
+		return
+	}
+
+	day := storage.DaySchedule{DayName: dayName, Subjects: []storage.Subject{}}
+	for _, name := range strings.Split(subjectsArg, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		day.Subjects = append(day.Subjects, storage.Subject{SubjectName: name})
+	}
+
+	if err := h.db.SetDaySchedule(ctx, target.UserID, day); err != nil {
+		logger.Error("Error setting schedule for user %s: %v", target.UserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить расписание. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, "Расписание обновлено:\n\n"+formatDay(day))
+}
+
+func (h *Handler) handleAddLesson(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	dayArg, subjectName, _ := strings.Cut(args, " ")
+	subjectName = strings.TrimSpace(subjectName)
+	dayName, ok := parseDay(dayArg)
+	if !ok || subjectName == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /addlesson [ученик] <день> <предмет>\nПример: /addlesson Среда Физика"+studentArgUsage)
+		return
+	}
+
+	day := findDay(target.Schedule, dayName)
+	day.Subjects = append(day.Subjects, storage.Subject{SubjectName: subjectName})
+
+	if err := h.db.SetDaySchedule(ctx, target.UserID, day); err != nil {
+		logger.Error("Error adding lesson for user %s: %v", target.UserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось добавить урок. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, "Урок добавлен:\n\n"+formatDay(day))
+}
+
+func (h *Handler) handleRemoveLesson(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	dayArg, subjectName, _ := strings.Cut(args, " ")
+	subjectName = strings.TrimSpace(subjectName)
+	dayName, ok := parseDay(dayArg)
+	if !ok || subjectName == "" {
+		h.sendMessage(message.Chat.ID, "Использование: /removelesson [ученик] <день> <предмет>\nПример: /removelesson Среда Физика"+studentArgUsage)
+		return
+	}
+
+	day := findDay(target.Schedule, dayName)
+	removed := false
+	for i, subject := range day.Subjects {
+		if strings.EqualFold(subject.SubjectName, subjectName) {
+			day.Subjects = append(day.Subjects[:i], day.Subjects[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	if !removed {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("В %s нет урока %q", dayTitle(dayName), subjectName))
+		return
+	}
+
+	if err := h.db.SetDaySchedule(ctx, target.UserID, day); err != nil {
+		logger.Error("Error removing lesson for user %s: %v", target.UserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось удалить урок. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, "Урок удален:\n\n"+formatDay(day))
+}
+
+func (h *Handler) handleTemplate(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, name, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	newSchedule, ok := storage.ScheduleTemplates[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(storage.ScheduleTemplates))
+		for templateName := range storage.ScheduleTemplates {
+			names = append(names, templateName)
+		}
+		sort.Strings(names)
+		h.sendMessage(message.Chat.ID, "Доступные шаблоны расписания: "+strings.Join(names, ", ")+
+			"\nИспользование: /template [ученик] <название>\nВнимание: текущее расписание будет заменено."+studentArgUsage)
+		return
+	}
+
+	schedule := newSchedule()
+	if err := h.db.SetSchedule(ctx, target.UserID, schedule); err != nil {
+		logger.Error("Error applying template for user %s: %v", target.UserID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось применить шаблон. Попробуйте позже")
+		return
+	}
+
+	h.sendMessage(message.Chat.ID, "Шаблон применен.\n\n"+formatWeek(schedule))
+}
+
+func (h *Handler) scheduleTargetOrReply(ctx context.Context, message *tgbotapi.Message) (*storage.User, string, bool) {
+	args := message.CommandArguments()
+	if !message.IsCommand() {
+		args = message.Caption
+	}
+	return h.targetOrReply(ctx, message, args)
+}
+
+// targetOrReply resolves whose schedule or calendar args refer to and explains to the
+// sender when they may not edit it
+func (h *Handler) targetOrReply(ctx context.Context, message *tgbotapi.Message, args string) (*storage.User, string, bool) {
+	target, args, err := h.resolveScheduleTarget(ctx, message.From.ID, args)
+	if err != nil {
+		logger.Error("Error resolving schedule owner for %d: %v", message.From.ID, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendMessage(message.Chat.ID, "Ученик не найден. Он должен хотя бы раз написать боту.")
+		} else {
+			h.sendMessage(message.Chat.ID, "Вы можете менять только свое расписание или расписание добавленных учеников.")
+		}
+		return nil, "", false
+	}
+	// Only students have a timetable and a calendar
+	if target.Role != storage.RoleStudent {
+		h.sendMessage(message.Chat.ID, "Укажите ученика в начале команды или подписи к файлу: @username, ID или имя из /mystudents")
+		return nil, "", false
+	}
+	return target, args, true
+}
+
+// findDay returns a copy of the given day, or an empty day if it is not in the schedule
+func findDay(schedule []storage.DaySchedule, dayName string) storage.DaySchedule {
+	for _, day := range schedule {
+		if day.DayName == dayName {
+			return storage.DaySchedule{DayName: dayName, Subjects: append([]storage.Subject{}, day.Subjects...)}
+		}
+	}
+	return storage.DaySchedule{DayName: dayName, Subjects: []storage.Subject{}}
+}
+
+func formatDay(day storage.DaySchedule) string {
+	text := dayTitle(day.DayName) + ":\n"
+	if len(day.Subjects) == 0 {
+		return text + "  нет уроков\n"
+	}
+	for i, subject := range day.Subjects {
+		text += fmt.Sprintf("  %d. %s\n", i+1, subject.SubjectName)
+	}
+	return text
+}
+
+func formatWeek(schedule []storage.DaySchedule) string {
+	text := "📅 Расписание на неделю:\n\n"
+	for d := time.Monday; d <= time.Saturday; d++ {
+		text += formatDay(findDay(schedule, d.String()))
+	}
+	return text + formatDay(findDay(schedule, time.Sunday.String()))
+}
+
+// handleSchedule shows the lessons of tomorrow, or says why there are none
+func (h *Handler) handleSchedule(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка получения расписания. Попробуйте позже")
+		return
+	}
+
+	nextDate := h.nextDate(ctx, user)
+	if reason, off := storage.CalendarOf(user).DayOff(nextDate); off {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Завтра (%s) уроков нет: %s.", formatDate(nextDate), dayOffTitle(reason)))
+		return
+	}
+
+	schedule, err := h.db.GetLessonsForDate(ctx, userID, nextDate)
+	if err != nil {
+		logger.Error("Error getting schedule for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка получения расписания. Попробуйте позже")
+		return
+	}
+
+	scheduleText := fmt.Sprintf("Завтрашнее (%s) расписание:\n", formatDate(nextDate))
+	for i, subject := range schedule.Subjects {
+		scheduleText += fmt.Sprintf("%d. %s\n", i+1, formatLesson(subject.SubjectName, subject.Task))
+	}
+	if len(schedule.Subjects) == 0 {
+		scheduleText += "Уроков нет. Добавить их можно командой /setschedule"
+	}
+	h.sendMessage(message.Chat.ID, scheduleText)
+}
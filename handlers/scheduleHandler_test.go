@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+
+	"dashka-homework-bot/storage"
+)
+
+func TestMatchLinkedStudent(t *testing.T) {
+	parent := &storage.User{
+		StudentIDs:   []string{"10", "11", "12"},
+		StudentNames: map[string]string{"10": "Маша", "11": "Маша Большая"},
+	}
+	tests := []struct {
+		name     string
+		args     string
+		wantID   string
+		wantRest string
+	}{
+		{name: "by ID", args: "12 Понедельник Алгебра", wantID: "12", wantRest: "Понедельник Алгебра"},
+		{name: "by name", args: "маша Понедельник", wantID: "10", wantRest: "Понедельник"},
+		{name: "longest name wins", args: "Маша Большая Понедельник", wantID: "11", wantRest: "Понедельник"},
+		{name: "name only", args: "Маша", wantID: "10", wantRest: ""},
+		{name: "no student", args: "Понедельник Алгебра", wantRest: "Понедельник Алгебра"},
+		{name: "unlinked ID", args: "13 Понедельник", wantRest: "13 Понедельник"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, rest := matchLinkedStudent(parent, tt.args)
+			if id != tt.wantID || rest != tt.wantRest {
+				t.Errorf("matchLinkedStudent(%q) = %q, %q, want %q, %q", tt.args, id, rest, tt.wantID, tt.wantRest)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	studentsPrefix = "students"
+	studentRename  = "rename"
+	studentRemove  = "remove"
+
+	renameTTL         = 30 * time.Minute
+	maxStudentNameLen = 40
+	// noName drops the name a parent gave, so the username is shown again
+	noName = "-"
+)
+
+// pendingRename is a student whose new name the parent is about to type
+type pendingRename struct {
+	studentID string
+	createdAt time.Time
+}
+
+// studentName is how the parent sees the student: the name they gave, or the username
+func studentName(parent, student *storage.User) string {
+	if name := parent.StudentNames[student.UserID]; name != "" {
+		return name
+	}
+	return displayName(student)
+}
+
+// handleMyStudents lists the parent's students with buttons to rename or remove each
+func (h *Handler) handleMyStudents(message *tgbotapi.Message) {
+	ctx := context.Background()
+	parentID := fmt.Sprintf("%d", message.From.ID)
+
+	parent, err := h.db.GetUser(ctx, parentID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", parentID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось получить вашу информацию. Пожалуйста, попробуйте снова.")
+		return
+	}
+
+	students := h.linkedStudents(ctx, parent)
+	if len(students) == 0 {
+		h.sendMessage(message.Chat.ID, "Вы еще не добавили ни одного студента. Используйте команду /addstudent, чтобы добавить студента.")
+		return
+	}
+
+	text := "👥 Ваши ученики:\n"
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, student := range students {
+		name := studentName(parent, &student)
+		text += fmt.Sprintf("%d. %s", i+1, name)
+		if name != displayName(&student) {
+			text += " (" + displayName(&student) + ")"
+		}
+		text += "\n"
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ "+name, studentsData(student.UserID, studentRename)),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", studentsData(student.UserID, studentRemove)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text+"\nИмя видно только вам, в /checkhw и сводках.")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Error sending message: %v", err)
+	}
+}
+
+func (h *Handler) handleStudentsCallback(query *tgbotapi.CallbackQuery, data string) {
+	ctx := context.Background()
+	studentID, action, _ := strings.Cut(data, ":")
+	parentID := fmt.Sprintf("%d", query.From.ID)
+
+	parent, err := h.db.GetUser(ctx, parentID)
+	if err != nil || !slices.Contains(parent.StudentIDs, studentID) {
+		logger.Error("Error managing student %s of %s: %v", studentID, parentID, err)
+		h.answerCallback(query, "Ученик не найден")
+		return
+	}
+
+	student, err := h.db.GetUser(ctx, studentID)
+	if err != nil {
+		logger.Error("Error getting student %s: %v", studentID, err)
+		h.answerCallback(query, "Ученик не найден")
+		return
+	}
+
+	h.answerCallback(query, "")
+	switch action {
+	case studentRename:
+		h.renamesLock.Lock()
+		h.pendingRenames[parentID] = pendingRename{studentID: studentID, createdAt: time.Now()}
+		h.renamesLock.Unlock()
+
+		h.sendMessage(query.From.ID, fmt.Sprintf("Напишите новое имя для %s. Отправьте «%s», чтобы показывать имя пользователя.",
+			studentName(parent, student), noName))
+	case studentRemove:
+		if h.unlinkStudent(ctx, query.From.ID, parent, student) {
+			h.editCallbackMessage(query, "Список учеников изменился, откройте /mystudents еще раз.")
+		}
+	}
+}
+
+// takePendingRename returns the rename the parent started, if it is still fresh
+func (h *Handler) takePendingRename(parentID string) (pendingRename, bool) {
+	h.renamesLock.Lock()
+	defer h.renamesLock.Unlock()
+
+	pending, ok := h.pendingRenames[parentID]
+	delete(h.pendingRenames, parentID)
+	if !ok || time.Since(pending.createdAt) > renameTTL {
+		return pendingRename{}, false
+	}
+	return pending, true
+}
+
+func (h *Handler) renameStudent(message *tgbotapi.Message, pending pendingRename) {
+	ctx := context.Background()
+	parentID := fmt.Sprintf("%d", message.From.ID)
+
+	name := strings.TrimSpace(message.Text)
+	if name == noName {
+		name = ""
+	}
+	if len([]rune(name)) > maxStudentNameLen {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Имя слишком длинное, максимум %d символов. Нажмите «Переименовать» в /mystudents еще раз.", maxStudentNameLen))
+		return
+	}
+
+	if err := h.db.SetStudentName(ctx, parentID, pending.studentID, name); err != nil {
+		logger.Error("Error renaming student %s of %s: %v", pending.studentID, parentID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить имя, попробуйте позже")
+		return
+	}
+
+	if name == "" {
+		h.sendMessage(message.Chat.ID, "Имя удалено, будет показываться имя пользователя.")
+		return
+	}
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("Готово, теперь ученик называется «%s».", name))
+}
+
+func studentsData(studentID, action string) string {
+	return studentsPrefix + ":" + studentID + ":" + action
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestHandleStudentsCallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		senderID int64
+		action   string
+		// reply is the parent's next message after the button
+		reply      string
+		wantName   string
+		wantLinked bool
+	}{
+		{name: "rename", senderID: 2, action: studentRename, reply: "Маша", wantName: "Маша", wantLinked: true},
+		{name: "rename back to username", senderID: 2, action: studentRename, reply: noName, wantName: "", wantLinked: true},
+		{name: "name too long", senderID: 2, action: studentRename, reply: strings.Repeat("я", maxStudentNameLen+1), wantLinked: true},
+		{name: "remove", senderID: 2, action: studentRemove, wantLinked: false},
+		{name: "not their student", senderID: 1, action: studentRemove, wantLinked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, _ := newTestHandler(t)
+
+			query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: tt.senderID}, Message: textMessage(tt.senderID, "")}
+			h.handleStudentsCallback(query, testStudentID+":"+tt.action)
+			if tt.reply != "" {
+				h.HandleText(textMessage(tt.senderID, tt.reply))
+			}
+
+			parent, err := db.GetUser(ctx, testParentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name := parent.StudentNames[testStudentID]; name != tt.wantName {
+				t.Errorf("name = %q, want %q", name, tt.wantName)
+			}
+			if linked := slices.Contains(parent.StudentIDs, testStudentID); linked != tt.wantLinked {
+				t.Errorf("linked = %v, want %v", linked, tt.wantLinked)
+			}
+		})
+	}
+}
+
+func TestHandleMyStudents(t *testing.T) {
+	ctx := context.Background()
+	h, db, telegram := newTestHandler(t)
+	if err := db.SetStudentName(ctx, testParentID, testStudentID, "Маша"); err != nil {
+		t.Fatal(err)
+	}
+
+	h.handleMyStudents(commandMessage(2, "/mystudents"))
+
+	sent := telegram.messages()
+	if len(sent) != 1 || !strings.Contains(sent[0], "1. Маша (@student)") {
+		t.Errorf("sent %q, want the student listed by the given name", sent)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const summaryCheckInterval = time.Minute
+
+// userLocation returns the user's time zone, or the server's if none or a broken one is set
+func userLocation(user storage.User) *time.Location {
+	if user.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		logger.Error("Invalid timezone %q of user %s: %v", user.Timezone, user.UserID, err)
+		return time.Local
+	}
+	return loc
+}
+
+// clockOffset parses "20:30" into the offset from midnight
+func clockOffset(clock string) (time.Duration, bool) {
+	t, err := time.Parse(storage.TimeLayout, clock)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+}
+
+// SendDueSummaries sends the daily summary to every parent whose summary time, in
+// their own time zone, has passed and who has not had today's summary yet
+func (h *Handler) SendDueSummaries(now time.Time) error {
+	ctx := context.Background()
+
+	// Find all parent users
+	parents, err := h.db.GetParents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find parents: %w", err)
+	}
+
+	for _, parent := range parents {
+		offset, ok := clockOffset(parent.SummaryTime)
+		if !ok {
+			offset, _ = clockOffset(storage.DefaultSummaryTime)
+		}
+
+		local := now.In(userLocation(parent))
+		today := storage.DateKey(local)
+		due := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()).Add(offset)
+		if local.Before(due) || parent.LastSummaryDate == today {
+			continue
+		}
+
+		// The date is stored first, so a crash or restart cannot send the summary twice
+		if err := h.db.SetLastSummaryDate(ctx, parent.UserID, today); err != nil {
+			logger.Error("Error saving summary date of parent %s: %v", parent.UserID, err)
+			continue
+		}
+		if late := local.Sub(due); late > summaryCheckInterval {
+			logger.Warning("Sending summary to parent %s %v late", parent.UserID, late.Round(time.Second))
+		}
+		h.sendSummary(ctx, parent, local)
+	}
+
+	return nil
+}
+
+// sendSummary sends the parent the homework status of each linked student for the
+// day after local
+func (h *Handler) sendSummary(ctx context.Context, parent storage.User, local time.Time) {
+	nextDate := storage.DateKey(local.AddDate(0, 0, 1))
+
+	// Convert parent.UserID to int64 for telegram API
+	parentID, err := strconv.ParseInt(parent.UserID, 10, 64)
+	if err != nil {
+		logger.Error("Error converting parent ID: %v", err)
+		return
+	}
+
+	// For each parent's student contacts
+	for _, student := range h.linkedStudents(ctx, &parent) {
+		name := studentName(&parent, &student)
+
+		// Skip days without school
+		if reason, off := storage.CalendarOf(&student).DayOff(nextDate); off {
+			logger.Info("Skipping summary for %s on %s (%s)", student.UserID, nextDate, reason)
+			continue
+		}
+
+		completed, incomplete, homeworks, err := h.db.GetHomeworkStatus(ctx, student.UserID, nextDate)
+		if err != nil {
+			logger.Error("Error getting homework status for student %s: %v", student.UserID, err)
+			continue
+		}
+
+		// Create summary message
+		day, err := storage.FindLessonDay(&student, nextDate)
+		if err != nil {
+			logger.Error("Error getting lessons of student %s: %v", student.UserID, err)
+		}
+		summaryMsg := formatHomeworkStatus(name, nextDate, completed, incomplete, homeworks, tasksOf(day))
+
+		// Send text summary
+		msg := tgbotapi.NewMessage(parentID, summaryMsg)
+		if _, err := h.bot.Send(msg); err != nil {
+			logger.Error("Error sending summary to parent %s: %v", parent.UserID, err)
+			continue
+		}
+
+		// Send homework of completed subjects in timetable order
+		for _, subject := range completed {
+			if err := h.sendSubjectHomework(ctx, parentID, subject, homeworks[subject]); err != nil {
+				logger.Error("Error sending homework: %v", err)
+			}
+		}
+	}
+}
+
+// StartDailySummaries checks every minute whose summary or reminder is due, so each
+// parent and student gets it at their own time
+func (h *Handler) StartDailySummaries() {
+	go func() {
+		ticker := time.NewTicker(summaryCheckInterval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			if err := h.SendDueSummaries(now); err != nil {
+				logger.Error("Error sending daily summaries: %v", err)
+			}
+			if err := h.SendDueReminders(now); err != nil {
+				logger.Error("Error sending reminders: %v", err)
+			}
+		}
+	}()
+}
+
+// handleSummaryTime shows or changes when the parent gets the daily summary:
+// /summarytime 20:30 Europe/Moscow. Either part may be omitted.
+func (h *Handler) handleSummaryTime(message *tgbotapi.Message) {
+	ctx := context.Background()
+	userID := fmt.Sprintf("%d", message.From.ID)
+
+	user, err := h.db.GetUser(ctx, userID)
+	if err != nil {
+		logger.Error("Error getting user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Ошибка получения данных. Попробуйте позже")
+		return
+	}
+
+	summaryTime, timezone := user.SummaryTime, user.Timezone
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		h.sendMessage(message.Chat.ID, formatSummarySchedule(summaryTime, timezone)+"\n\n"+
+			"Использование: /summarytime <ЧЧ:ММ> [часовой пояс]\nПример: /summarytime 20:30 Europe/Moscow")
+		return
+	}
+
+	for _, arg := range args {
+		if t, err := time.Parse(storage.TimeLayout, arg); err == nil {
+			summaryTime = t.Format(storage.TimeLayout)
+			continue
+		}
+		if _, err := time.LoadLocation(arg); err == nil && arg != "Local" {
+			timezone = arg
+			continue
+		}
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Не понимаю %q. Укажите время как 20:30 и часовой пояс как Europe/Moscow", arg))
+		return
+	}
+
+	if err := h.db.SetSummarySchedule(ctx, userID, summaryTime, timezone); err != nil {
+		logger.Error("Error setting summary schedule for user %s: %v", userID, err)
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить настройки. Попробуйте позже")
+		return
+	}
+
+	// Students without a time zone of their own are reminded in the parent's
+	h.resetReminders(ctx, h.linkedStudents(ctx, user))
+
+	h.sendMessage(message.Chat.ID, formatSummarySchedule(summaryTime, timezone))
+}
+
+func formatSummarySchedule(summaryTime, timezone string) string {
+	if summaryTime == "" {
+		summaryTime = storage.DefaultSummaryTime
+	}
+	if timezone == "" {
+		timezone = "время сервера"
+	}
+	return fmt.Sprintf("Ежедневная сводка приходит в %s (%s).", summaryTime, timezone)
+}
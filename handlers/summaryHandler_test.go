@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blobmemory "dashka-homework-bot/blobstore/memory"
+)
+
+func TestSendDueSummaries(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Summaries are due at 21:00 on Monday for Tuesday's lessons
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, moscow) }
+
+	tests := []struct {
+		name     string
+		checks   []time.Time
+		restart  bool
+		wantSent int
+	}{
+		{name: "before the time", checks: []time.Time{at(19, 20, 59)}},
+		{name: "due", checks: []time.Time{at(19, 21, 0)}, wantSent: 1},
+		{name: "sent once", checks: []time.Time{at(19, 21, 0), at(19, 21, 1), at(19, 23, 59)}, wantSent: 1},
+		{name: "sent once across a restart", checks: []time.Time{at(19, 21, 0), at(19, 21, 2)}, restart: true, wantSent: 1},
+		{name: "late", checks: []time.Time{at(19, 23, 30)}, wantSent: 1},
+		{name: "every day", checks: []time.Time{at(19, 21, 0), at(20, 20, 0), at(20, 21, 0)}, wantSent: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			h, db, telegram := newTestHandler(t)
+			if err := db.SetSummarySchedule(ctx, testParentID, "21:00", "Europe/Moscow"); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, now := range tt.checks {
+				if tt.restart && i > 0 {
+					h = NewHandler(h.bot, db, blobmemory.NewStore(), nil)
+				}
+				if err := h.SendDueSummaries(now); err != nil {
+					t.Fatalf("SendDueSummaries() error = %v", err)
+				}
+			}
+
+			if sent := telegram.messages(); len(sent) != tt.wantSent {
+				t.Errorf("sent %q, want %d summaries", sent, tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+	"dashka-homework-bot/subjects"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// clearTask as the task text removes the assignment
+const clearTask = "-"
+
+// handleTask records what was assigned for a lesson:
+// /task [ученик] [дд.мм] <предмет> <задание>. Without a date the next lesson of the
+// subject is used.
+func (h *Handler) handleTask(message *tgbotapi.Message) {
+	ctx := context.Background()
+	target, args, ok := h.scheduleTargetOrReply(ctx, message)
+	if !ok {
+		return
+	}
+
+	usage := "Использование: /task [ученик] [дд.мм] <предмет> <задание>\n" +
+		"Пример: /task Алгебра стр. 45 №3-7\nУдалить задание: /task Алгебра -" + studentArgUsage
+
+	var lessons []lessonOption
+	first, rest, _ := strings.Cut(args, " ")
+	if date, ok := parseDate(first); ok {
+		args = rest
+		day, err := h.db.GetLessonsForDate(ctx, target.UserID, date)
+		if err != nil {
+			logger.Error("Error getting lessons for user %s: %v", target.UserID, err)
+			h.sendMessage(message.Chat.ID, "Ошибка получения расписания. Попробуйте позже")
+			return
+		}
+		for _, subject := range day.Subjects {
+			lessons = append(lessons, lessonOption{date: date, subject: subject.SubjectName})
+		}
+	} else {
+		var err error
+		lessons, err = h.upcomingLessons(ctx, target)
+		if err != nil {
+			logger.Error("Error getting lessons for user %s: %v", target.UserID, err)
+			h.sendMessage(message.Chat.ID, "Ошибка получения расписания. Попробуйте позже")
+			return
+		}
+	}
+
+	if strings.TrimSpace(args) == "" {
+		h.sendMessage(message.Chat.ID, usage)
+		return
+	}
+
+	names := make([]string, len(lessons))
+	for i, lesson := range lessons {
+		names[i] = lesson.subject
+	}
+
+	match, ambiguous, task := subjects.ResolvePrefix(args, names, target.SubjectAliases)
+	if len(ambiguous) > 0 {
+		h.sendMessage(message.Chat.ID, "Уточните предмет: "+strings.Join(ambiguous, ", "))
+		return
+	}
+	if match == "" {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Не нашел такой урок в расписании.\n\n%s", usage))
+		return
+	}
+
+	var lesson lessonOption
+	for _, l := range lessons {
+		if l.subject == match {
+			lesson = l
+			break
+		}
+	}
+
+	if task == "" {
+		h.sendMessage(message.Chat.ID, usage)
+		return
+	}
+	if task == clearTask {
+		task = ""
+	}
+
+	if err := h.db.SetTask(ctx, target.UserID, lesson.date, lesson.subject, task); err != nil {
+		logger.Error("Error setting task for user %s: %v", target.UserID, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendMessage(message.Chat.ID, "Не нашел такой урок в расписании.")
+			return
+		}
+		h.sendMessage(message.Chat.ID, "Не удалось сохранить задание. Попробуйте позже")
+		return
+	}
+
+	if task == "" {
+		h.sendMessage(message.Chat.ID, fmt.Sprintf("Задание по %s на %s удалено", lesson.subject, formatDate(lesson.date)))
+		return
+	}
+	h.sendMessage(message.Chat.ID, fmt.Sprintf("Задание по %s на %s: %s", lesson.subject, formatDate(lesson.date), task))
+}
+
+// lessonTasks returns the assignments of the student's lessons on the date by subject
+func (h *Handler) lessonTasks(ctx context.Context, studentID, date string) map[string]string {
+	student, err := h.db.GetUser(ctx, studentID)
+	if err != nil {
+		logger.Error("Error getting student %s: %v", studentID, err)
+		return nil
+	}
+
+	day, err := storage.FindLessonDay(student, date)
+	if err != nil {
+		logger.Error("Error getting lessons of student %s: %v", studentID, err)
+		return nil
+	}
+	return tasksOf(day)
+}
+
+func tasksOf(day storage.LessonDay) map[string]string {
+	tasks := make(map[string]string)
+	for _, subject := range day.Subjects {
+		if subject.Task != "" {
+			tasks[subject.SubjectName] = subject.Task
+		}
+	}
+	return tasks
+}
+
+// formatLesson renders a subject together with its assignment, if any
+func formatLesson(subject, task string) string {
+	if task == "" {
+		return subject
+	}
+	return fmt.Sprintf("%s — %s", subject, task)
+}
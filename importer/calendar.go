@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/storage"
+)
+
+type icsBreak struct {
+	line     int
+	summary  string
+	start    time.Time
+	startSet bool
+	end      time.Time
+	endSet   bool
+	allDay   bool
+	canceled bool
+	invalid  bool
+}
+
+// ParseCalendarICS reads school holidays and vacations from an iCalendar file. Every
+// event becomes a day off: a one-day event is a holiday, a longer one a vacation.
+// All-day events end the day before DTEND, as iCalendar defines.
+func ParseCalendarICS(data []byte) (storage.Calendar, error) {
+	lines, err := unfoldICS(data)
+	if err != nil {
+		return storage.Calendar{}, err
+	}
+
+	var errs Errors
+	var calendar storage.Calendar
+	var event *icsBreak
+
+	for _, l := range lines {
+		switch {
+		case l.name == "BEGIN" && strings.EqualFold(l.value, "VEVENT"):
+			event = &icsBreak{line: l.number}
+		case l.name == "END" && strings.EqualFold(l.value, "VEVENT"):
+			if event == nil {
+				errs = append(errs, LineError{Line: l.number, Message: "END:VEVENT без BEGIN:VEVENT"})
+				continue
+			}
+			if !event.startSet && !event.invalid {
+				errs = append(errs, LineError{Line: event.line, Message: "у события нет DTSTART"})
+			} else if !event.canceled && !event.invalid {
+				event.addTo(&calendar)
+			}
+			event = nil
+		case event == nil:
+			continue
+		case l.name == "SUMMARY":
+			event.summary = strings.TrimSpace(unescapeICS(l.value))
+		case l.name == "DTSTART", l.name == "DTEND":
+			t, err := parseICSTime(l.params, l.value)
+			if err != nil {
+				errs = append(errs, LineError{Line: l.number, Message: fmt.Sprintf("не удалось разобрать дату %q", l.value)})
+				event.invalid = true
+				continue
+			}
+			if l.name == "DTSTART" {
+				event.start = t
+				event.startSet = true
+				event.allDay = !strings.Contains(l.value, "T")
+			} else {
+				event.end = t
+				event.endSet = true
+			}
+		case l.name == "STATUS":
+			event.canceled = strings.EqualFold(l.value, "CANCELLED")
+		}
+	}
+
+	if event != nil {
+		errs = append(errs, LineError{Line: event.line, Message: "событие не закрыто END:VEVENT"})
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+		return storage.Calendar{}, errs
+	}
+	if len(calendar.Vacations) == 0 && len(calendar.Holidays) == 0 {
+		return storage.Calendar{}, Errors{{Line: 1, Message: "в файле нет ни одного выходного"}}
+	}
+
+	// Merging into an empty calendar drops duplicates and sorts by date
+	return storage.Calendar{}.Merge(calendar), nil
+}
+
+func (e *icsBreak) addTo(calendar *storage.Calendar) {
+	start := storage.DateKey(e.start)
+	end := start
+	if e.endSet {
+		last := e.end
+		if e.allDay {
+			last = last.AddDate(0, 0, -1)
+		}
+		if storage.DateKey(last) > start {
+			end = storage.DateKey(last)
+		}
+	}
+
+	if start == end {
+		calendar.Holidays = append(calendar.Holidays, storage.Holiday{Name: e.summary, Date: start})
+		return
+	}
+	calendar.Vacations = append(calendar.Vacations, storage.Vacation{Name: e.summary, Start: start, End: end})
+}
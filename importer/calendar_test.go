@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"dashka-homework-bot/storage"
+)
+
+func TestParseCalendarICS(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		want      storage.Calendar
+		wantLines []int
+	}{
+		{
+			name: "holidays and vacations",
+			data: ics(
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"SUMMARY:Осенние каникулы",
+				"DTSTART;VALUE=DATE:20261026",
+				"DTEND;VALUE=DATE:20261102",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:День народного единства",
+				"DTSTART;VALUE=DATE:20261104",
+				"DTEND;VALUE=DATE:20261105",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Новый год",
+				"DTSTART:20270101",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Перенесено",
+				"DTSTART;VALUE=DATE:20261106",
+				"STATUS:CANCELLED",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			),
+			want: storage.Calendar{
+				Vacations: []storage.Vacation{{Name: "Осенние каникулы", Start: "2026-10-26", End: "2026-11-01"}},
+				Holidays: []storage.Holiday{
+					{Name: "День народного единства", Date: "2026-11-04"},
+					{Name: "Новый год", Date: "2027-01-01"},
+				},
+			},
+		},
+		{
+			name: "malformed events",
+			data: ics(
+				"BEGIN:VEVENT",
+				"SUMMARY:Каникулы",
+				"DTSTART;VALUE=DATE:2026-10-26",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Праздник",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Без конца",
+				"DTSTART;VALUE=DATE:20261104",
+			),
+			wantLines: []int{3, 5, 8},
+		},
+		{
+			name:      "no events",
+			data:      ics("BEGIN:VCALENDAR", "END:VCALENDAR"),
+			wantLines: []int{1},
+		},
+		{
+			name:      "empty file",
+			data:      "",
+			wantLines: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar, err := ParseCalendarICS([]byte(tt.data))
+			if tt.wantLines != nil {
+				if lines := errorLines(err); !reflect.DeepEqual(lines, tt.wantLines) {
+					t.Fatalf("ParseCalendarICS() error = %v, want errors on lines %v", err, tt.wantLines)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCalendarICS() error = %v", err)
+			}
+			if !reflect.DeepEqual(calendar, tt.want) {
+				t.Errorf("ParseCalendarICS() = %+v, want %+v", calendar, tt.want)
+			}
+		})
+	}
+}
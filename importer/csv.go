@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"dashka-homework-bot/storage"
+)
+
+// ParseCSV reads rows of the form "день,предмет[,предмет...]". Both comma and
+// semicolon separators are accepted, and an optional header row is skipped.
+func ParseCSV(data []byte) ([]storage.DaySchedule, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	lessons := week{}
+	var errs Errors
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				errs = append(errs, LineError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		isFirst := first
+		first = false
+
+		if isBlank(record) {
+			continue
+		}
+
+		day, ok := ParseWeekday(record[0])
+		if !ok {
+			if isFirst && isHeader(record[0]) {
+				continue
+			}
+			errs = append(errs, LineError{Line: line, Message: fmt.Sprintf("неизвестный день недели %q", record[0])})
+			continue
+		}
+
+		var subjects []string
+		for _, field := range record[1:] {
+			if name := strings.TrimSpace(field); name != "" {
+				subjects = append(subjects, name)
+			}
+		}
+		if len(subjects) == 0 {
+			errs = append(errs, LineError{Line: line, Message: "не указан предмет"})
+			continue
+		}
+
+		lessons[day] = append(lessons[day], subjects...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(lessons) == 0 {
+		return nil, Errors{{Line: 1, Message: "в файле нет ни одного урока"}}
+	}
+
+	return lessons.schedule(), nil
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func isHeader(field string) bool {
+	switch strings.ToLower(strings.TrimSpace(field)) {
+	case "день", "день недели", "day", "weekday":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package importer
+
+import "testing"
+
+func TestParseCSV(t *testing.T) {
+	runScheduleTests(t, ParseCSV, []scheduleTest{
+		{
+			name: "comma separated",
+			data: "Пн,Алгебра,Русский\nСреда,Физика\n",
+			want: map[string]string{"Monday": "Алгебра, Русский", "Wednesday": "Физика"},
+		},
+		{
+			name: "semicolons, header, BOM and blank lines",
+			data: "\xef\xbb\xbfДень;Предмет\r\n\r\nвт; История ;\r\nTuesday;ИЗО\r\n",
+			want: map[string]string{"Tuesday": "История, ИЗО"},
+		},
+		{
+			name: "quoted subject with a comma",
+			data: `Пт,"Чтение, литература"`,
+			want: map[string]string{"Friday": "Чтение, литература"},
+		},
+		{
+			name:      "unknown day and missing subject",
+			data:      "Пн,Алгебра\nПнд,Физика\nВт\nСр,Химия\nЧетверг,,\n",
+			wantLines: []int{2, 3, 5},
+		},
+		{
+			name:      "header only counts on the first line",
+			data:      "Пн,Алгебра\nДень,Предмет\n",
+			wantLines: []int{2},
+		},
+		{
+			name:      "broken quotes",
+			data:      "Пн,Алгебра\nВт,\"Физика\n",
+			wantLines: []int{2},
+		},
+		{
+			name:      "empty file",
+			data:      "",
+			wantLines: []int{1},
+		},
+		{
+			name:      "header without lessons",
+			data:      "день,предметы\n",
+			wantLines: []int{1},
+		},
+	})
+}
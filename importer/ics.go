@@ -0,0 +1,236 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/storage"
+)
+
+var icsWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// icsLine is an unfolded content line together with the physical line it started on
+type icsLine struct {
+	number int
+	name   string
+	params string
+	value  string
+}
+
+type icsEvent struct {
+	line     int
+	summary  string
+	start    time.Time
+	startSet bool
+	byDay    []time.Weekday
+	canceled bool
+	invalid  bool
+}
+
+type lesson struct {
+	day     time.Weekday
+	minutes int
+	name    string
+}
+
+// ParseICS turns the VEVENTs of an iCalendar file into a weekly timetable. Each event
+// becomes a lesson on the weekday of its DTSTART, or on every BYDAY of a weekly RRULE.
+// Repeated occurrences of the same lesson at the same time are merged.
+func ParseICS(data []byte) ([]storage.DaySchedule, error) {
+	lines, err := unfoldICS(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs Errors
+	var lessons []lesson
+	seen := make(map[lesson]bool)
+	var event *icsEvent
+
+	for _, l := range lines {
+		switch {
+		case l.name == "BEGIN" && strings.EqualFold(l.value, "VEVENT"):
+			event = &icsEvent{line: l.number}
+		case l.name == "END" && strings.EqualFold(l.value, "VEVENT"):
+			if event == nil {
+				errs = append(errs, LineError{Line: l.number, Message: "END:VEVENT без BEGIN:VEVENT"})
+				continue
+			}
+			if err := event.validate(); err != nil {
+				errs = append(errs, *err)
+			} else if !event.canceled && !event.invalid {
+				for _, lsn := range event.lessons() {
+					if !seen[lsn] {
+						seen[lsn] = true
+						lessons = append(lessons, lsn)
+					}
+				}
+			}
+			event = nil
+		case event == nil:
+			continue
+		case l.name == "SUMMARY":
+			event.summary = unescapeICS(l.value)
+		case l.name == "DTSTART":
+			start, err := parseICSTime(l.params, l.value)
+			if err != nil {
+				errs = append(errs, LineError{Line: l.number, Message: fmt.Sprintf("не удалось разобрать дату %q", l.value)})
+				event.invalid = true
+				continue
+			}
+			event.start = start
+			event.startSet = true
+		case l.name == "RRULE":
+			days, err := parseByDay(l.value)
+			if err != nil {
+				errs = append(errs, LineError{Line: l.number, Message: err.Error()})
+				event.invalid = true
+				continue
+			}
+			event.byDay = days
+		case l.name == "STATUS":
+			event.canceled = strings.EqualFold(l.value, "CANCELLED")
+		}
+	}
+
+	if event != nil {
+		errs = append(errs, LineError{Line: event.line, Message: "событие не закрыто END:VEVENT"})
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+		return nil, errs
+	}
+	if len(lessons) == 0 {
+		return nil, Errors{{Line: 1, Message: "в файле нет ни одного урока"}}
+	}
+
+	sort.SliceStable(lessons, func(i, j int) bool { return lessons[i].minutes < lessons[j].minutes })
+	w := week{}
+	for _, lsn := range lessons {
+		w[lsn.day] = append(w[lsn.day], lsn.name)
+	}
+	return w.schedule(), nil
+}
+
+func (e *icsEvent) validate() *LineError {
+	if e.invalid {
+		return nil
+	}
+	if strings.TrimSpace(e.summary) == "" {
+		return &LineError{Line: e.line, Message: "у события нет SUMMARY с названием предмета"}
+	}
+	if !e.startSet {
+		return &LineError{Line: e.line, Message: "у события нет DTSTART"}
+	}
+	return nil
+}
+
+func (e *icsEvent) lessons() []lesson {
+	days := e.byDay
+	if len(days) == 0 {
+		days = []time.Weekday{e.start.Weekday()}
+	}
+
+	minutes := e.start.Hour()*60 + e.start.Minute()
+	result := make([]lesson, 0, len(days))
+	for _, d := range days {
+		result = append(result, lesson{day: d, minutes: minutes, name: strings.TrimSpace(e.summary)})
+	}
+	return result
+}
+
+func unfoldICS(data []byte) ([]icsLine, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var raw []string
+	var numbers []int
+	n := 0
+	for scanner.Scan() {
+		n++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(raw) > 0 {
+			raw[len(raw)-1] += text[1:]
+			continue
+		}
+		raw = append(raw, text)
+		numbers = append(numbers, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]icsLine, 0, len(raw))
+	for i, text := range raw {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		head, value, ok := strings.Cut(text, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(head, ";")
+		lines = append(lines, icsLine{
+			number: numbers[i],
+			name:   strings.ToUpper(name),
+			params: params,
+			value:  value,
+		})
+	}
+	return lines, nil
+}
+
+func parseICSTime(params, value string) (time.Time, error) {
+	if strings.Contains(strings.ToUpper(params), "VALUE=DATE") && !strings.Contains(value, "T") {
+		return time.Parse("20060102", value)
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.Local(), nil
+	}
+	if len(value) == len("20060102") {
+		return time.Parse("20060102", value)
+	}
+	return time.Parse("20060102T150405", value)
+}
+
+func parseByDay(rule string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	weekly := false
+	for _, part := range strings.Split(rule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			weekly = strings.EqualFold(value, "WEEKLY")
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				code = strings.ToUpper(strings.TrimLeft(code, "+-0123456789"))
+				day, ok := icsWeekdays[code]
+				if !ok {
+					return nil, fmt.Errorf("неизвестный день %q в RRULE", code)
+				}
+				days = append(days, day)
+			}
+		}
+	}
+	if !weekly {
+		return nil, nil
+	}
+	return days, nil
+}
+
+func unescapeICS(s string) string {
+	replacer := strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`)
+	return replacer.Replace(s)
+}
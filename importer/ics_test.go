@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+// ics joins the lines of an iCalendar file
+func ics(lines ...string) string {
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestParseICS(t *testing.T) {
+	runScheduleTests(t, ParseICS, []scheduleTest{
+		{
+			name: "weekly rule and single events sorted by time",
+			data: ics(
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"SUMMARY:Алгебра",
+				"DTSTART;TZID=Europe/Moscow:20261019T090000",
+				"RRULE:FREQ=WEEKLY;BYDAY=MO,WE",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Русский",
+				"DTSTART:20261019T080000",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			),
+			want: map[string]string{"Monday": "Русский, Алгебра", "Wednesday": "Алгебра"},
+		},
+		{
+			name: "repeated, cancelled and folded events",
+			data: ics(
+				"BEGIN:VEVENT",
+				"SUMMARY:Иностр",
+				" анный язык",
+				"DTSTART:20261020T100000",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Иностранный язык",
+				"DTSTART:20261027T100000",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Физкультура",
+				"DTSTART:20261020T110000",
+				"STATUS:CANCELLED",
+				"END:VEVENT",
+			),
+			want: map[string]string{"Tuesday": "Иностранный язык"},
+		},
+		{
+			name: "malformed events",
+			data: ics(
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"SUMMARY:Алгебра",
+				"DTSTART:вчера",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"DTSTART:20261019T090000",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Физика",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Химия",
+				"DTSTART:20261019T100000",
+				"RRULE:FREQ=WEEKLY;BYDAY=XX",
+				"END:VEVENT",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:История",
+			),
+			wantLines: []int{4, 6, 9, 15, 17, 18},
+		},
+		{
+			name:      "no events",
+			data:      ics("BEGIN:VCALENDAR", "END:VCALENDAR"),
+			wantLines: []int{1},
+		},
+		{
+			name:      "empty file",
+			data:      "",
+			wantLines: []int{1},
+		},
+	})
+}
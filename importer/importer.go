@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dashka-homework-bot/storage"
+)
+
+// LineError describes a problem with a single line of an imported file
+type LineError struct {
+	Line    int
+	Message string
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("строка %d: %s", e.Line, e.Message)
+}
+
+// Errors is returned when one or more lines could not be parsed. Nothing is imported in that case.
+type Errors []LineError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var weekdays = map[string]time.Weekday{
+	"понедельник": time.Monday, "пн": time.Monday, "monday": time.Monday, "mon": time.Monday,
+	"вторник": time.Tuesday, "вт": time.Tuesday, "tuesday": time.Tuesday, "tue": time.Tuesday,
+	"среда": time.Wednesday, "ср": time.Wednesday, "wednesday": time.Wednesday, "wed": time.Wednesday,
+	"четверг": time.Thursday, "чт": time.Thursday, "thursday": time.Thursday, "thu": time.Thursday,
+	"пятница": time.Friday, "пт": time.Friday, "friday": time.Friday, "fri": time.Friday,
+	"суббота": time.Saturday, "сб": time.Saturday, "saturday": time.Saturday, "sat": time.Saturday,
+	"воскресенье": time.Sunday, "вс": time.Sunday, "sunday": time.Sunday, "sun": time.Sunday,
+}
+
+// ParseWeekday converts a Russian or English weekday name to time.Weekday
+func ParseWeekday(s string) (time.Weekday, bool) {
+	day, ok := weekdays[strings.ToLower(strings.TrimSpace(s))]
+	return day, ok
+}
+
+// Supported reports whether a file with this name can be imported
+func Supported(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv", ".ics":
+		return true
+	}
+	return false
+}
+
+// Parse reads a CSV or iCalendar timetable, chosen by file extension
+func Parse(fileName string, data []byte) ([]storage.DaySchedule, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return ParseCSV(data)
+	case ".ics":
+		return ParseICS(data)
+	}
+	return nil, fmt.Errorf("unsupported file type %s", filepath.Ext(fileName))
+}
+
+// week collects lessons per weekday and turns them into a full Monday..Sunday schedule
+type week map[time.Weekday][]string
+
+func (w week) schedule() []storage.DaySchedule {
+	schedule := storage.EmptySchedule()
+	for i := range schedule {
+		for d, subjects := range w {
+			if d.String() != schedule[i].DayName {
+				continue
+			}
+			for _, name := range subjects {
+				schedule[i].Subjects = append(schedule[i].Subjects, storage.Subject{SubjectName: name})
+			}
+		}
+	}
+	return schedule
+}
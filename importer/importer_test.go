@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dashka-homework-bot/storage"
+)
+
+// lessonsByDay lists the subjects of each day that has lessons
+func lessonsByDay(schedule []storage.DaySchedule) map[string]string {
+	days := make(map[string]string)
+	for _, day := range schedule {
+		var names []string
+		for _, subject := range day.Subjects {
+			names = append(names, subject.SubjectName)
+		}
+		if len(names) > 0 {
+			days[day.DayName] = strings.Join(names, ", ")
+		}
+	}
+	return days
+}
+
+// errorLines returns the line numbers of the errors, or nil if err is not Errors
+func errorLines(err error) []int {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	lines := make([]int, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Line
+	}
+	return lines
+}
+
+// scheduleTest is a timetable parser input with the expected lessons, or the lines
+// of the expected errors
+type scheduleTest struct {
+	name      string
+	data      string
+	want      map[string]string
+	wantLines []int
+}
+
+func runScheduleTests(t *testing.T, parse func([]byte) ([]storage.DaySchedule, error), tests []scheduleTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parse([]byte(tt.data))
+			if tt.wantLines != nil {
+				if lines := errorLines(err); !reflect.DeepEqual(lines, tt.wantLines) {
+					t.Fatalf("error = %v, want errors on lines %v", err, tt.wantLines)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(schedule) != 7 {
+				t.Errorf("got %d days, want the whole week", len(schedule))
+			}
+			if got := lessonsByDay(schedule); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lessons = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fileName string
+		data     string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{fileName: "Расписание.CSV", data: "Пн,Алгебра", want: map[string]string{"Monday": "Алгебра"}},
+		{fileName: "school.ics", data: "BEGIN:VEVENT\nSUMMARY:Физика\nDTSTART:20261020T090000\nEND:VEVENT", want: map[string]string{"Tuesday": "Физика"}},
+		{fileName: "schedule.xlsx", data: "Пн,Алгебра", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			if got := Supported(tt.fileName); got == tt.wantErr {
+				t.Errorf("Supported() = %v, want %v", got, !tt.wantErr)
+			}
+
+			schedule, err := Parse(tt.fileName, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(lessonsByDay(schedule), tt.want) {
+				t.Errorf("Parse() lessons = %v, want %v", lessonsByDay(schedule), tt.want)
+			}
+		})
+	}
+}
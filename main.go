@@ -2,14 +2,26 @@ package main
 
 import (
 	"context"
+	"dashka-homework-bot/blobstore"
+	"dashka-homework-bot/blobstore/filesystem"
+	"dashka-homework-bot/blobstore/gridfs"
+	blobmemory "dashka-homework-bot/blobstore/memory"
+	"dashka-homework-bot/blobstore/s3"
 	"dashka-homework-bot/handlers"
 	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+	"dashka-homework-bot/storage/memory"
 	"dashka-homework-bot/storage/mongo"
 	"dashka-homework-bot/updater"
+	"fmt"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	_ "time/tzdata" // parents' time zones must resolve even without system tzdata
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
@@ -32,31 +44,62 @@ func main() {
 		logger.Fatal("please set TELEGRAM_BOT_TOKEN environment variable")
 	}
 
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		logger.Fatal("Please set MONGO_URI environment variable")
-	}
-
 	ctx := context.Background()
-	homeworkDB, err := mongo.NewHomeworkDatabase(ctx, mongoURI)
-	if err != nil {
-		logger.Fatal("Failed to initialize MongoDB: %v", err)
+	var homeworkDB storage.Storage
+	var mongoDB *mongo.HomeworkDatabase
+	switch os.Getenv("STORAGE") {
+	case "memory":
+		homeworkDB = memory.NewHomeworkDatabase()
+	case "", "mongo":
+		mongoURI := os.Getenv("MONGO_URI")
+		if mongoURI == "" {
+			logger.Fatal("Please set MONGO_URI environment variable")
+		}
+
+		mongoDB, err = mongo.NewHomeworkDatabase(ctx, mongoURI)
+		if err != nil {
+			logger.Fatal("Failed to initialize MongoDB: %v", err)
+		}
+
+		if err := mongoDB.MigrateEmbeddedHomework(ctx); err != nil {
+			logger.Fatal("Failed to migrate homework: %v", err)
+		}
+		if err := mongoDB.MigrateCalendars(ctx); err != nil {
+			logger.Fatal("Failed to migrate calendars: %v", err)
+		}
+		if err := mongoDB.MigrateStudentIDs(ctx); err != nil {
+			logger.Fatal("Failed to migrate student links: %v", err)
+		}
+		if err := mongoDB.MigrateRoles(ctx); err != nil {
+			logger.Fatal("Failed to migrate roles: %v", err)
+		}
+		homeworkDB = mongoDB
+	default:
+		logger.Fatal("Unknown STORAGE %q, expected mongo or memory", os.Getenv("STORAGE"))
 	}
 	defer func() {
 		if err := homeworkDB.Close(ctx); err != nil {
-			logger.Error("Error closing MongoDB connection: %v", err)
+			logger.Error("Error closing storage: %v", err)
 		}
 	}()
 
-	// Start periodic eraser as a background goroutine
-	go homeworkDB.StartEraseAtMidnight()
+	blobs, err := newBlobStore(ctx, mongoDB)
+	if err != nil {
+		logger.Fatal("Failed to initialize blob store: %v", err)
+	}
+
+	if mongoDB != nil {
+		if err := mongoDB.MigrateHomeworkPhotos(ctx, blobs); err != nil {
+			logger.Fatal("Failed to migrate homework photos: %v", err)
+		}
+	}
 
 	bot, err := tgbotapi.NewBotAPI(tgToken)
 	if err != nil {
 		logger.Fatal("Failed to create bot: %v", err)
 	}
 
-	h := handlers.NewHandler(bot, homeworkDB)
+	h := handlers.NewHandler(bot, homeworkDB, blobs, adminIDs())
 
 	// Set bot commands
 	if err := h.SetBotCommands(); err != nil {
@@ -64,15 +107,15 @@ func main() {
 	}
 
 	// Start the daily summaries scheduler
-	homeworkDB.StartDailySummaries(bot)
+	h.StartDailySummaries()
 
 	// Start periodic eraser as a background goroutine
-	go homeworkDB.StartEraseAtMidnight()
+	go storage.StartEraseAtMidnight(homeworkDB, blobs)
 
 	bot.Debug = true
 	logger.Info("Authorized on account %s", bot.Self.UserName)
 
-	upd := updater.NewUpdater(bot, h)
+	upd := updater.NewUpdater(bot, h, envInt("UPDATE_WORKERS", 8), envInt("UPDATE_QUEUE_SIZE", 100))
 
 	// Gracefully handle shutdown
 	stop := make(chan os.Signal, 1)
@@ -84,5 +127,104 @@ func main() {
 	}()
 
 	logger.Info("Bot is running...")
-	upd.PollUpdates()
+	switch os.Getenv("UPDATES_MODE") {
+	case "", "polling":
+		upd.PollUpdates()
+	case "webhook":
+		if err := upd.ServeWebhook(webhookConfig()); err != nil {
+			logger.Fatal("Webhook server failed: %v", err)
+		}
+	default:
+		logger.Fatal("Unknown UPDATES_MODE %q, expected polling or webhook", os.Getenv("UPDATES_MODE"))
+	}
+}
+
+// adminIDs reads the comma-separated Telegram user IDs of admins from ADMIN_IDS
+func adminIDs() []string {
+	var ids []string
+	for _, id := range strings.Split(os.Getenv("ADMIN_IDS"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			logger.Fatal("Invalid ADMIN_IDS entry %q: expected a Telegram user ID", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// envInt reads a positive number from the environment, falling back to def
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		logger.Fatal("%s must be a positive number, got %q", name, value)
+	}
+	return n
+}
+
+// webhookConfig reads the webhook settings. The path defaults to the path of
+// WEBHOOK_URL, so Telegram and the local server agree on it.
+func webhookConfig() updater.WebhookConfig {
+	config := updater.WebhookConfig{
+		ListenAddr:  os.Getenv("WEBHOOK_LISTEN"),
+		Path:        os.Getenv("WEBHOOK_PATH"),
+		PublicURL:   os.Getenv("WEBHOOK_URL"),
+		SecretToken: os.Getenv("WEBHOOK_SECRET"),
+	}
+	if config.ListenAddr == "" {
+		config.ListenAddr = ":8080"
+	}
+	if config.Path == "" && config.PublicURL != "" {
+		if link, err := url.Parse(config.PublicURL); err == nil {
+			config.Path = link.Path
+		}
+	}
+	if config.Path == "" {
+		config.Path = "/telegram"
+	}
+	return config
+}
+
+// newBlobStore picks where homework files are kept from BLOB_STORE. GridFS is the
+// default with MongoDB storage, memory otherwise.
+func newBlobStore(ctx context.Context, mongoDB *mongo.HomeworkDatabase) (blobstore.Store, error) {
+	kind := os.Getenv("BLOB_STORE")
+	if kind == "" {
+		kind = "memory"
+		if mongoDB != nil {
+			kind = "gridfs"
+		}
+	}
+
+	switch kind {
+	case "memory":
+		return blobmemory.NewStore(), nil
+	case "filesystem":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = filepath.Join(".", "data", "blobs")
+		}
+		return filesystem.NewStore(dir)
+	case "gridfs":
+		if mongoDB == nil {
+			return nil, fmt.Errorf("BLOB_STORE=gridfs requires STORAGE=mongo")
+		}
+		return gridfs.NewStore(mongoDB.Database()), nil
+	case "s3":
+		return s3.NewStore(ctx, s3.Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+		})
+	}
+	return nil, fmt.Errorf("unknown BLOB_STORE %q, expected memory, filesystem, gridfs or s3", kind)
 }
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultDaysOff are the weekly days off of a student who has not set up a calendar
+var DefaultDaysOff = []string{"Sunday"}
+
+// Calendar holds the days a student has no school
+type Calendar struct {
+	// DaysOff are weekday names, e.g. "Sunday"
+	DaysOff   []string   `bson:"days_off"`
+	Vacations []Vacation `bson:"vacations"`
+	Holidays  []Holiday  `bson:"holidays"`
+}
+
+// Vacation is a range of dates without school, both ends included
+type Vacation struct {
+	Name  string `bson:"name"`
+	Start string `bson:"start"`
+	End   string `bson:"end"`
+}
+
+// Holiday is a single date without school
+type Holiday struct {
+	Name string `bson:"name"`
+	Date string `bson:"date"`
+}
+
+// CalendarOf returns the student's calendar, or the default one if none was set
+func CalendarOf(user *User) Calendar {
+	if user.Calendar == nil {
+		return Calendar{DaysOff: append([]string(nil), DefaultDaysOff...)}
+	}
+	return *user.Calendar
+}
+
+// DayOff reports whether there is no school on the date and names the reason:
+// the holiday or vacation name, or the weekday
+func (c Calendar) DayOff(date string) (string, bool) {
+	for _, holiday := range c.Holidays {
+		if holiday.Date == date {
+			return holiday.Name, true
+		}
+	}
+	for _, vacation := range c.Vacations {
+		// Dates in DateLayout compare correctly as strings
+		if vacation.Start <= date && date <= vacation.End {
+			return vacation.Name, true
+		}
+	}
+
+	t, err := time.Parse(DateLayout, date)
+	if err != nil {
+		return "", false
+	}
+	for _, day := range c.DaysOff {
+		if day == t.Weekday().String() {
+			return day, true
+		}
+	}
+	return "", false
+}
+
+// Merge adds the vacations and holidays of other that c does not have yet and keeps
+// both lists sorted by date
+func (c Calendar) Merge(other Calendar) Calendar {
+	result := Calendar{
+		DaysOff:   append([]string(nil), c.DaysOff...),
+		Vacations: append([]Vacation(nil), c.Vacations...),
+		Holidays:  append([]Holiday(nil), c.Holidays...),
+	}
+
+	for _, vacation := range other.Vacations {
+		if !containsVacation(result.Vacations, vacation) {
+			result.Vacations = append(result.Vacations, vacation)
+		}
+	}
+	for _, holiday := range other.Holidays {
+		if !containsHoliday(result.Holidays, holiday) {
+			result.Holidays = append(result.Holidays, holiday)
+		}
+	}
+
+	sort.SliceStable(result.Vacations, func(i, j int) bool { return result.Vacations[i].Start < result.Vacations[j].Start })
+	sort.SliceStable(result.Holidays, func(i, j int) bool { return result.Holidays[i].Date < result.Holidays[j].Date })
+	return result
+}
+
+func containsVacation(vacations []Vacation, v Vacation) bool {
+	for _, vacation := range vacations {
+		if vacation.Start == v.Start && vacation.End == v.End {
+			return true
+		}
+	}
+	return false
+}
+
+func containsHoliday(holidays []Holiday, h Holiday) bool {
+	for _, holiday := range holidays {
+		if holiday.Date == h.Date {
+			return true
+		}
+	}
+	return false
+}
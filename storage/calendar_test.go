@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCalendarDayOff(t *testing.T) {
+	calendar := Calendar{
+		DaysOff:   []string{"Sunday"},
+		Vacations: []Vacation{{Name: "Осенние каникулы", Start: "2026-10-26", End: "2026-11-03"}},
+		Holidays:  []Holiday{{Name: "День народного единства", Date: "2026-11-04"}},
+	}
+	tests := []struct {
+		name       string
+		date       string
+		wantReason string
+		wantOff    bool
+	}{
+		{name: "school day", date: "2026-10-20"},
+		{name: "weekday off", date: "2026-10-18", wantReason: "Sunday", wantOff: true},
+		{name: "first day of vacation", date: "2026-10-26", wantReason: "Осенние каникулы", wantOff: true},
+		{name: "last day of vacation", date: "2026-11-03", wantReason: "Осенние каникулы", wantOff: true},
+		{name: "holiday", date: "2026-11-04", wantReason: "День народного единства", wantOff: true},
+		{name: "day after", date: "2026-11-05"},
+		{name: "not a date", date: "завтра"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, off := calendar.DayOff(tt.date)
+			if reason != tt.wantReason || off != tt.wantOff {
+				t.Errorf("DayOff(%s) = %q, %v, want %q, %v", tt.date, reason, off, tt.wantReason, tt.wantOff)
+			}
+		})
+	}
+}
+
+func TestCalendarMerge(t *testing.T) {
+	calendar := Calendar{
+		DaysOff:   []string{"Sunday"},
+		Vacations: []Vacation{{Name: "Зимние", Start: "2026-12-29", End: "2027-01-08"}},
+		Holidays:  []Holiday{{Name: "Праздник", Date: "2026-11-04"}},
+	}
+	other := Calendar{
+		DaysOff: []string{"Saturday"},
+		Vacations: []Vacation{
+			{Name: "Зимние каникулы", Start: "2026-12-29", End: "2027-01-08"},
+			{Name: "Осенние", Start: "2026-10-26", End: "2026-11-03"},
+		},
+		Holidays: []Holiday{{Name: "Другой праздник", Date: "2026-11-04"}, {Name: "8 марта", Date: "2027-03-08"}},
+	}
+
+	merged := calendar.Merge(other)
+
+	if !slices.Equal(merged.DaysOff, []string{"Sunday"}) {
+		t.Errorf("DaysOff = %q, want the calendar's own", merged.DaysOff)
+	}
+	wantVacations := []Vacation{
+		{Name: "Осенние", Start: "2026-10-26", End: "2026-11-03"},
+		{Name: "Зимние", Start: "2026-12-29", End: "2027-01-08"},
+	}
+	if !slices.Equal(merged.Vacations, wantVacations) {
+		t.Errorf("Vacations = %+v, want %+v", merged.Vacations, wantVacations)
+	}
+	wantHolidays := []Holiday{{Name: "Праздник", Date: "2026-11-04"}, {Name: "8 марта", Date: "2027-03-08"}}
+	if !slices.Equal(merged.Holidays, wantHolidays) {
+		t.Errorf("Holidays = %+v, want %+v", merged.Holidays, wantHolidays)
+	}
+
+	// The calendar merged into is left as it was
+	if len(calendar.Vacations) != 1 || len(calendar.Holidays) != 1 {
+		t.Errorf("Merge() changed the calendar to %+v", calendar)
+	}
+}
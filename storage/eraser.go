@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"dashka-homework-bot/blobstore"
+	"dashka-homework-bot/logger"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+
+	// historyDays is how long homework stays available for /history
+	historyDays = 30
+)
+
+// StartEraseAtMidnight drops homework older than historyDays for every user together
+// with its blobs, then sleeps until the next midnight and repeats
+func StartEraseAtMidnight(db Storage, blobs blobstore.Store) {
+	for {
+		now := time.Now()
+		oldestDate := DateKey(now.AddDate(0, 0, -historyDays))
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		users, err := db.GetAllUsers(ctx)
+		cancel()
+		if err != nil {
+			logger.Error("Error finding users: %v", err)
+		}
+
+		for _, user := range users {
+			eraseUserHomework(db, blobs, user.UserID, oldestDate)
+		}
+
+		// Calculate time until midnight
+		nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		time.Sleep(time.Until(nextMidnight))
+	}
+}
+
+// eraseUserHomework drops one user's homework before date. Each call and each blob
+// gets its own timeout, so slow deletes never starve the users after them.
+func eraseUserHomework(db Storage, blobs blobstore.Store, userID, date string) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	erased, err := db.EraseHomeworkBefore(ctx, userID, date)
+	cancel()
+	if err != nil {
+		logger.Error("Error erasing homework for user %s before %s: %v", userID, date, err)
+	}
+
+	for _, homework := range erased {
+		if homework.Content.Ref == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		if err := blobs.Delete(ctx, homework.Content.Ref); err != nil {
+			logger.Error("Error deleting blob %s: %v", homework.Content.Ref, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,16 @@
+package storage
+
+import "time"
+
+// InviteTTL is how long an invite link or a link request stays usable
+const InviteTTL = 24 * time.Hour
+
+// Invite links a parent to a student with the student's consent. An invite the
+// student creates has no ParentID and links whoever opens it first. A link request
+// sent by a parent carries the ParentID and waits for the student to approve it.
+type Invite struct {
+	Token     string    `bson:"token"`
+	StudentID string    `bson:"student_id"`
+	ParentID  string    `bson:"parent_id,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
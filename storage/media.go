@@ -0,0 +1,22 @@
+package storage
+
+// Kinds of files a submission can be. Submissions stored before other kinds were
+// accepted have no type and are photos.
+const (
+	MediaPhoto     = "photo"
+	MediaDocument  = "document"
+	MediaVoice     = "voice"
+	MediaAudio     = "audio"
+	MediaVideo     = "video"
+	MediaVideoNote = "video_note"
+	// MediaText is a written answer; it has no file and Content.Text holds it
+	MediaText = "text"
+)
+
+// MediaType returns the kind of file the content is, one of the Media constants
+func (c Content) MediaType() string {
+	if c.Type == "" {
+		return MediaPhoto
+	}
+	return c.Type
+}
@@ -0,0 +1,706 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+)
+
+var _ storage.Storage = (*HomeworkDatabase)(nil)
+
+// HomeworkDatabase keeps every user in process memory. Data is lost on restart,
+// which makes it suitable for tests and running the bot without MongoDB.
+type HomeworkDatabase struct {
+	mu        sync.RWMutex
+	users     map[string]*storage.User
+	homeworks []storage.Homework
+	invites   map[string]storage.Invite
+	nextID    int
+}
+
+func NewHomeworkDatabase() *HomeworkDatabase {
+	logger.Info("Using in-memory storage")
+	return &HomeworkDatabase{
+		users:   make(map[string]*storage.User),
+		invites: make(map[string]storage.Invite),
+	}
+}
+
+func (m *HomeworkDatabase) Close(ctx context.Context) error {
+	return nil
+}
+
+func (m *HomeworkDatabase) CreateUser(ctx context.Context, userID, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.Username = username
+		return nil
+	}
+
+	m.users[userID] = &storage.User{
+		UserID:     userID,
+		Username:   username,
+		CreatedAt:  time.Now(),
+		Schedule:   []storage.DaySchedule{},
+		Days:       []storage.LessonDay{},
+		StudentIDs: []string{},
+	}
+	return nil
+}
+
+func (m *HomeworkDatabase) GetUser(ctx context.Context, userID string) (*storage.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("failed to find user %s: %w", userID, storage.ErrNotFound)
+	}
+
+	u := copyUser(user)
+	return &u, nil
+}
+
+func (m *HomeworkDatabase) GetUserByUsername(ctx context.Context, username string) (*storage.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user := m.findByUsername(username)
+	if user == nil {
+		return nil, fmt.Errorf("user with username %s not found: %w", username, storage.ErrNotFound)
+	}
+
+	u := copyUser(user)
+	return &u, nil
+}
+
+func (m *HomeworkDatabase) GetAllUsers(ctx context.Context) ([]storage.User, error) {
+	return m.filterUsers(func(*storage.User) bool { return true }), nil
+}
+
+func (m *HomeworkDatabase) GetParents(ctx context.Context) ([]storage.User, error) {
+	return m.filterUsers(func(u *storage.User) bool { return storage.IsSupervisor(u.Role) }), nil
+}
+
+func (m *HomeworkDatabase) GetParentsOf(ctx context.Context, studentID string) ([]storage.User, error) {
+	return m.filterUsers(func(u *storage.User) bool { return slices.Contains(u.StudentIDs, studentID) }), nil
+}
+
+func (m *HomeworkDatabase) GetRemindersDue(ctx context.Context, now time.Time) ([]storage.User, error) {
+	return m.filterUsers(func(u *storage.User) bool {
+		return u.Role == storage.RoleStudent && !u.RemindersOff && !u.NextReminderAt.After(now)
+	}), nil
+}
+
+func (m *HomeworkDatabase) SetRole(ctx context.Context, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	user.Role = role
+	return nil
+}
+
+func (m *HomeworkDatabase) filterUsers(keep func(*storage.User) bool) []storage.User {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []storage.User
+	for _, user := range m.users {
+		if keep(user) {
+			users = append(users, copyUser(user))
+		}
+	}
+	return users
+}
+
+func (m *HomeworkDatabase) InitializeSchedule(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		// Mirror the Mongo upsert behaviour
+		user = &storage.User{UserID: userID, CreatedAt: time.Now(), StudentIDs: []string{}}
+		m.users[userID] = user
+	}
+
+	if len(user.Schedule) > 0 {
+		return nil
+	}
+
+	user.Schedule = storage.EmptySchedule()
+	return nil
+}
+
+func (m *HomeworkDatabase) GetScheduleForDay(ctx context.Context, userID, day string) (*storage.DaySchedule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("failed to find user %s: %w", userID, storage.ErrNotFound)
+	}
+
+	for _, schedule := range user.Schedule {
+		if schedule.DayName == day {
+			s := copyDaySchedule(schedule)
+			return &s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no schedule found for day %s: %w", day, storage.ErrNotFound)
+}
+
+func (m *HomeworkDatabase) SetSchedule(ctx context.Context, userID string, schedule []storage.DaySchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	user.Schedule = make([]storage.DaySchedule, len(schedule))
+	for i, day := range schedule {
+		user.Schedule[i] = copyDaySchedule(day)
+	}
+	user.Days = storage.SyncLessonDays(user, time.Now())
+	return nil
+}
+
+func (m *HomeworkDatabase) SetDaySchedule(ctx context.Context, userID string, day storage.DaySchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	replaced := false
+	for i := range user.Schedule {
+		if user.Schedule[i].DayName == day.DayName {
+			user.Schedule[i] = copyDaySchedule(day)
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		user.Schedule = append(user.Schedule, copyDaySchedule(day))
+	}
+
+	user.Days = storage.SyncLessonDays(user, time.Now())
+	return nil
+}
+
+func (m *HomeworkDatabase) SetSubjectAlias(ctx context.Context, userID, alias, subjectName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	if user.SubjectAliases == nil {
+		user.SubjectAliases = make(map[string]string)
+	}
+	user.SubjectAliases[alias] = subjectName
+	return nil
+}
+
+func (m *HomeworkDatabase) RemoveSubjectAlias(ctx context.Context, userID, alias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	if _, ok := user.SubjectAliases[alias]; !ok {
+		return fmt.Errorf("alias %s not found: %w", alias, storage.ErrNotFound)
+	}
+	delete(user.SubjectAliases, alias)
+	return nil
+}
+
+func (m *HomeworkDatabase) SetSummarySchedule(ctx context.Context, userID, summaryTime, timezone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	user.SummaryTime = summaryTime
+	user.Timezone = timezone
+	return nil
+}
+
+func (m *HomeworkDatabase) SetLastSummaryDate(ctx context.Context, userID, date string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	user.LastSummaryDate = date
+	return nil
+}
+
+func (m *HomeworkDatabase) SetCalendar(ctx context.Context, userID string, calendar storage.Calendar) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	c := copyCalendar(calendar)
+	user.Calendar = &c
+	return nil
+}
+
+func (m *HomeworkDatabase) SetReminders(ctx context.Context, userID string, times []string, off bool, timezone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	user.ReminderTimes = append([]string(nil), times...)
+	user.RemindersOff = off
+	user.Timezone = timezone
+	user.NextReminderAt = time.Time{}
+	return nil
+}
+
+func (m *HomeworkDatabase) SetNextReminder(ctx context.Context, userID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	user.NextReminderAt = at
+	return nil
+}
+
+func (m *HomeworkDatabase) GetLessonsForDate(ctx context.Context, userID, date string) (*storage.LessonDay, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("failed to find user %s: %w", userID, storage.ErrNotFound)
+	}
+
+	day, err := storage.FindLessonDay(user, date)
+	if err != nil {
+		return nil, err
+	}
+
+	d := copyLessonDay(day)
+	return &d, nil
+}
+
+func (m *HomeworkDatabase) SetTask(ctx context.Context, userID, date, subjectName, task string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("no matching user/date/subject found for %s/%s/%s: %w", userID, date, subjectName, storage.ErrNotFound)
+	}
+
+	day, err := m.lessonDay(user, date)
+	if err != nil {
+		return fmt.Errorf("failed to set task: %w", err)
+	}
+
+	matched := false
+	for i := range day.Subjects {
+		if day.Subjects[i].SubjectName == subjectName {
+			day.Subjects[i].Task = task
+			matched = true
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("no matching user/date/subject found for %s/%s/%s: %w", userID, date, subjectName, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *HomeworkDatabase) SaveHomework(ctx context.Context, userID, date, subjectName string, content storage.Content) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return "", fmt.Errorf("no matching user/date/subject found for %s/%s/%s: %w", userID, date, subjectName, storage.ErrNotFound)
+	}
+
+	day, err := m.lessonDay(user, date)
+	if err != nil {
+		return "", fmt.Errorf("failed to save homework: %w", err)
+	}
+
+	matched := false
+	for _, subject := range day.Subjects {
+		if subject.SubjectName == subjectName {
+			matched = true
+			break
+		}
+	}
+
+	if !matched {
+		return "", fmt.Errorf("no matching user/date/subject found for %s/%s/%s: %w", userID, date, subjectName, storage.ErrNotFound)
+	}
+
+	m.nextID++
+	homework := storage.Homework{
+		ID:         fmt.Sprintf("%d", m.nextID),
+		StudentID:  userID,
+		Date:       date,
+		Subject:    subjectName,
+		Content:    content,
+		UploadedAt: time.Now(),
+		UploadedBy: userID,
+		Review:     storage.Review{Status: storage.StatusSubmitted},
+	}
+	m.homeworks = append(m.homeworks, homework)
+
+	return homework.ID, nil
+}
+
+func (m *HomeworkDatabase) SetHomeworkFileID(ctx context.Context, homeworkID, fileID, fileUniqueID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.homeworks {
+		if m.homeworks[i].ID == homeworkID {
+			m.homeworks[i].Content.FileID = fileID
+			m.homeworks[i].Content.FileUniqueID = fileUniqueID
+			return nil
+		}
+	}
+
+	return fmt.Errorf("homework with ID %s not found: %w", homeworkID, storage.ErrNotFound)
+}
+
+func (m *HomeworkDatabase) GetHomework(ctx context.Context, homeworkID string) (*storage.Homework, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, homework := range m.homeworks {
+		if homework.ID == homeworkID {
+			return &homework, nil
+		}
+	}
+
+	return nil, fmt.Errorf("homework with ID %s not found: %w", homeworkID, storage.ErrNotFound)
+}
+
+func (m *HomeworkDatabase) RequestReview(ctx context.Context, homeworkID string) error {
+	return m.updateHomework(homeworkID, func(homework *storage.Homework) {
+		homework.Review.Requested = true
+	})
+}
+
+func (m *HomeworkDatabase) ReviewHomework(ctx context.Context, homeworkID, status, reviewerID, comment string) error {
+	return m.updateHomework(homeworkID, func(homework *storage.Homework) {
+		homework.Review.Status = status
+		homework.Review.Comment = comment
+		homework.Review.ReviewedBy = reviewerID
+		homework.Review.ReviewedAt = time.Now()
+	})
+}
+
+func (m *HomeworkDatabase) updateHomework(homeworkID string, update func(*storage.Homework)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.homeworks {
+		if m.homeworks[i].ID == homeworkID {
+			update(&m.homeworks[i])
+			return nil
+		}
+	}
+
+	return fmt.Errorf("homework with ID %s not found: %w", homeworkID, storage.ErrNotFound)
+}
+
+// lessonDay returns the stored lessons of a date, materializing them from the
+// template first if needed. Must be called with m.mu held.
+func (m *HomeworkDatabase) lessonDay(user *storage.User, date string) (*storage.LessonDay, error) {
+	for i := range user.Days {
+		if user.Days[i].Date == date {
+			return &user.Days[i], nil
+		}
+	}
+
+	day, err := storage.LessonsFromTemplate(user.Schedule, date)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Days = append(user.Days, day)
+	return &user.Days[len(user.Days)-1], nil
+}
+
+func (m *HomeworkDatabase) GetHomeworkUploadedSince(ctx context.Context, since time.Time) ([]storage.Homework, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var homeworks []storage.Homework
+	for _, homework := range m.homeworks {
+		if !homework.UploadedAt.Before(since) {
+			homeworks = append(homeworks, homework)
+		}
+	}
+	return homeworks, nil
+}
+
+func (m *HomeworkDatabase) GetParent(ctx context.Context, parentUserID string) (*storage.User, error) {
+	parent, err := m.GetUser(ctx, parentUserID)
+	if err != nil {
+		logger.Error("Error getting parent user %s: %v", parentUserID, err)
+		return nil, err
+	}
+	return parent, nil
+}
+
+func (m *HomeworkDatabase) AddStudentContact(ctx context.Context, parentUserID, studentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[studentID]; !ok {
+		return fmt.Errorf("student %s not found: %w", studentID, storage.ErrNotFound)
+	}
+
+	parent, ok := m.users[parentUserID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s", parentUserID)
+	}
+
+	for _, id := range parent.StudentIDs {
+		if id == studentID {
+			return nil
+		}
+	}
+	parent.StudentIDs = append(parent.StudentIDs, studentID)
+
+	return nil
+}
+
+func (m *HomeworkDatabase) RemoveStudentContact(ctx context.Context, parentUserID, studentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, ok := m.users[parentUserID]
+	if !ok {
+		return fmt.Errorf("no user found with ID %s: %w", parentUserID, storage.ErrNotFound)
+	}
+
+	ids := parent.StudentIDs[:0]
+	for _, id := range parent.StudentIDs {
+		if id != studentID {
+			ids = append(ids, id)
+		}
+	}
+	parent.StudentIDs = ids
+	delete(parent.StudentNames, studentID)
+
+	return nil
+}
+
+func (m *HomeworkDatabase) SetStudentName(ctx context.Context, parentUserID, studentID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, ok := m.users[parentUserID]
+	if !ok || !slices.Contains(parent.StudentIDs, studentID) {
+		return fmt.Errorf("student %s of user %s not found: %w", studentID, parentUserID, storage.ErrNotFound)
+	}
+
+	if name == "" {
+		delete(parent.StudentNames, studentID)
+		return nil
+	}
+	if parent.StudentNames == nil {
+		parent.StudentNames = make(map[string]string)
+	}
+	parent.StudentNames[studentID] = name
+	return nil
+}
+
+func (m *HomeworkDatabase) CreateInvite(ctx context.Context, invite storage.Invite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.invites[invite.Token] = invite
+	return nil
+}
+
+func (m *HomeworkDatabase) GetInvite(ctx context.Context, token string) (*storage.Invite, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invite, ok := m.invites[token]
+	if !ok || time.Now().After(invite.ExpiresAt) {
+		return nil, fmt.Errorf("invite %s not found: %w", token, storage.ErrNotFound)
+	}
+
+	return &invite, nil
+}
+
+func (m *HomeworkDatabase) TakeInvite(ctx context.Context, token string) (*storage.Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invite, ok := m.invites[token]
+	delete(m.invites, token)
+	if !ok || time.Now().After(invite.ExpiresAt) {
+		return nil, fmt.Errorf("invite %s not found: %w", token, storage.ErrNotFound)
+	}
+
+	return &invite, nil
+}
+
+func (m *HomeworkDatabase) GetHomeworkStatus(ctx context.Context, studentID, date string) ([]string, []string, map[string][]storage.Homework, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	student, ok := m.users[studentID]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("failed to get student: %s: %w", studentID, storage.ErrNotFound)
+	}
+
+	day, err := storage.FindLessonDay(student, date)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var homeworks []storage.Homework
+	for _, homework := range m.homeworks {
+		if homework.StudentID == student.UserID && homework.Date == date {
+			homeworks = append(homeworks, homework)
+		}
+	}
+
+	completedSubjects, incompleteSubjects, homeworkMap := storage.SplitHomeworkStatus(day, homeworks)
+	return completedSubjects, incompleteSubjects, homeworkMap, nil
+}
+
+func (m *HomeworkDatabase) EraseHomeworkBefore(ctx context.Context, userID, date string) ([]storage.Homework, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	days := user.Days[:0]
+	for _, day := range user.Days {
+		if day.Date >= date {
+			days = append(days, day)
+		}
+	}
+	user.Days = days
+
+	var erased []storage.Homework
+	homeworks := m.homeworks[:0]
+	for _, homework := range m.homeworks {
+		if homework.StudentID != userID || homework.Date >= date {
+			homeworks = append(homeworks, homework)
+		} else {
+			erased = append(erased, homework)
+		}
+	}
+	m.homeworks = homeworks
+
+	return erased, nil
+}
+
+// findByUsername must be called with m.mu held
+func (m *HomeworkDatabase) findByUsername(username string) *storage.User {
+	username = strings.TrimPrefix(username, "@")
+	for _, user := range m.users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func copyUser(user *storage.User) storage.User {
+	u := *user
+	u.StudentIDs = append([]string(nil), user.StudentIDs...)
+	u.ReminderTimes = append([]string(nil), user.ReminderTimes...)
+	u.Schedule = make([]storage.DaySchedule, len(user.Schedule))
+	for i, day := range user.Schedule {
+		u.Schedule[i] = copyDaySchedule(day)
+	}
+	if user.SubjectAliases != nil {
+		u.SubjectAliases = make(map[string]string, len(user.SubjectAliases))
+		for alias, subject := range user.SubjectAliases {
+			u.SubjectAliases[alias] = subject
+		}
+	}
+	if user.StudentNames != nil {
+		u.StudentNames = make(map[string]string, len(user.StudentNames))
+		for id, name := range user.StudentNames {
+			u.StudentNames[id] = name
+		}
+	}
+	if user.Calendar != nil {
+		c := copyCalendar(*user.Calendar)
+		u.Calendar = &c
+	}
+	u.Days = make([]storage.LessonDay, len(user.Days))
+	for i, day := range user.Days {
+		u.Days[i] = copyLessonDay(day)
+	}
+	return u
+}
+
+func copyDaySchedule(day storage.DaySchedule) storage.DaySchedule {
+	return storage.DaySchedule{DayName: day.DayName, Subjects: append([]storage.Subject{}, day.Subjects...)}
+}
+
+func copyLessonDay(day storage.LessonDay) storage.LessonDay {
+	return storage.LessonDay{Date: day.Date, Subjects: append([]storage.Subject{}, day.Subjects...)}
+}
+
+func copyCalendar(calendar storage.Calendar) storage.Calendar {
+	return storage.Calendar{
+		DaysOff:   append([]string{}, calendar.DaysOff...),
+		Vacations: append([]storage.Vacation{}, calendar.Vacations...),
+		Holidays:  append([]storage.Holiday{}, calendar.Holidays...),
+	}
+}
@@ -0,0 +1,308 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+)
+
+const (
+	studentID = "1"
+	parentID  = "2"
+	// monday and tuesday are dates of the test schedule
+	monday  = "2026-10-19"
+	tuesday = "2026-10-20"
+)
+
+// newTestDatabase returns a database with a student who has lessons on Monday and a
+// parent linked to them
+func newTestDatabase(t *testing.T) *HomeworkDatabase {
+	t.Helper()
+	ctx := context.Background()
+	db := NewHomeworkDatabase()
+
+	for _, id := range []string{studentID, parentID} {
+		if err := db.CreateUser(ctx, id, "user"+id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	schedule := storage.EmptySchedule()
+	for i := range schedule {
+		if schedule[i].DayName == time.Monday.String() {
+			schedule[i].Subjects = []storage.Subject{{SubjectName: "Алгебра"}, {SubjectName: "Русский"}}
+		}
+	}
+	if err := db.SetSchedule(ctx, studentID, schedule); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddStudentContact(ctx, parentID, studentID); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSaveHomework(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		date    string
+		subject string
+		wantErr error
+	}{
+		{name: "lesson of the day", userID: studentID, date: monday, subject: "Алгебра"},
+		{name: "subject not on that day", userID: studentID, date: monday, subject: "Физика", wantErr: storage.ErrNotFound},
+		{name: "day without lessons", userID: studentID, date: tuesday, subject: "Алгебра", wantErr: storage.ErrNotFound},
+		{name: "unknown user", userID: "404", date: monday, subject: "Алгебра", wantErr: storage.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDatabase(t)
+
+			id, err := db.SaveHomework(ctx, tt.userID, tt.date, tt.subject, storage.Content{Type: storage.MediaText, Text: "ответ"})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SaveHomework() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SaveHomework() error = %v", err)
+			}
+
+			homework, err := db.GetHomework(ctx, id)
+			if err != nil {
+				t.Fatalf("GetHomework() error = %v", err)
+			}
+			if homework.Subject != tt.subject || homework.Date != tt.date || homework.Review.Status != storage.StatusSubmitted {
+				t.Errorf("GetHomework() = %+v", homework)
+			}
+		})
+	}
+}
+
+func TestGetHomeworkStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		saved          []string
+		wantCompleted  []string
+		wantIncomplete []string
+	}{
+		{name: "nothing sent", wantIncomplete: []string{"Алгебра", "Русский"}},
+		{name: "one subject", saved: []string{"Русский"}, wantCompleted: []string{"Русский"}, wantIncomplete: []string{"Алгебра"}},
+		{name: "several files of a subject", saved: []string{"Алгебра", "Алгебра", "Русский"}, wantCompleted: []string{"Алгебра", "Русский"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDatabase(t)
+			for _, subject := range tt.saved {
+				if _, err := db.SaveHomework(ctx, studentID, monday, subject, storage.Content{Ref: subject}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			completed, incomplete, homeworks, err := db.GetHomeworkStatus(ctx, studentID, monday)
+			if err != nil {
+				t.Fatalf("GetHomeworkStatus() error = %v", err)
+			}
+			if !slices.Equal(completed, tt.wantCompleted) || !slices.Equal(incomplete, tt.wantIncomplete) {
+				t.Errorf("GetHomeworkStatus() = %q, %q, want %q, %q", completed, incomplete, tt.wantCompleted, tt.wantIncomplete)
+			}
+			count := 0
+			for _, subjectHomeworks := range homeworks {
+				count += len(subjectHomeworks)
+			}
+			if count != len(tt.saved) {
+				t.Errorf("GetHomeworkStatus() returned %d homeworks, want %d", count, len(tt.saved))
+			}
+		})
+	}
+}
+
+func TestSetDayScheduleAfterSubmission(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(t)
+
+	// A Monday that has passed keeps its lessons, an upcoming one follows the timetable
+	const pastMonday = "2020-01-06"
+	next := time.Now().AddDate(0, 0, 1)
+	for next.Weekday() != time.Monday {
+		next = next.AddDate(0, 0, 1)
+	}
+	upcomingMonday := storage.DateKey(next)
+
+	for _, date := range []string{pastMonday, upcomingMonday} {
+		if _, err := db.SaveHomework(ctx, studentID, date, "Алгебра", storage.Content{Ref: date}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SetTask(ctx, studentID, date, "Алгебра", "стр. 45"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timetable := storage.DaySchedule{
+		DayName:  time.Monday.String(),
+		Subjects: []storage.Subject{{SubjectName: "Алгебра"}, {SubjectName: "Физика"}},
+	}
+	if err := db.SetDaySchedule(ctx, studentID, timetable); err != nil {
+		t.Fatalf("SetDaySchedule() error = %v", err)
+	}
+
+	tests := []struct {
+		date         string
+		wantSubjects []string
+	}{
+		{date: pastMonday, wantSubjects: []string{"Алгебра", "Русский"}},
+		{date: upcomingMonday, wantSubjects: []string{"Алгебра", "Физика"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			day, err := db.GetLessonsForDate(ctx, studentID, tt.date)
+			if err != nil {
+				t.Fatalf("GetLessonsForDate() error = %v", err)
+			}
+			var subjects []string
+			for _, subject := range day.Subjects {
+				subjects = append(subjects, subject.SubjectName)
+			}
+			if !slices.Equal(subjects, tt.wantSubjects) {
+				t.Errorf("GetLessonsForDate() subjects = %q, want %q", subjects, tt.wantSubjects)
+			}
+			if day.Subjects[0].Task != "стр. 45" {
+				t.Errorf("task of %s = %q, want it kept", day.Subjects[0].SubjectName, day.Subjects[0].Task)
+			}
+
+			completed, _, _, err := db.GetHomeworkStatus(ctx, studentID, tt.date)
+			if err != nil {
+				t.Fatalf("GetHomeworkStatus() error = %v", err)
+			}
+			if !slices.Equal(completed, []string{"Алгебра"}) {
+				t.Errorf("GetHomeworkStatus() completed = %q, want the submission kept", completed)
+			}
+		})
+	}
+}
+
+func TestEraseHomeworkBefore(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     string
+		wantErased int
+		wantKept   int
+	}{
+		{name: "before the lesson", before: monday, wantErased: 0, wantKept: 2},
+		{name: "after the lesson", before: tuesday, wantErased: 2, wantKept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDatabase(t)
+			for _, subject := range []string{"Алгебра", "Русский"} {
+				if _, err := db.SaveHomework(ctx, studentID, monday, subject, storage.Content{Ref: subject}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			erased, err := db.EraseHomeworkBefore(ctx, studentID, tt.before)
+			if err != nil {
+				t.Fatalf("EraseHomeworkBefore() error = %v", err)
+			}
+			if len(erased) != tt.wantErased {
+				t.Errorf("EraseHomeworkBefore() erased %d homeworks, want %d", len(erased), tt.wantErased)
+			}
+
+			kept, err := db.GetHomeworkUploadedSince(ctx, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kept) != tt.wantKept {
+				t.Errorf("%d homeworks left, want %d", len(kept), tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestTakeInvite(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		wantErr   error
+	}{
+		{name: "valid", expiresAt: time.Now().Add(time.Hour)},
+		{name: "expired", expiresAt: time.Now().Add(-time.Minute), wantErr: storage.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDatabase(t)
+			if err := db.CreateInvite(ctx, storage.Invite{Token: "token", StudentID: studentID, ExpiresAt: tt.expiresAt}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Looking an invite up leaves it usable
+			if _, err := db.GetInvite(ctx, "token"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetInvite() error = %v, want %v", err, tt.wantErr)
+			}
+
+			invite, err := db.TakeInvite(ctx, "token")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TakeInvite() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && invite.StudentID != studentID {
+				t.Errorf("TakeInvite() = %+v", invite)
+			}
+
+			// An invite can be used only once
+			if _, err := db.TakeInvite(ctx, "token"); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("second TakeInvite() error = %v, want %v", err, storage.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestSetStudentName(t *testing.T) {
+	tests := []struct {
+		name      string
+		parentID  string
+		studentID string
+		names     []string
+		want      string
+		wantErr   error
+	}{
+		{name: "set", parentID: parentID, studentID: studentID, names: []string{"Маша"}, want: "Маша"},
+		{name: "rename", parentID: parentID, studentID: studentID, names: []string{"Маша", "Мария"}, want: "Мария"},
+		{name: "remove", parentID: parentID, studentID: studentID, names: []string{"Маша", ""}, want: ""},
+		{name: "student not linked", parentID: parentID, studentID: "404", names: []string{"Маша"}, wantErr: storage.ErrNotFound},
+		{name: "unknown parent", parentID: "404", studentID: studentID, names: []string{"Маша"}, wantErr: storage.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDatabase(t)
+
+			var err error
+			for _, name := range tt.names {
+				err = db.SetStudentName(ctx, tt.parentID, tt.studentID, name)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetStudentName() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			parent, err := db.GetUser(ctx, tt.parentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parent.StudentNames[tt.studentID]; got != tt.want {
+				t.Errorf("StudentNames[%s] = %q, want %q", tt.studentID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"dashka-homework-bot/blobstore"
+	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	homeworkCollectionMigration = "homeworks_collection_v1"
+	calendarMigration           = "calendar_v1"
+	studentIDsMigration         = "student_ids_v1"
+	rolesMigration              = "roles_v1"
+)
+
+// legacyDaysOff were hardcoded for everyone before calendars existed
+var legacyDaysOff = []string{"Sunday", "Tuesday"}
+
+// legacyPhoto is a submission that still carries its bytes in the photo field
+type legacyPhoto struct {
+	ID        string `bson:"id"`
+	StudentID string `bson:"student_id"`
+	Date      string `bson:"date"`
+	Photo     []byte `bson:"photo"`
+}
+
+// legacyEmbeddedHomework is a submission as it was embedded in the user document
+type legacyEmbeddedHomework struct {
+	Photo      []byte    `bson:"photo"`
+	UploadedAt time.Time `bson:"uploaded_at"`
+	UploadedBy string    `bson:"uploaded_by"`
+}
+
+// legacySubject is the old subject layout with submissions embedded in the user document
+type legacySubject struct {
+	SubjectName string                   `bson:"subject_name"`
+	Homeworks   []legacyEmbeddedHomework `bson:"homeworks"`
+}
+
+type legacyUser struct {
+	UserID   string `bson:"user_id"`
+	Schedule []struct {
+		DayName  string          `bson:"day_name"`
+		Subjects []legacySubject `bson:"subjects"`
+	} `bson:"schedule"`
+}
+
+// MigrateEmbeddedHomework moves submissions out of users.schedule.subjects.homeworks
+// into the homeworks collection. It records itself in the migrations collection and
+// does nothing on later runs.
+func (m *HomeworkDatabase) MigrateEmbeddedHomework(ctx context.Context) error {
+	migrations := m.database.Collection("migrations")
+
+	err := migrations.FindOne(ctx, bson.M{"name": homeworkCollectionMigration}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+
+	users := m.database.Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"schedule.subjects.homeworks.0": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("failed to find users to migrate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	moved := 0
+	for cursor.Next(ctx) {
+		var user legacyUser
+		if err := cursor.Decode(&user); err != nil {
+			return fmt.Errorf("failed to decode user: %w", err)
+		}
+
+		n, err := m.migrateUserHomework(ctx, user)
+		if err != nil {
+			return err
+		}
+		moved += n
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	// Drop the embedded arrays only after every submission has been copied
+	unset := bson.M{
+		"$unset": bson.M{
+			"schedule.$[].subjects.$[].homeworks": "",
+		},
+	}
+	if _, err := users.UpdateMany(ctx, bson.M{"schedule.subjects.homeworks": bson.M{"$exists": true}}, unset); err != nil {
+		return fmt.Errorf("failed to remove embedded homework: %w", err)
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"name": homeworkCollectionMigration, "applied_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	logger.Info("Moved %d embedded homework submissions to the homeworks collection", moved)
+	return nil
+}
+
+// migrateUserHomework copies the photo bytes as they are; MigrateHomeworkPhotos later
+// moves them into the blob store
+func (m *HomeworkDatabase) migrateUserHomework(ctx context.Context, user legacyUser) (int, error) {
+	var homeworks []bson.M
+
+	for i, day := range user.Schedule {
+		for j, subject := range day.Subjects {
+			for k, homework := range subject.Homeworks {
+				// Weekday buckets held homework for the next lesson on that weekday
+				date := nextWeekdayDate(homework.UploadedAt, day.DayName)
+				homeworks = append(homeworks, legacyHomework(user.UserID, fmt.Sprintf("s%d-%d-%d", i, j, k), date, subject.SubjectName, homework))
+			}
+		}
+	}
+
+	collection := m.database.Collection("homeworks")
+	for _, homework := range homeworks {
+		// Upserting by a deterministic ID keeps the migration safe to re-run after a crash
+		update := bson.M{"$setOnInsert": homework}
+		_, err := collection.UpdateOne(ctx, bson.M{"id": homework["id"]}, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return 0, fmt.Errorf("failed to migrate homework %s: %w", homework["id"], err)
+		}
+	}
+
+	return len(homeworks), nil
+}
+
+func legacyHomework(userID, position, date, subjectName string, homework legacyEmbeddedHomework) bson.M {
+	uploadedBy := homework.UploadedBy
+	if uploadedBy == "" {
+		uploadedBy = userID
+	}
+
+	return bson.M{
+		"id":          fmt.Sprintf("legacy-%s-%s", userID, position),
+		"student_id":  userID,
+		"date":        date,
+		"subject":     subjectName,
+		"photo":       homework.Photo,
+		"uploaded_at": homework.UploadedAt,
+		"uploaded_by": uploadedBy,
+	}
+}
+
+// nextWeekdayDate returns the first date after t that falls on the given weekday
+func nextWeekdayDate(t time.Time, dayName string) string {
+	for i := 1; i <= 7; i++ {
+		d := t.AddDate(0, 0, i)
+		if d.Weekday().String() == dayName {
+			return storage.DateKey(d)
+		}
+	}
+	return storage.DateKey(t)
+}
+
+// MigrateHomeworkPhotos moves photo bytes still stored inside homework records into
+// the blob store, leaving only the content reference, size and checksum behind.
+// Records are handled one at a time, so an interrupted run simply continues later.
+func (m *HomeworkDatabase) MigrateHomeworkPhotos(ctx context.Context, blobs blobstore.Store) error {
+	collection := m.database.Collection("homeworks")
+
+	cursor, err := collection.Find(ctx, bson.M{"photo": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("failed to find homework photos: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	moved := 0
+	for cursor.Next(ctx) {
+		var homework legacyPhoto
+		if err := cursor.Decode(&homework); err != nil {
+			return fmt.Errorf("failed to decode homework: %w", err)
+		}
+
+		checksum := blobstore.Checksum(homework.Photo)
+		content := storage.Content{
+			Ref:      storage.ContentKey(homework.StudentID, homework.Date, checksum),
+			Size:     int64(len(homework.Photo)),
+			Checksum: checksum,
+		}
+
+		if err := blobs.Put(ctx, content.Ref, bytes.NewReader(homework.Photo), content.Size); err != nil {
+			return fmt.Errorf("failed to store photo of homework %s: %w", homework.ID, err)
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"content_ref": content.Ref,
+				"size":        content.Size,
+				"checksum":    content.Checksum,
+			},
+			"$unset": bson.M{"photo": ""},
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"id": homework.ID}, update); err != nil {
+			return fmt.Errorf("failed to update homework %s: %w", homework.ID, err)
+		}
+		moved++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate homework: %w", err)
+	}
+
+	if moved > 0 {
+		logger.Info("Moved %d homework photos to the blob store", moved)
+	}
+	return nil
+}
+
+// MigrateCalendars gives users created before calendars existed the days off the bot
+// used to assume for everyone, so their summaries keep the same schedule. It records
+// itself in the migrations collection and does nothing on later runs.
+func (m *HomeworkDatabase) MigrateCalendars(ctx context.Context) error {
+	migrations := m.database.Collection("migrations")
+
+	err := migrations.FindOne(ctx, bson.M{"name": calendarMigration}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+
+	calendar := storage.Calendar{
+		DaysOff:   legacyDaysOff,
+		Vacations: []storage.Vacation{},
+		Holidays:  []storage.Holiday{},
+	}
+	update := bson.M{"$set": bson.M{"calendar": calendar}}
+	result, err := m.database.Collection("users").UpdateMany(ctx, bson.M{"calendar": bson.M{"$exists": false}}, update)
+	if err != nil {
+		return fmt.Errorf("failed to set legacy calendars: %w", err)
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"name": calendarMigration, "applied_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	logger.Info("Set legacy days off for %d users", result.ModifiedCount)
+	return nil
+}
+
+// MigrateStudentIDs replaces the "@username" contacts of parents with the user IDs of
+// those students. Contacts whose username no longer belongs to anyone are dropped and
+// logged. It records itself in the migrations collection and does nothing on later runs.
+func (m *HomeworkDatabase) MigrateStudentIDs(ctx context.Context) error {
+	migrations := m.database.Collection("migrations")
+
+	err := migrations.FindOne(ctx, bson.M{"name": studentIDsMigration}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+
+	users := m.database.Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"user_contacts": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("failed to find users to migrate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var user struct {
+			UserID       string   `bson:"user_id"`
+			UserContacts []string `bson:"user_contacts"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return fmt.Errorf("failed to decode user: %w", err)
+		}
+
+		ids := []string{}
+		for _, contact := range user.UserContacts {
+			student, err := m.GetUserByUsername(ctx, contact)
+			if err != nil {
+				logger.Warning("Dropping contact %s of user %s: %v", contact, user.UserID, err)
+				continue
+			}
+			ids = append(ids, student.UserID)
+		}
+
+		update := bson.M{
+			"$addToSet": bson.M{"student_ids": bson.M{"$each": ids}},
+			"$unset":    bson.M{"user_contacts": ""},
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"user_id": user.UserID}, update); err != nil {
+			return fmt.Errorf("failed to migrate contacts of user %s: %w", user.UserID, err)
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"name": studentIDsMigration, "applied_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	logger.Info("Linked students by user ID for %d users", migrated)
+	return nil
+}
+
+// MigrateRoles turns the is_parent flag into roles: parents become RoleParent and
+// everyone else who has no role yet RoleStudent, which is how the bot treated them.
+// It records itself in the migrations collection and does nothing on later runs.
+func (m *HomeworkDatabase) MigrateRoles(ctx context.Context) error {
+	migrations := m.database.Collection("migrations")
+
+	err := migrations.FindOne(ctx, bson.M{"name": rolesMigration}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+
+	users := m.database.Collection("users")
+	parents, err := users.UpdateMany(ctx,
+		bson.M{"is_parent": true, "role": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"role": storage.RoleParent}})
+	if err != nil {
+		return fmt.Errorf("failed to set parent roles: %w", err)
+	}
+
+	students, err := users.UpdateMany(ctx,
+		bson.M{"role": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"role": storage.RoleStudent}})
+	if err != nil {
+		return fmt.Errorf("failed to set student roles: %w", err)
+	}
+
+	if _, err := users.UpdateMany(ctx, bson.M{"is_parent": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"is_parent": ""}}); err != nil {
+		return fmt.Errorf("failed to remove is_parent: %w", err)
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"name": rolesMigration, "applied_at": time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	logger.Info("Assigned roles to %d parents and %d students", parents.ModifiedCount, students.ModifiedCount)
+	return nil
+}
@@ -0,0 +1,296 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/blobstore"
+	blobmemory "dashka-homework-bot/blobstore/memory"
+	"dashka-homework-bot/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newTestDatabase connects to a real MongoDB and uses a throwaway database:
+// MONGO_TEST_URI=mongodb://localhost:27017 go test ./storage/mongo
+func newTestDatabase(t *testing.T) *HomeworkDatabase {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect to MongoDB: %v", err)
+	}
+	database := client.Database(fmt.Sprintf("homework_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		ctx := context.Background()
+		database.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	return &HomeworkDatabase{client: client, database: database}
+}
+
+// insert adds raw documents to a collection, as an older version of the bot left them
+func insert(t *testing.T, m *HomeworkDatabase, collection string, documents ...any) {
+	t.Helper()
+	if _, err := m.database.Collection(collection).InsertMany(context.Background(), documents); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findOne returns a raw document of a collection
+func findOne(t *testing.T, m *HomeworkDatabase, collection string, filter bson.M) bson.M {
+	t.Helper()
+	var document bson.M
+	if err := m.database.Collection(collection).FindOne(context.Background(), filter).Decode(&document); err != nil {
+		t.Fatalf("failed to find %v in %s: %v", filter, collection, err)
+	}
+	return document
+}
+
+func TestNextWeekdayDate(t *testing.T) {
+	// 2024-03-06 is a Wednesday
+	uploadedAt := time.Date(2024, 3, 6, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		dayName string
+		want    string
+	}{
+		{dayName: "Thursday", want: "2024-03-07"},
+		{dayName: "Monday", want: "2024-03-11"},
+		{dayName: "Wednesday", want: "2024-03-13"},
+		// Day names were stored in English, anything else keeps the upload date
+		{dayName: "Понедельник", want: "2024-03-06"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dayName, func(t *testing.T) {
+			if got := nextWeekdayDate(uploadedAt, tt.dayName); got != tt.want {
+				t.Errorf("nextWeekdayDate(%s) = %s, want %s", tt.dayName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyHomework(t *testing.T) {
+	uploadedAt := time.Date(2024, 3, 6, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		uploadedBy     string
+		wantUploadedBy string
+	}{
+		{name: "uploaded by the student", wantUploadedBy: "1"},
+		{name: "uploaded by a parent", uploadedBy: "2", wantUploadedBy: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			homework := legacyEmbeddedHomework{Photo: []byte("photo"), UploadedAt: uploadedAt, UploadedBy: tt.uploadedBy}
+			got := legacyHomework("1", "s0-1-2", "2024-03-11", "Алгебра", homework)
+			if got["id"] != "legacy-1-s0-1-2" || got["student_id"] != "1" || got["date"] != "2024-03-11" || got["subject"] != "Алгебра" {
+				t.Errorf("legacyHomework() = %v", got)
+			}
+			if got["uploaded_by"] != tt.wantUploadedBy {
+				t.Errorf("uploaded_by = %v, want %s", got["uploaded_by"], tt.wantUploadedBy)
+			}
+		})
+	}
+}
+
+func TestMigrateEmbeddedHomework(t *testing.T) {
+	ctx := context.Background()
+	m := newTestDatabase(t)
+
+	// 2024-03-06 is a Wednesday, the next Monday lesson is on 2024-03-11
+	uploadedAt := time.Date(2024, 3, 6, 18, 0, 0, 0, time.UTC)
+	insert(t, m, "users", bson.M{
+		"user_id": "1",
+		"schedule": bson.A{
+			bson.M{"day_name": "Monday", "subjects": bson.A{
+				bson.M{"subject_name": "Алгебра", "homeworks": bson.A{
+					bson.M{"photo": []byte("page 1"), "uploaded_at": uploadedAt},
+					bson.M{"photo": []byte("page 2"), "uploaded_at": uploadedAt, "uploaded_by": "2"},
+				}},
+			}},
+		},
+	})
+
+	// A second run, as after a restart, must not copy anything twice
+	for i := 0; i < 2; i++ {
+		if err := m.MigrateEmbeddedHomework(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := m.database.Collection("homeworks").CountDocuments(ctx, bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("homeworks = %d, want 2", count)
+	}
+
+	homework := findOne(t, m, "homeworks", bson.M{"id": "legacy-1-s0-0-1"})
+	if homework["date"] != "2024-03-11" || homework["subject"] != "Алгебра" || homework["uploaded_by"] != "2" {
+		t.Errorf("migrated homework = %v", homework)
+	}
+
+	left, err := m.database.Collection("users").CountDocuments(ctx, bson.M{"schedule.subjects.homeworks": bson.M{"$exists": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("%d users still embed homework", left)
+	}
+}
+
+func TestMigrateHomeworkPhotos(t *testing.T) {
+	ctx := context.Background()
+	m := newTestDatabase(t)
+	blobs := blobmemory.NewStore()
+
+	photo := []byte("page 1")
+	insert(t, m, "homeworks",
+		bson.M{"id": "1", "student_id": "1", "date": "2024-03-11", "subject": "Алгебра", "photo": photo},
+		bson.M{"id": "2", "student_id": "1", "date": "2024-03-11", "subject": "Русский", "content_ref": "kept"},
+	)
+
+	if err := m.MigrateHomeworkPhotos(ctx, blobs); err != nil {
+		t.Fatal(err)
+	}
+
+	homework, err := m.GetHomework(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRef := storage.ContentKey("1", "2024-03-11", blobstore.Checksum(photo))
+	if homework.Content.Ref != wantRef || homework.Content.Size != int64(len(photo)) {
+		t.Errorf("content = %+v, want ref %s", homework.Content, wantRef)
+	}
+	if _, ok := findOne(t, m, "homeworks", bson.M{"id": "1"})["photo"]; ok {
+		t.Error("photo bytes are still in the homework record")
+	}
+
+	reader, err := blobs.Get(ctx, wantRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if data, err := io.ReadAll(reader); err != nil || string(data) != string(photo) {
+		t.Errorf("blob = %q, %v, want %q", data, err, photo)
+	}
+
+	if kept, err := m.GetHomework(ctx, "2"); err != nil || kept.Content.Ref != "kept" {
+		t.Errorf("GetHomework(2) = %+v, %v, want it untouched", kept, err)
+	}
+}
+
+func TestMigrateCalendars(t *testing.T) {
+	ctx := context.Background()
+	m := newTestDatabase(t)
+
+	insert(t, m, "users",
+		bson.M{"user_id": "1"},
+		bson.M{"user_id": "2", "calendar": storage.Calendar{DaysOff: []string{"Saturday"}}},
+	)
+	if err := m.MigrateCalendars(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Users created after the migration start without days off
+	insert(t, m, "users", bson.M{"user_id": "3"})
+	if err := m.MigrateCalendars(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		userID string
+		// wantDaysOff is nil when the user should have no calendar of their own
+		wantDaysOff []string
+	}{
+		{userID: "1", wantDaysOff: legacyDaysOff},
+		{userID: "2", wantDaysOff: []string{"Saturday"}},
+		{userID: "3"},
+	}
+	for _, tt := range tests {
+		user, err := m.GetUser(ctx, tt.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (user.Calendar == nil) != (tt.wantDaysOff == nil) {
+			t.Errorf("calendar of %s = %+v, want days off %v", tt.userID, user.Calendar, tt.wantDaysOff)
+			continue
+		}
+		if user.Calendar != nil && !slices.Equal(user.Calendar.DaysOff, tt.wantDaysOff) {
+			t.Errorf("days off of %s = %v, want %v", tt.userID, user.Calendar.DaysOff, tt.wantDaysOff)
+		}
+	}
+}
+
+func TestMigrateStudentIDs(t *testing.T) {
+	ctx := context.Background()
+	m := newTestDatabase(t)
+
+	insert(t, m, "users",
+		bson.M{"user_id": "1", "username": "student"},
+		bson.M{"user_id": "2", "username": "parent", "user_contacts": bson.A{"@student", "@gone"}},
+	)
+	if err := m.MigrateStudentIDs(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	parent, err := m.GetUser(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Contacts nobody has the username of any more are dropped
+	if !slices.Equal(parent.StudentIDs, []string{"1"}) {
+		t.Errorf("student IDs = %v, want [1]", parent.StudentIDs)
+	}
+	if _, ok := findOne(t, m, "users", bson.M{"user_id": "2"})["user_contacts"]; ok {
+		t.Error("user_contacts is still set")
+	}
+}
+
+func TestMigrateRoles(t *testing.T) {
+	ctx := context.Background()
+	m := newTestDatabase(t)
+
+	insert(t, m, "users",
+		bson.M{"user_id": "1", "is_parent": false},
+		bson.M{"user_id": "2", "is_parent": true},
+		bson.M{"user_id": "3"},
+		bson.M{"user_id": "4", "is_parent": true, "role": storage.RoleTutor},
+	)
+	if err := m.MigrateRoles(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		userID   string
+		wantRole string
+	}{
+		{userID: "1", wantRole: storage.RoleStudent},
+		{userID: "2", wantRole: storage.RoleParent},
+		{userID: "3", wantRole: storage.RoleStudent},
+		{userID: "4", wantRole: storage.RoleTutor},
+	}
+	for _, tt := range tests {
+		user := findOne(t, m, "users", bson.M{"user_id": tt.userID})
+		if user["role"] != tt.wantRole {
+			t.Errorf("role of %s = %v, want %s", tt.userID, user["role"], tt.wantRole)
+		}
+		if _, ok := user["is_parent"]; ok {
+			t.Errorf("is_parent of %s is still set", tt.userID)
+		}
+	}
+}
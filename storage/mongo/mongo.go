@@ -3,56 +3,30 @@ package mongo
 import (
 	"context"
 	"dashka-homework-bot/logger"
+	"dashka-homework-bot/storage"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const (
 	defaultTimeout = 10 * time.Second
-	summaryTime    = 21
-	weekend1       = "Sunday"
-	weekend2       = "Tuesday"
+	// syncAttempts is how often syncing lesson days starts over after a concurrent change
+	syncAttempts = 5
 )
 
-type User struct {
-	UserID       string        `bson:"user_id"`
-	Username     string        `bson:"username"`
-	Schedule     []DaySchedule `bson:"schedule"`
-	CreatedAt    time.Time     `bson:"created_at"`
-	UserContacts []string      `bson:"user_contacts"`
-	IsParent     bool          `bson:"is_parent"`
-}
+var _ storage.Storage = (*HomeworkDatabase)(nil)
 
 type HomeworkDatabase struct {
 	client   *mongo.Client
 	database *mongo.Database
 }
 
-type DaySchedule struct {
-	DayName  string    `bson:"day_name"`
-	Subjects []Subject `bson:"subjects"`
-}
-
-type Subject struct {
-	SubjectName string     `bson:"subject_name"`
-	Homeworks   []Homework `bson:"homeworks"`
-}
-
-type Homework struct {
-	Photo      []byte    `bson:"photo"`
-	UploadedAt time.Time `bson:"uploaded_at"`
-	ID         string    `bson:"id"`
-	UploadedBy string    `bson:"uploaded_by"`
-}
-
 func NewHomeworkDatabase(ctx context.Context, connectionString string) (*HomeworkDatabase, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
@@ -69,10 +43,46 @@ func NewHomeworkDatabase(ctx context.Context, connectionString string) (*Homewor
 	database := client.Database("homework_tracker")
 	logger.Info("Connected to MongoDB successfully")
 
-	return &HomeworkDatabase{
+	db := &HomeworkDatabase{
 		client:   client,
 		database: database,
-	}, nil
+	}
+
+	if err := db.ensureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (m *HomeworkDatabase) ensureIndexes(ctx context.Context) error {
+	homeworks := m.database.Collection("homeworks")
+
+	_, err := homeworks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "date", Value: 1}, {Key: "subject", Value: 1}, {Key: "uploaded_at", Value: 1}}},
+		{Keys: bson.D{{Key: "date", Value: 1}}},
+		{Keys: bson.D{{Key: "uploaded_at", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create homework indexes: %w", err)
+	}
+
+	_, err = m.database.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "student_ids", Value: 1}}})
+	if err != nil {
+		return fmt.Errorf("failed to create user indexes: %w", err)
+	}
+
+	// Expired invites are also checked on use, the TTL index only removes them eventually
+	_, err = m.database.Collection("invites").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create invite indexes: %w", err)
+	}
+
+	return nil
 }
 
 func (m *HomeworkDatabase) Close(ctx context.Context) error {
@@ -91,7 +101,7 @@ func (m *HomeworkDatabase) InitializeSchedule(ctx context.Context, userID string
 	collection := m.database.Collection("users")
 
 	// First check if user already has a schedule
-	var existingUser User
+	var existingUser storage.User
 	filter := bson.M{"user_id": userID}
 	err := collection.FindOne(ctx, filter).Decode(&existingUser)
 	if err == nil && len(existingUser.Schedule) > 0 {
@@ -99,74 +109,7 @@ func (m *HomeworkDatabase) InitializeSchedule(ctx context.Context, userID string
 		return nil
 	}
 
-	schedules := []DaySchedule{
-		{
-			DayName: "Monday",
-			Subjects: []Subject{
-				{SubjectName: "Русский", Homeworks: []Homework{}},
-				{SubjectName: "История", Homeworks: []Homework{}},
-				{SubjectName: "Геометрия", Homeworks: []Homework{}},
-				{SubjectName: "Английский", Homeworks: []Homework{}},
-				{SubjectName: "ИЗО", Homeworks: []Homework{}},
-				{SubjectName: "Литература", Homeworks: []Homework{}},
-			},
-		},
-		// {
-		// 	DayName: "Tuesday",
-		// 	Subjects: []Subject{
-		// 		{SubjectName: "Chemistry", Homeworks: []Homework{}},
-		// 		{SubjectName: "Biology", Homeworks: []Homework{}},
-		// 		{SubjectName: "English", Homeworks: []Homework{}},
-		// 		{SubjectName: "Geography", Homeworks: []Homework{}},
-		// 	},
-		// },
-		{
-			DayName: "Wednesday",
-			Subjects: []Subject{
-				{SubjectName: "Физика", Homeworks: []Homework{}},
-				{SubjectName: "Информатика", Homeworks: []Homework{}},
-				{SubjectName: "Физкультура", Homeworks: []Homework{}},
-				{SubjectName: "Алгебра", Homeworks: []Homework{}},
-				{SubjectName: "Английский", Homeworks: []Homework{}},
-				{SubjectName: "Общество", Homeworks: []Homework{}},
-			},
-		},
-		{
-			DayName: "Thursday",
-			Subjects: []Subject{
-				{SubjectName: "География", Homeworks: []Homework{}},
-				{SubjectName: "Алгебра", Homeworks: []Homework{}},
-				{SubjectName: "Биология", Homeworks: []Homework{}},
-				{SubjectName: "Вероятность и статистика", Homeworks: []Homework{}},
-				{SubjectName: "История", Homeworks: []Homework{}},
-				{SubjectName: "Русский", Homeworks: []Homework{}},
-				{SubjectName: "Литература", Homeworks: []Homework{}},
-				{SubjectName: "Россия мои горизонты", Homeworks: []Homework{}},
-			},
-		},
-		{
-			DayName: "Friday",
-			Subjects: []Subject{
-				{SubjectName: "Труд", Homeworks: []Homework{}},
-				{SubjectName: "Физкультура", Homeworks: []Homework{}},
-				{SubjectName: "Алгебра", Homeworks: []Homework{}},
-				{SubjectName: "Геометрия", Homeworks: []Homework{}},
-				{SubjectName: "Английский", Homeworks: []Homework{}},
-			},
-		},
-		{
-			DayName: "Saturday",
-			Subjects: []Subject{
-				{SubjectName: "Физика", Homeworks: []Homework{}},
-				{SubjectName: "Алгебра", Homeworks: []Homework{}},
-				{SubjectName: "Русский", Homeworks: []Homework{}},
-				{SubjectName: "Английский", Homeworks: []Homework{}},
-				{SubjectName: "Русский", Homeworks: []Homework{}},
-				{SubjectName: "География", Homeworks: []Homework{}},
-				{SubjectName: "Музыка", Homeworks: []Homework{}},
-			},
-		},
-	}
+	schedules := storage.EmptySchedule()
 
 	update := bson.M{
 		"$set": bson.M{
@@ -190,7 +133,7 @@ func (m *HomeworkDatabase) CreateUser(ctx context.Context, userID, username stri
 	collection := m.database.Collection("users")
 
 	// Check if user already exists
-	var existingUser User
+	var existingUser storage.User
 	filter := bson.M{"user_id": userID}
 	err := collection.FindOne(ctx, filter).Decode(&existingUser)
 	if err == nil {
@@ -209,13 +152,13 @@ func (m *HomeworkDatabase) CreateUser(ctx context.Context, userID, username stri
 
 	// Only create new user if they don't exist
 	if err == mongo.ErrNoDocuments {
-		user := User{
-			UserID:       userID,
-			Username:     username,
-			CreatedAt:    time.Now(),
-			Schedule:     []DaySchedule{}, // Empty schedule, will be initialized separately
-			UserContacts: []string{},
-			IsParent:     false,
+		user := storage.User{
+			UserID:     userID,
+			Username:   username,
+			CreatedAt:  time.Now(),
+			Schedule:   []storage.DaySchedule{}, // Empty schedule, will be initialized separately
+			Days:       []storage.LessonDay{},
+			StudentIDs: []string{},
 		}
 
 		_, err = collection.InsertOne(ctx, user)
@@ -228,23 +171,103 @@ func (m *HomeworkDatabase) CreateUser(ctx context.Context, userID, username stri
 	return fmt.Errorf("error checking for existing user: %w", err)
 }
 
-func (m *HomeworkDatabase) GetUser(ctx context.Context, userID string) (*User, error) {
+func (m *HomeworkDatabase) GetUser(ctx context.Context, userID string) (*storage.User, error) {
 	collection := m.database.Collection("users")
 
-	var user User
+	var user storage.User
 	filter := bson.M{"user_id": userID}
 	err := collection.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("failed to find user %s: %w", userID, storage.ErrNotFound)
+		}
 		return nil, fmt.Errorf("failed to find user %s: %w", userID, err)
 	}
 
 	return &user, nil
 }
 
-func (m *HomeworkDatabase) GetScheduleForDay(ctx context.Context, userID, day string) (*DaySchedule, error) {
+func (m *HomeworkDatabase) GetUserByUsername(ctx context.Context, username string) (*storage.User, error) {
+	collection := m.database.Collection("users")
+
+	var user storage.User
+	filter := bson.M{"username": strings.TrimPrefix(username, "@")}
+	err := collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("user with username %s not found: %w", username, storage.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find user %s: %w", username, err)
+	}
+
+	return &user, nil
+}
+
+func (m *HomeworkDatabase) GetAllUsers(ctx context.Context) ([]storage.User, error) {
+	return m.findUsers(ctx, bson.M{})
+}
+
+func (m *HomeworkDatabase) GetParents(ctx context.Context) ([]storage.User, error) {
+	return m.findUsers(ctx, bson.M{"role": bson.M{"$in": storage.SupervisorRoles}})
+}
+
+func (m *HomeworkDatabase) GetParentsOf(ctx context.Context, studentID string) ([]storage.User, error) {
+	return m.findUsers(ctx, bson.M{"student_ids": studentID})
+}
+
+func (m *HomeworkDatabase) GetRemindersDue(ctx context.Context, now time.Time) ([]storage.User, error) {
+	return m.findUsers(ctx, bson.M{
+		"role":          storage.RoleStudent,
+		"reminders_off": bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"next_reminder_at": bson.M{"$exists": false}},
+			{"next_reminder_at": bson.M{"$lte": now}},
+		},
+	})
+}
+
+func (m *HomeworkDatabase) SetRole(ctx context.Context, userID, role string) error {
+	collection := m.database.Collection("users")
+
+	update := bson.M{
+		"$set": bson.M{
+			"role": role,
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to set role for user %s: %w", userID, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *HomeworkDatabase) findUsers(ctx context.Context, filter bson.M) ([]storage.User, error) {
 	collection := m.database.Collection("users")
 
-	var user User
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []storage.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (m *HomeworkDatabase) GetScheduleForDay(ctx context.Context, userID, day string) (*storage.DaySchedule, error) {
+	collection := m.database.Collection("users")
+
+	var user storage.User
 	filter := bson.M{"user_id": userID}
 	err := collection.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
@@ -257,396 +280,714 @@ func (m *HomeworkDatabase) GetScheduleForDay(ctx context.Context, userID, day st
 		}
 	}
 
-	return nil, fmt.Errorf("no schedule found for day %s", day)
+	return nil, fmt.Errorf("no schedule found for day %s: %w", day, storage.ErrNotFound)
 }
 
-func (m *HomeworkDatabase) SaveHomework(ctx context.Context, userID, dayName, subjectName string, photoData []byte) (string, error) {
+func (m *HomeworkDatabase) SetSchedule(ctx context.Context, userID string, schedule []storage.DaySchedule) error {
 	collection := m.database.Collection("users")
 
-	homeworkID := fmt.Sprintf("%s-%s-%s-%d", userID, dayName, subjectName, time.Now().Unix())
+	update := bson.M{
+		"$set": bson.M{
+			"schedule": schedule,
+		},
+	}
 
-	homework := Homework{
-		Photo:      photoData,
-		UploadedAt: time.Now(),
-		ID:         homeworkID,
-		UploadedBy: userID,
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to set schedule for user %s: %w", userID, err)
 	}
 
-	filter := bson.M{
-		"user_id": userID,
-		"schedule": bson.M{
-			"$elemMatch": bson.M{
-				"day_name": dayName,
-				"subjects.subject_name": bson.M{
-					"$regex":   subjectName,
-					"$options": "i",
-				},
-			},
-		},
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
 	}
 
+	return m.syncLessonDays(ctx, userID)
+}
+
+func (m *HomeworkDatabase) SetDaySchedule(ctx context.Context, userID string, day storage.DaySchedule) error {
+	collection := m.database.Collection("users")
+
+	// Replace the subjects of an existing day first
+	filter := bson.M{
+		"user_id":           userID,
+		"schedule.day_name": day.DayName,
+	}
 	update := bson.M{
-		"$push": bson.M{
-			"schedule.$[day].subjects.$[subject].homeworks": homework,
+		"$set": bson.M{
+			"schedule.$.subjects": day.Subjects,
 		},
 	}
 
-	arrayFilters := options.Update().SetArrayFilters(options.ArrayFilters{
-		Filters: []interface{}{
-			bson.M{"day.day_name": dayName},
-			bson.M{"subject.subject_name": bson.M{"$regex": subjectName, "$options": "i"}},
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to set schedule for user %s, day %s: %w", userID, day.DayName, err)
+	}
+	if result.MatchedCount > 0 {
+		return m.syncLessonDays(ctx, userID)
+	}
+
+	// The day is missing from the schedule, append it
+	update = bson.M{
+		"$push": bson.M{
+			"schedule": day,
 		},
-	})
+	}
 
-	result, err := collection.UpdateOne(ctx, filter, update, arrayFilters)
+	result, err = collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 	if err != nil {
-		return "", fmt.Errorf("failed to save homework: %w", err)
+		return fmt.Errorf("failed to add day %s for user %s: %w", day.DayName, userID, err)
 	}
 
 	if result.MatchedCount == 0 {
-		return "", fmt.Errorf("no matching user/day/subject found for %s/%s/%s", userID, dayName, subjectName)
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
 	}
 
-	return homeworkID, nil
+	return m.syncLessonDays(ctx, userID)
 }
 
-func (m *HomeworkDatabase) GetHomework(ctx context.Context, userID, dayName, subjectName string, homeworkID string) (*Homework, error) {
+// syncLessonDays brings the user's upcoming stored days in line with the timetable.
+// The days are only replaced if nobody changed them since they were read, e.g. by a
+// task or submission from the student's chat; otherwise the sync starts over.
+func (m *HomeworkDatabase) syncLessonDays(ctx context.Context, userID string) error {
 	collection := m.database.Collection("users")
 
-	filter := bson.M{
-		"user_id": userID,
-		"schedule": bson.M{
-			"$elemMatch": bson.M{
-				"day_name": dayName,
+	for attempt := 0; attempt < syncAttempts; attempt++ {
+		var raw bson.Raw
+		if err := collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&raw); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return fmt.Errorf("failed to find user %s: %w", userID, storage.ErrNotFound)
+			}
+			return fmt.Errorf("failed to find user %s: %w", userID, err)
+		}
+
+		var user storage.User
+		if err := bson.Unmarshal(raw, &user); err != nil {
+			return fmt.Errorf("failed to decode user %s: %w", userID, err)
+		}
+		if len(user.Days) == 0 {
+			return nil
+		}
+
+		// The days are compared as stored, so field order and legacy fields can't break the match
+		filter := bson.M{
+			"user_id": userID,
+			"days":    raw.Lookup("days"),
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"days": storage.SyncLessonDays(&user, time.Now()),
 			},
+		}
+
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("failed to sync lessons of user %s: %w", userID, err)
+		}
+		if result.MatchedCount > 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to sync lessons of user %s: days kept changing", userID)
+}
+
+func (m *HomeworkDatabase) SetSubjectAlias(ctx context.Context, userID, alias, subjectName string) error {
+	collection := m.database.Collection("users")
+
+	// Aliases are normalized to letters, digits and spaces, so they are safe as field names
+	update := bson.M{
+		"$set": bson.M{
+			"subject_aliases." + alias: subjectName,
 		},
 	}
 
-	var user User
-	err := collection.FindOne(ctx, filter).Decode(&user)
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("no user found with ID %s", userID)
-		}
-		return nil, fmt.Errorf("failed to get user: %v", err)
+		return fmt.Errorf("failed to set alias for user %s: %w", userID, err)
 	}
 
-	for _, schedule := range user.Schedule {
-		if schedule.DayName == dayName {
-			for _, subject := range schedule.Subjects {
-				if subject.SubjectName == subjectName {
-					for _, homework := range subject.Homeworks {
-						if homework.ID == homeworkID {
-							return &homework, nil
-						}
-					}
-					return nil, fmt.Errorf("homework with ID %s not found", homeworkID)
-				}
-			}
-			return nil, fmt.Errorf("subject %s not found for day %s", subjectName, dayName)
-		}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
 	}
 
-	return nil, fmt.Errorf("day %s not found in schedule", dayName)
+	return nil
 }
 
-func (m *HomeworkDatabase) GetAllHomework(ctx context.Context, userID, dayName, subjectName string) ([]Homework, error) {
+func (m *HomeworkDatabase) RemoveSubjectAlias(ctx context.Context, userID, alias string) error {
 	collection := m.database.Collection("users")
 
 	filter := bson.M{
-		"user_id": userID,
-		"schedule": bson.M{
-			"$elemMatch": bson.M{
-				"day_name": dayName,
-			},
+		"user_id":                  userID,
+		"subject_aliases." + alias: bson.M{"$exists": true},
+	}
+	update := bson.M{
+		"$unset": bson.M{
+			"subject_aliases." + alias: "",
 		},
 	}
 
-	var user User
-	err := collection.FindOne(ctx, filter).Decode(&user)
+	result, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("no user found with ID %s", userID)
-		}
-		return nil, fmt.Errorf("failed to get user: %v", err)
+		return fmt.Errorf("failed to remove alias for user %s: %w", userID, err)
 	}
 
-	for _, schedule := range user.Schedule {
-		if schedule.DayName == dayName {
-			for _, subject := range schedule.Subjects {
-				if subject.SubjectName == subjectName {
-					return subject.Homeworks, nil
-				}
-			}
-			return nil, fmt.Errorf("subject %s not found for day %s", subjectName, dayName)
-		}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("alias %s not found: %w", alias, storage.ErrNotFound)
 	}
 
-	return nil, fmt.Errorf("day %s not found in schedule", dayName)
+	return nil
 }
 
-func (m *HomeworkDatabase) GetParent(ctx context.Context, parentUserID string) (*User, error) {
+func (m *HomeworkDatabase) SetSummarySchedule(ctx context.Context, userID, summaryTime, timezone string) error {
 	collection := m.database.Collection("users")
 
-	var parent User
-	err := collection.FindOne(ctx, bson.M{"user_id": parentUserID}).Decode(&parent)
+	update := bson.M{
+		"$set": bson.M{
+			"summary_time": summaryTime,
+			"timezone":     timezone,
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 	if err != nil {
-		logger.Error("Error getting parent user %s: %v", parentUserID, err)
-		return nil, err
+		return fmt.Errorf("failed to set summary schedule for user %s: %w", userID, err)
 	}
 
-	return &parent, nil
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	return nil
 }
 
-func (m *HomeworkDatabase) AddStudentContact(ctx context.Context, parentUserID, studentUsername string) error {
+func (m *HomeworkDatabase) SetLastSummaryDate(ctx context.Context, userID, date string) error {
 	collection := m.database.Collection("users")
 
-	// Verify and format student username
-	if !strings.HasPrefix(studentUsername, "@") {
-		studentUsername = "@" + studentUsername
+	update := bson.M{
+		"$set": bson.M{
+			"last_summary_date": date,
+		},
 	}
 
-	// First, verify that the student exists in our database
-	var studentUser User
-	err := collection.FindOne(ctx, bson.M{"username": strings.TrimPrefix(studentUsername, "@")}).Decode(&studentUser)
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return fmt.Errorf("student with username %s not found", studentUsername)
-		}
-		return fmt.Errorf("failed to verify student: %v", err)
+		return fmt.Errorf("failed to set last summary date for user %s: %w", userID, err)
 	}
 
-	// Add student to parent's contacts
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *HomeworkDatabase) SetCalendar(ctx context.Context, userID string, calendar storage.Calendar) error {
+	collection := m.database.Collection("users")
+
 	update := bson.M{
-		"$addToSet": bson.M{
-			"user_contacts": studentUsername,
-		},
 		"$set": bson.M{
-			"is_parent": true,
+			"calendar": calendar,
 		},
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"user_id": parentUserID}, update)
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 	if err != nil {
-		return fmt.Errorf("failed to add student contact: %v", err)
+		return fmt.Errorf("failed to set calendar for user %s: %w", userID, err)
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("no user found with ID %s", parentUserID)
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
 	}
 
 	return nil
 }
 
-func (m *HomeworkDatabase) GetHomeworkStatus(ctx context.Context, studentUsername, dayName string) ([]string, []string, map[string][]Homework, error) {
+func (m *HomeworkDatabase) SetReminders(ctx context.Context, userID string, times []string, off bool, timezone string) error {
 	collection := m.database.Collection("users")
 
-	// Find the student by username
-	var student User
-	err := collection.FindOne(ctx, bson.M{"username": strings.TrimPrefix(studentUsername, "@")}).Decode(&student)
+	update := bson.M{
+		"$set": bson.M{
+			"reminder_times": times,
+			"reminders_off":  off,
+			"timezone":       timezone,
+		},
+		"$unset": bson.M{
+			"next_reminder_at": "",
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get student: %v", err)
+		return fmt.Errorf("failed to set reminders for user %s: %w", userID, err)
 	}
 
-	var completedSubjects []string
-	var incompleteSubjects []string
-	homeworkMap := make(map[string][]Homework)
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
 
-	// Find schedule for the specified day
-	for _, schedule := range student.Schedule {
-		if schedule.DayName == dayName {
-			for _, subject := range schedule.Subjects {
-				if len(subject.Homeworks) > 0 {
-					completedSubjects = append(completedSubjects, subject.SubjectName)
-					homeworkMap[subject.SubjectName] = subject.Homeworks
-				} else {
-					incompleteSubjects = append(incompleteSubjects, subject.SubjectName)
-				}
-			}
-			break
+	return nil
+}
+
+func (m *HomeworkDatabase) SetNextReminder(ctx context.Context, userID string, at time.Time) error {
+	collection := m.database.Collection("users")
+
+	update := bson.M{
+		"$set": bson.M{
+			"next_reminder_at": at,
+		},
+	}
+	if at.IsZero() {
+		update = bson.M{
+			"$unset": bson.M{
+				"next_reminder_at": "",
+			},
 		}
 	}
 
-	return completedSubjects, incompleteSubjects, homeworkMap, nil
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to set next reminder for user %s: %w", userID, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", userID, storage.ErrNotFound)
+	}
+
+	return nil
 }
 
-func (m *HomeworkDatabase) EraseHomeworkForOldDay(ctx context.Context, userID, dayName string) error {
+func (m *HomeworkDatabase) GetLessonsForDate(ctx context.Context, userID, date string) (*storage.LessonDay, error) {
+	user, err := m.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	day, err := storage.FindLessonDay(user, date)
+	if err != nil {
+		return nil, err
+	}
+
+	return &day, nil
+}
+
+// ensureLessonDay materializes the lessons of a date from the weekday template,
+// so later timetable edits do not change which lessons past dates had
+func (m *HomeworkDatabase) ensureLessonDay(ctx context.Context, userID, date string) (storage.LessonDay, error) {
 	collection := m.database.Collection("users")
 
+	user, err := m.GetUser(ctx, userID)
+	if err != nil {
+		return storage.LessonDay{}, err
+	}
+
+	day, err := storage.FindLessonDay(user, date)
+	if err != nil {
+		return storage.LessonDay{}, err
+	}
+
+	// The $ne guard keeps concurrent uploads from adding the same date twice
 	filter := bson.M{
-		"user_id":           userID,
-		"schedule.day_name": dayName,
+		"user_id":   userID,
+		"days.date": bson.M{"$ne": date},
+	}
+	update := bson.M{
+		"$push": bson.M{
+			"days": day,
+		},
+	}
+
+	if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+		return storage.LessonDay{}, fmt.Errorf("failed to add lessons for %s: %w", date, err)
+	}
+
+	return day, nil
+}
+
+func (m *HomeworkDatabase) SetTask(ctx context.Context, userID, date, subjectName, task string) error {
+	collection := m.database.Collection("users")
+
+	day, err := m.ensureLessonDay(ctx, userID, date)
+	if err != nil {
+		return fmt.Errorf("failed to set task: %w", err)
+	}
+
+	if !hasSubject(day, subjectName) {
+		return fmt.Errorf("no matching user/date/subject found for %s/%s/%s: %w", userID, date, subjectName, storage.ErrNotFound)
 	}
 
 	update := bson.M{
 		"$set": bson.M{
-			"schedule.$[day].subjects.$[].homeworks": []interface{}{},
+			"days.$[d].subjects.$[s].task": task,
 		},
 	}
-
-	arrayFilters := options.Update().SetArrayFilters(options.ArrayFilters{
+	if task == "" {
+		update = bson.M{
+			"$unset": bson.M{
+				"days.$[d].subjects.$[s].task": "",
+			},
+		}
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
 		Filters: []interface{}{
-			bson.M{"day.day_name": dayName},
+			bson.M{"d.date": date},
+			bson.M{"s.subject_name": subjectName},
 		},
 	})
 
-	result, err := collection.UpdateOne(ctx, filter, update, arrayFilters)
+	if _, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update, opts); err != nil {
+		return fmt.Errorf("failed to set task for %s/%s/%s: %w", userID, date, subjectName, err)
+	}
+
+	return nil
+}
+
+func (m *HomeworkDatabase) SaveHomework(ctx context.Context, userID, date, subjectName string, content storage.Content) (string, error) {
+	collection := m.database.Collection("homeworks")
+
+	day, err := m.ensureLessonDay(ctx, userID, date)
+	if err != nil {
+		return "", fmt.Errorf("failed to save homework: %w", err)
+	}
+
+	if !hasSubject(day, subjectName) {
+		return "", fmt.Errorf("no matching user/date/subject found for %s/%s/%s: %w", userID, date, subjectName, storage.ErrNotFound)
+	}
+
+	homework := storage.Homework{
+		ID:         primitive.NewObjectID().Hex(),
+		StudentID:  userID,
+		Date:       date,
+		Subject:    subjectName,
+		Content:    content,
+		UploadedAt: time.Now(),
+		UploadedBy: userID,
+		Review:     storage.Review{Status: storage.StatusSubmitted},
+	}
+
+	if _, err := collection.InsertOne(ctx, homework); err != nil {
+		return "", fmt.Errorf("failed to save homework: %w", err)
+	}
+
+	return homework.ID, nil
+}
+
+func (m *HomeworkDatabase) SetHomeworkFileID(ctx context.Context, homeworkID, fileID, fileUniqueID string) error {
+	collection := m.database.Collection("homeworks")
+
+	update := bson.M{
+		"$set": bson.M{
+			"file_id":        fileID,
+			"file_unique_id": fileUniqueID,
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"id": homeworkID}, update)
 	if err != nil {
-		return fmt.Errorf("failed to erase homework for user %s, day %s: %w", userID, dayName, err)
+		return fmt.Errorf("failed to update file ID of homework %s: %w", homeworkID, err)
 	}
 
 	if result.MatchedCount == 0 {
-		logger.Error("No schedule found for user: %s, day: %s", userID, dayName)
+		return fmt.Errorf("homework with ID %s not found: %w", homeworkID, storage.ErrNotFound)
 	}
 
 	return nil
 }
 
-func (m *HomeworkDatabase) StartEraseAtMidnight() {
-	// This method would need to be modified to handle all users
-	for {
-		now := time.Now()
-		oldDay := now.AddDate(0, 0, -5).Weekday().String()
+func (m *HomeworkDatabase) RequestReview(ctx context.Context, homeworkID string) error {
+	return m.updateHomework(ctx, homeworkID, bson.M{
+		"$set": bson.M{
+			"review_requested": true,
+		},
+	})
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+func (m *HomeworkDatabase) ReviewHomework(ctx context.Context, homeworkID, status, reviewerID, comment string) error {
+	return m.updateHomework(ctx, homeworkID, bson.M{
+		"$set": bson.M{
+			"status":         status,
+			"review_comment": comment,
+			"reviewed_by":    reviewerID,
+			"reviewed_at":    time.Now(),
+		},
+	})
+}
 
-		// Get all users and erase for each
-		collection := m.database.Collection("users")
-		cursor, err := collection.Find(ctx, bson.M{})
-		if err != nil {
-			logger.Error("Error finding users: %v", err)
-			cancel()
-			continue
-		}
+func (m *HomeworkDatabase) updateHomework(ctx context.Context, homeworkID string, update bson.M) error {
+	collection := m.database.Collection("homeworks")
+
+	result, err := collection.UpdateOne(ctx, bson.M{"id": homeworkID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update homework %s: %w", homeworkID, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("homework with ID %s not found: %w", homeworkID, storage.ErrNotFound)
+	}
 
-		var users []User
-		if err := cursor.All(ctx, &users); err != nil {
-			logger.Error("Error decoding users: %v", err)
-			cancel()
-			continue
+	return nil
+}
+
+func hasSubject(day storage.LessonDay, subjectName string) bool {
+	for _, subject := range day.Subjects {
+		if subject.SubjectName == subjectName {
+			return true
 		}
+	}
+	return false
+}
 
-		for _, user := range users {
-			if err := m.EraseHomeworkForOldDay(ctx, user.UserID, oldDay); err != nil {
-				logger.Error("Error erasing homework for user %s, day %s: %v", user.UserID, oldDay, err)
-			}
+func (m *HomeworkDatabase) GetHomework(ctx context.Context, homeworkID string) (*storage.Homework, error) {
+	collection := m.database.Collection("homeworks")
+
+	var homework storage.Homework
+	err := collection.FindOne(ctx, bson.M{"id": homeworkID}).Decode(&homework)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("homework with ID %s not found: %w", homeworkID, storage.ErrNotFound)
 		}
+		return nil, fmt.Errorf("failed to get homework: %w", err)
+	}
 
-		cancel()
+	return &homework, nil
+}
+
+// GetHomeworkForDate returns every submission of a student for the lessons of a date
+func (m *HomeworkDatabase) GetHomeworkForDate(ctx context.Context, userID, date string) ([]storage.Homework, error) {
+	collection := m.database.Collection("homeworks")
+
+	opts := options.Find().SetSort(bson.D{{Key: "uploaded_at", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"student_id": userID, "date": date}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find homework: %w", err)
+	}
+	defer cursor.Close(ctx)
 
-		// Calculate time until midnight
-		nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		time.Sleep(time.Until(nextMidnight))
+	var homeworks []storage.Homework
+	if err := cursor.All(ctx, &homeworks); err != nil {
+		return nil, fmt.Errorf("failed to decode homework: %w", err)
 	}
+
+	return homeworks, nil
 }
 
-func (m *HomeworkDatabase) SendDailySummaries(bot *tgbotapi.BotAPI) error {
-	ctx := context.Background()
-	collection := m.database.Collection("users")
+func (m *HomeworkDatabase) GetHomeworkUploadedSince(ctx context.Context, since time.Time) ([]storage.Homework, error) {
+	collection := m.database.Collection("homeworks")
 
-	// Find all parent users
-	filter := bson.M{"is_parent": true}
-	cursor, err := collection.Find(ctx, filter)
+	opts := options.Find().SetSort(bson.D{{Key: "uploaded_at", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"uploaded_at": bson.M{"$gte": since}}, opts)
 	if err != nil {
-		return fmt.Errorf("failed to find parents: %w", err)
+		return nil, fmt.Errorf("failed to find homework: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	nextDay := time.Now().Add(24 * time.Hour).Weekday().String()
-	// Skip weekends
-	if nextDay == weekend1 || nextDay == weekend2 {
-		logger.Info("Skipping summary notifications for %s", nextDay)
-		return nil
+	var homeworks []storage.Homework
+	if err := cursor.All(ctx, &homeworks); err != nil {
+		return nil, fmt.Errorf("failed to decode homework: %w", err)
 	}
 
-	var parents []User
-	if err := cursor.All(ctx, &parents); err != nil {
-		return fmt.Errorf("failed to decode parents: %w", err)
+	return homeworks, nil
+}
+
+func (m *HomeworkDatabase) GetParent(ctx context.Context, parentUserID string) (*storage.User, error) {
+	collection := m.database.Collection("users")
+
+	var parent storage.User
+	err := collection.FindOne(ctx, bson.M{"user_id": parentUserID}).Decode(&parent)
+	if err != nil {
+		logger.Error("Error getting parent user %s: %v", parentUserID, err)
+		return nil, err
 	}
 
-	for _, parent := range parents {
-		// For each parent's student contacts
-		for _, studentUsername := range parent.UserContacts {
-			completed, incomplete, homeworks, err := m.GetHomeworkStatus(ctx, studentUsername, nextDay)
-			if err != nil {
-				logger.Error("Error getting homework status for student %s: %v", studentUsername, err)
-				continue
-			}
+	return &parent, nil
+}
 
-			// Create summary message
-			summaryMsg := fmt.Sprintf("Статус домашнего задания для %s:\n\n", studentUsername)
+func (m *HomeworkDatabase) AddStudentContact(ctx context.Context, parentUserID, studentID string) error {
+	collection := m.database.Collection("users")
 
-			if len(completed) > 0 {
-				summaryMsg += "✅ Начата домашка:\n"
-				for _, subject := range completed {
-					summaryMsg += fmt.Sprintf("- %s\n", subject)
-				}
-			}
+	// First, verify that the student exists in our database
+	err := collection.FindOne(ctx, bson.M{"user_id": studentID}).Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("student %s not found: %w", studentID, storage.ErrNotFound)
+		}
+		return fmt.Errorf("failed to verify student: %w", err)
+	}
 
-			if len(incomplete) > 0 {
-				summaryMsg += "\n❌ Не начата домашка:\n"
-				for _, subject := range incomplete {
-					summaryMsg += fmt.Sprintf("- %s\n", subject)
-				}
-			}
+	// Add student to parent's contacts
+	update := bson.M{
+		"$addToSet": bson.M{
+			"student_ids": studentID,
+		},
+	}
 
-			// Convert parent.UserID to int64 for telegram API
-			parentID, err := strconv.ParseInt(parent.UserID, 10, 64)
-			if err != nil {
-				logger.Error("Error converting parent ID: %v", err)
-				continue
-			}
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": parentUserID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to add student contact: %w", err)
+	}
 
-			// Send text summary
-			msg := tgbotapi.NewMessage(parentID, summaryMsg)
-			if _, err := bot.Send(msg); err != nil {
-				logger.Error("Error sending summary to parent %s: %v", parent.UserID, err)
-				continue
-			}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s", parentUserID)
+	}
 
-			// Send homework photos
-			for subject, homeworkList := range homeworks {
-				photoMsg := fmt.Sprintf("\n📚 Сегодняшняя домашка по %s:", subject)
-				msg := tgbotapi.NewMessage(parentID, photoMsg)
-				bot.Send(msg)
-
-				for _, homework := range homeworkList {
-					photo := tgbotapi.NewPhoto(parentID, tgbotapi.FileBytes{
-						Name:  "homework.jpg",
-						Bytes: homework.Photo,
-					})
-					photo.Caption = fmt.Sprintf("Предмет: %s\nЗагружено в: %s",
-						subject,
-						homework.UploadedAt.Format("15:04 02.01.2006"))
-
-					if _, err := bot.Send(photo); err != nil {
-						logger.Error("Error sending homework photo: %v", err)
-					}
-				}
-			}
+	return nil
+}
+
+func (m *HomeworkDatabase) RemoveStudentContact(ctx context.Context, parentUserID, studentID string) error {
+	collection := m.database.Collection("users")
+
+	update := bson.M{
+		"$pull": bson.M{
+			"student_ids": studentID,
+		},
+		"$unset": bson.M{
+			"student_names." + studentID: "",
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": parentUserID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to remove student contact: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no user found with ID %s: %w", parentUserID, storage.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *HomeworkDatabase) SetStudentName(ctx context.Context, parentUserID, studentID, name string) error {
+	collection := m.database.Collection("users")
+
+	// User IDs are digits only, so they are safe as field names
+	update := bson.M{
+		"$set": bson.M{
+			"student_names." + studentID: name,
+		},
+	}
+	if name == "" {
+		update = bson.M{
+			"$unset": bson.M{
+				"student_names." + studentID: "",
+			},
 		}
 	}
 
+	result, err := collection.UpdateOne(ctx, bson.M{"user_id": parentUserID, "student_ids": studentID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to set student name: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("student %s of user %s not found: %w", studentID, parentUserID, storage.ErrNotFound)
+	}
+
 	return nil
 }
 
-// Add this method to start the daily summary scheduler
-func (m *HomeworkDatabase) StartDailySummaries(bot *tgbotapi.BotAPI) {
-	go func() {
-		for {
-			now := time.Now()
-			next := time.Date(now.Year(), now.Month(), now.Day(), summaryTime, 0, 0, 0, now.Location())
-			if now.After(next) {
-				next = next.Add(24 * time.Hour)
-			}
+func (m *HomeworkDatabase) CreateInvite(ctx context.Context, invite storage.Invite) error {
+	collection := m.database.Collection("invites")
 
-			// Wait until next scheduled time
-			time.Sleep(time.Until(next))
+	if _, err := collection.InsertOne(ctx, invite); err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
 
-			// Send summaries
-			if err := m.SendDailySummaries(bot); err != nil {
-				logger.Error("Error sending daily summaries: %v", err)
-			}
+	return nil
+}
+
+func (m *HomeworkDatabase) GetInvite(ctx context.Context, token string) (*storage.Invite, error) {
+	collection := m.database.Collection("invites")
+
+	var invite storage.Invite
+	filter := bson.M{"token": token, "expires_at": bson.M{"$gt": time.Now()}}
+	err := collection.FindOne(ctx, filter).Decode(&invite)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("invite %s not found: %w", token, storage.ErrNotFound)
 		}
-	}()
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+
+	return &invite, nil
+}
+
+func (m *HomeworkDatabase) TakeInvite(ctx context.Context, token string) (*storage.Invite, error) {
+	collection := m.database.Collection("invites")
+
+	var invite storage.Invite
+	filter := bson.M{"token": token, "expires_at": bson.M{"$gt": time.Now()}}
+	err := collection.FindOneAndDelete(ctx, filter).Decode(&invite)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("invite %s not found: %w", token, storage.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to take invite: %w", err)
+	}
+
+	return &invite, nil
+}
+
+func (m *HomeworkDatabase) GetHomeworkStatus(ctx context.Context, studentID, date string) ([]string, []string, map[string][]storage.Homework, error) {
+	student, err := m.GetUser(ctx, studentID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get student: %w", err)
+	}
+
+	day, err := storage.FindLessonDay(student, date)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	homeworks, err := m.GetHomeworkForDate(ctx, student.UserID, date)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	completedSubjects, incompleteSubjects, homeworkMap := storage.SplitHomeworkStatus(day, homeworks)
+	return completedSubjects, incompleteSubjects, homeworkMap, nil
+}
+
+// EraseHomeworkBefore drops the lessons and homework of every date earlier than date.
+// The erased submissions are returned so their blobs can be deleted.
+func (m *HomeworkDatabase) EraseHomeworkBefore(ctx context.Context, userID, date string) ([]storage.Homework, error) {
+	collection := m.database.Collection("users")
+
+	update := bson.M{
+		"$pull": bson.M{
+			"days": bson.M{"date": bson.M{"$lt": date}},
+		},
+	}
+
+	_, err := collection.UpdateOne(ctx, bson.M{"user_id": userID}, update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to erase lessons for user %s before %s: %w", userID, date, err)
+	}
+
+	homeworks := m.database.Collection("homeworks")
+	filter := bson.M{
+		"student_id": userID,
+		"date":       bson.M{"$lt": date},
+	}
+
+	cursor, err := homeworks.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find homework for user %s before %s: %w", userID, date, err)
+	}
+	defer cursor.Close(ctx)
+
+	var erased []storage.Homework
+	if err := cursor.All(ctx, &erased); err != nil {
+		return nil, fmt.Errorf("failed to decode homework: %w", err)
+	}
+
+	if _, err := homeworks.DeleteMany(ctx, filter); err != nil {
+		return nil, fmt.Errorf("failed to erase homework for user %s before %s: %w", userID, date, err)
+	}
+
+	return erased, nil
+}
+
+// Database exposes the underlying database for the GridFS blob store
+func (m *HomeworkDatabase) Database() *mongo.Database {
+	return m.database
 }
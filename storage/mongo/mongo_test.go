@@ -0,0 +1,74 @@
+package mongo
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"dashka-homework-bot/storage"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSetDayScheduleKeepsTasks(t *testing.T) {
+	ctx := context.Background()
+	m := newTestDatabase(t)
+	const studentID = "1"
+
+	if err := m.CreateUser(ctx, studentID, "student"); err != nil {
+		t.Fatal(err)
+	}
+	schedule := storage.EmptySchedule()
+	for i := range schedule {
+		schedule[i].Subjects = []storage.Subject{{SubjectName: "Алгебра"}, {SubjectName: "Русский"}}
+	}
+	if err := m.SetSchedule(ctx, studentID, schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	next := time.Now().AddDate(0, 0, 1)
+	for next.Weekday() != time.Monday {
+		next = next.AddDate(0, 0, 1)
+	}
+	monday := storage.DateKey(next)
+	if err := m.SetTask(ctx, studentID, monday, "Алгебра", "стр. 45"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stored day written by an older version, with fields in another order, still syncs
+	legacy := bson.D{{Key: "subjects", Value: bson.A{bson.D{{Key: "subject_name", Value: "Русский"}}}}, {Key: "date", Value: "2099-01-05"}}
+	if _, err := m.database.Collection("users").UpdateOne(ctx, bson.M{"user_id": studentID}, bson.M{"$push": bson.M{"days": legacy}}); err != nil {
+		t.Fatal(err)
+	}
+
+	timetable := storage.DaySchedule{
+		DayName:  time.Monday.String(),
+		Subjects: []storage.Subject{{SubjectName: "Алгебра"}, {SubjectName: "Физика"}},
+	}
+	if err := m.SetDaySchedule(ctx, studentID, timetable); err != nil {
+		t.Fatalf("SetDaySchedule() error = %v", err)
+	}
+
+	for _, date := range []string{monday, "2099-01-05"} {
+		day, err := m.GetLessonsForDate(ctx, studentID, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var subjects []string
+		for _, subject := range day.Subjects {
+			subjects = append(subjects, subject.SubjectName)
+		}
+		if !slices.Equal(subjects, []string{"Алгебра", "Физика"}) {
+			t.Errorf("subjects on %s = %q, want the new timetable", date, subjects)
+		}
+	}
+
+	day, err := m.GetLessonsForDate(ctx, studentID, monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if day.Subjects[0].Task != "стр. 45" {
+		t.Errorf("task = %q, want it kept", day.Subjects[0].Task)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// Review states of a single submission
+const (
+	StatusSubmitted = "submitted"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+)
+
+// Review states of a subject, derived from its submissions
+const (
+	SubjectStarted        = "started"
+	SubjectAwaitingReview = "awaiting_review"
+	SubjectApproved       = "approved"
+	SubjectNeedsRedo      = "needs_redo"
+)
+
+// Review is a parent's verdict on a submission. An empty Status means submitted.
+type Review struct {
+	Status string `bson:"status,omitempty"`
+	// Requested is set once the submission was sent to a parent with review buttons
+	Requested  bool      `bson:"review_requested,omitempty"`
+	Comment    string    `bson:"review_comment,omitempty"`
+	ReviewedBy string    `bson:"reviewed_by,omitempty"`
+	ReviewedAt time.Time `bson:"reviewed_at,omitempty"`
+}
+
+// SubjectReviewStatus sums up the submissions of one subject. Only submissions
+// uploaded after the latest rejection count: if there are none, the subject needs
+// redoing. Otherwise one approval approves the subject, and without one it is awaiting
+// review once a parent has been asked, or just started.
+func SubjectReviewStatus(homeworks []Homework) string {
+	sorted := append([]Homework(nil), homeworks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].UploadedAt.Before(sorted[j].UploadedAt) })
+
+	var recent []Homework
+	for _, homework := range sorted {
+		if homework.Review.Status == StatusRejected {
+			recent = nil
+			continue
+		}
+		recent = append(recent, homework)
+	}
+
+	if len(recent) == 0 {
+		if len(sorted) > 0 {
+			return SubjectNeedsRedo
+		}
+		return ""
+	}
+
+	status := SubjectStarted
+	for _, homework := range recent {
+		switch {
+		case homework.Review.Status == StatusApproved:
+			return SubjectApproved
+		case homework.Review.Requested:
+			status = SubjectAwaitingReview
+		}
+	}
+	return status
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubjectReviewStatus(t *testing.T) {
+	start := time.Date(2026, 10, 20, 18, 0, 0, 0, time.UTC)
+	// homework is a submission uploaded minutes after start
+	homework := func(minutes int, review Review) Homework {
+		return Homework{UploadedAt: start.Add(time.Duration(minutes) * time.Minute), Review: review}
+	}
+	requested := Review{Status: StatusSubmitted, Requested: true}
+	approved := Review{Status: StatusApproved}
+	rejected := Review{Status: StatusRejected}
+
+	tests := []struct {
+		name      string
+		homeworks []Homework
+		want      string
+	}{
+		{name: "nothing submitted", want: ""},
+		{name: "submitted", homeworks: []Homework{homework(0, Review{Status: StatusSubmitted})}, want: SubjectStarted},
+		{name: "sent to a parent", homeworks: []Homework{homework(0, Review{}), homework(1, requested)}, want: SubjectAwaitingReview},
+		{name: "approved", homeworks: []Homework{homework(0, requested), homework(1, approved)}, want: SubjectApproved},
+		{name: "rejected", homeworks: []Homework{homework(0, rejected)}, want: SubjectNeedsRedo},
+		{name: "redone after rejection", homeworks: []Homework{homework(0, rejected), homework(1, requested)}, want: SubjectAwaitingReview},
+		{name: "approval before rejection", homeworks: []Homework{homework(0, approved), homework(1, rejected)}, want: SubjectNeedsRedo},
+		{name: "out of order", homeworks: []Homework{homework(2, Review{}), homework(1, rejected), homework(0, approved)}, want: SubjectStarted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SubjectReviewStatus(tt.homeworks); got != tt.want {
+				t.Errorf("SubjectReviewStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
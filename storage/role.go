@@ -0,0 +1,23 @@
+package storage
+
+// Roles a user picks when they first start the bot, and RoleAdmin, which only another
+// admin can give. Admins configured by the operator keep whichever role they picked.
+const (
+	RoleStudent = "student"
+	RoleParent  = "parent"
+	RoleTutor   = "tutor"
+	RoleAdmin   = "admin"
+)
+
+// SupervisorRoles may link students and receive their homework and summaries
+var SupervisorRoles = []string{RoleParent, RoleTutor}
+
+// IsSupervisor reports whether the role is one of SupervisorRoles
+func IsSupervisor(role string) bool {
+	for _, r := range SupervisorRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DateLayout is the format of LessonDay.Date
+	DateLayout = "2006-01-02"
+	// TimeLayout is the format of User.SummaryTime
+	TimeLayout = "15:04"
+	// DefaultSummaryTime is when parents get the daily summary unless they chose otherwise
+	DefaultSummaryTime = "21:00"
+)
+
+// DefaultReminderTimes are when students are reminded about missing homework unless
+// they chose otherwise
+var DefaultReminderTimes = []string{"18:00", "20:00"}
+
+// ErrNotFound is returned when a requested user, day or subject does not exist
+var ErrNotFound = errors.New("not found")
+
+type User struct {
+	UserID    string        `bson:"user_id"`
+	Username  string        `bson:"username"`
+	Schedule  []DaySchedule `bson:"schedule"`
+	Days      []LessonDay   `bson:"days"`
+	CreatedAt time.Time     `bson:"created_at"`
+	// StudentIDs are the user IDs of the students linked to a parent
+	StudentIDs []string `bson:"student_ids"`
+	// StudentNames are the names a parent gave their students, by student user ID
+	StudentNames map[string]string `bson:"student_names,omitempty"`
+	// Role is one of the Role constants; empty until the user picks one
+	Role string `bson:"role,omitempty"`
+	// SubjectAliases maps a normalized nickname such as "матеша" to a subject name
+	SubjectAliases map[string]string `bson:"subject_aliases,omitempty"`
+	// SummaryTime is the parent's local time of the daily summary, e.g. "20:30"
+	SummaryTime string `bson:"summary_time,omitempty"`
+	// LastSummaryDate is the parent's local date of the last daily summary sent to them
+	LastSummaryDate string `bson:"last_summary_date,omitempty"`
+	// Timezone is an IANA name such as "Europe/Moscow"; empty means the server's zone
+	Timezone string `bson:"timezone,omitempty"`
+	// ReminderTimes are the student's local times of evening reminders; nil means
+	// DefaultReminderTimes
+	ReminderTimes []string `bson:"reminder_times,omitempty"`
+	RemindersOff  bool     `bson:"reminders_off,omitempty"`
+	// NextReminderAt is when the student's next reminder is due; zero means it has not
+	// been worked out yet
+	NextReminderAt time.Time `bson:"next_reminder_at,omitempty"`
+	// Calendar is the student's school calendar; nil means DefaultDaysOff only
+	Calendar *Calendar `bson:"calendar,omitempty"`
+}
+
+// DaySchedule is the weekly timetable template for one weekday
+type DaySchedule struct {
+	DayName  string    `bson:"day_name"`
+	Subjects []Subject `bson:"subjects"`
+}
+
+// LessonDay holds the lessons of one calendar date. It is generated from the
+// weekday template the first time homework is saved for that date. Timetable edits
+// are synced into upcoming days only, so they do not rewrite history.
+type LessonDay struct {
+	Date     string    `bson:"date"`
+	Subjects []Subject `bson:"subjects"`
+}
+
+type Subject struct {
+	SubjectName string `bson:"subject_name"`
+	// Task is what was assigned, e.g. "стр. 45 №3-7". Only lessons of a LessonDay have it.
+	Task string `bson:"task,omitempty"`
+}
+
+// Content points at the bytes of a submission kept in the blob store. FileID and
+// FileUniqueID identify the same file on Telegram's servers, so it can be re-sent
+// without uploading the bytes again. Text answers have no blob, only Text.
+type Content struct {
+	Ref          string `bson:"content_ref"`
+	Size         int64  `bson:"size"`
+	Checksum     string `bson:"checksum"`
+	FileID       string `bson:"file_id,omitempty"`
+	FileUniqueID string `bson:"file_unique_id,omitempty"`
+	// Type is one of the Media constants; use MediaType to read it
+	Type string `bson:"media_type,omitempty"`
+	// FileName is the name a document or audio file was sent with
+	FileName string `bson:"file_name,omitempty"`
+	Text     string `bson:"text,omitempty"`
+}
+
+// Homework is a single submission, stored apart from the user document
+type Homework struct {
+	ID         string    `bson:"id"`
+	StudentID  string    `bson:"student_id"`
+	Date       string    `bson:"date"`
+	Subject    string    `bson:"subject"`
+	Content    Content   `bson:",inline"`
+	UploadedAt time.Time `bson:"uploaded_at"`
+	UploadedBy string    `bson:"uploaded_by"`
+	Review     Review    `bson:",inline"`
+}
+
+// Storage is the persistence layer used by handlers and the updater
+type Storage interface {
+	CreateUser(ctx context.Context, userID, username string) error
+	GetUser(ctx context.Context, userID string) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetAllUsers(ctx context.Context) ([]User, error)
+	// GetParents returns the users with one of SupervisorRoles
+	GetParents(ctx context.Context) ([]User, error)
+	// GetParentsOf returns the users linked to the student, whatever their role
+	GetParentsOf(ctx context.Context, studentID string) ([]User, error)
+	// GetRemindersDue returns the students with reminders on whose next reminder is
+	// due at now or has not been worked out yet
+	GetRemindersDue(ctx context.Context, now time.Time) ([]User, error)
+	SetRole(ctx context.Context, userID, role string) error
+	InitializeSchedule(ctx context.Context, userID string) error
+	GetScheduleForDay(ctx context.Context, userID, day string) (*DaySchedule, error)
+	SetSchedule(ctx context.Context, userID string, schedule []DaySchedule) error
+	SetDaySchedule(ctx context.Context, userID string, day DaySchedule) error
+	SetSubjectAlias(ctx context.Context, userID, alias, subjectName string) error
+	RemoveSubjectAlias(ctx context.Context, userID, alias string) error
+	SetSummarySchedule(ctx context.Context, userID, summaryTime, timezone string) error
+	SetLastSummaryDate(ctx context.Context, userID, date string) error
+	SetCalendar(ctx context.Context, userID string, calendar Calendar) error
+	// SetReminders sets the student's reminder times and the time zone they are in.
+	// The next reminder is worked out again.
+	SetReminders(ctx context.Context, userID string, times []string, off bool, timezone string) error
+	// SetNextReminder sets when the student's next reminder is due; zero has it worked
+	// out again
+	SetNextReminder(ctx context.Context, userID string, at time.Time) error
+	GetLessonsForDate(ctx context.Context, userID, date string) (*LessonDay, error)
+	SetTask(ctx context.Context, userID, date, subjectName, task string) error
+	SaveHomework(ctx context.Context, userID, date, subjectName string, content Content) (string, error)
+	SetHomeworkFileID(ctx context.Context, homeworkID, fileID, fileUniqueID string) error
+	GetHomework(ctx context.Context, homeworkID string) (*Homework, error)
+	// GetHomeworkUploadedSince returns every submission uploaded at or after since
+	GetHomeworkUploadedSince(ctx context.Context, since time.Time) ([]Homework, error)
+	RequestReview(ctx context.Context, homeworkID string) error
+	ReviewHomework(ctx context.Context, homeworkID, status, reviewerID, comment string) error
+	GetHomeworkStatus(ctx context.Context, studentID, date string) ([]string, []string, map[string][]Homework, error)
+	AddStudentContact(ctx context.Context, parentUserID, studentID string) error
+	RemoveStudentContact(ctx context.Context, parentUserID, studentID string) error
+	// SetStudentName sets the name the parent sees for a student; an empty name removes it
+	SetStudentName(ctx context.Context, parentUserID, studentID, name string) error
+	CreateInvite(ctx context.Context, invite Invite) error
+	// GetInvite returns an invite without using it up. Expired invites are reported
+	// as ErrNotFound.
+	GetInvite(ctx context.Context, token string) (*Invite, error)
+	// TakeInvite returns an invite and deletes it, so it can be used only once.
+	// Expired invites are reported as ErrNotFound.
+	TakeInvite(ctx context.Context, token string) (*Invite, error)
+	GetParent(ctx context.Context, parentUserID string) (*User, error)
+	EraseHomeworkBefore(ctx context.Context, userID, date string) ([]Homework, error)
+	Close(ctx context.Context) error
+}
+
+// ContentKey is the blob store key of a submission. Identical files uploaded by the
+// same student for the same date share one blob.
+func ContentKey(userID, date, checksum string) string {
+	return fmt.Sprintf("%s/%s/%s", userID, date, checksum)
+}
+
+// DateKey formats t as a LessonDay date
+func DateKey(t time.Time) string {
+	return t.Format(DateLayout)
+}
+
+// LessonsFromTemplate builds the lessons of a date from the weekday timetable
+func LessonsFromTemplate(schedule []DaySchedule, date string) (LessonDay, error) {
+	t, err := time.Parse(DateLayout, date)
+	if err != nil {
+		return LessonDay{}, fmt.Errorf("invalid date %q: %w", date, err)
+	}
+
+	day := LessonDay{Date: date, Subjects: []Subject{}}
+	for _, template := range schedule {
+		if template.DayName != t.Weekday().String() {
+			continue
+		}
+		for _, subject := range template.Subjects {
+			day.Subjects = append(day.Subjects, Subject{SubjectName: subject.SubjectName})
+		}
+		break
+	}
+	return day, nil
+}
+
+// SyncLessonDays rebuilds the user's stored days from today on out of the current
+// timetable, so timetable edits reach upcoming dates that already have homework or
+// tasks. Tasks of subjects still on the timetable are kept, earlier days stay as
+// they were.
+func SyncLessonDays(user *User, now time.Time) []LessonDay {
+	loc := time.Local
+	if user.Timezone != "" {
+		if l, err := time.LoadLocation(user.Timezone); err == nil {
+			loc = l
+		}
+	}
+	today := DateKey(now.In(loc))
+
+	days := make([]LessonDay, 0, len(user.Days))
+	for _, day := range user.Days {
+		if day.Date < today {
+			days = append(days, day)
+			continue
+		}
+
+		synced, err := LessonsFromTemplate(user.Schedule, day.Date)
+		if err != nil {
+			days = append(days, day)
+			continue
+		}
+		tasks := make(map[string]string)
+		for _, subject := range day.Subjects {
+			if subject.Task != "" {
+				tasks[subject.SubjectName] = subject.Task
+			}
+		}
+		for i := range synced.Subjects {
+			synced.Subjects[i].Task = tasks[synced.Subjects[i].SubjectName]
+		}
+		days = append(days, synced)
+	}
+	return days
+}
+
+// FindLessonDay returns the materialized lessons of a date, falling back to the template
+func FindLessonDay(user *User, date string) (LessonDay, error) {
+	for _, day := range user.Days {
+		if day.Date == date {
+			return day, nil
+		}
+	}
+	return LessonsFromTemplate(user.Schedule, date)
+}
+
+// SplitHomeworkStatus sorts the lessons of a day into subjects with and without homework
+func SplitHomeworkStatus(day LessonDay, homeworks []Homework) ([]string, []string, map[string][]Homework) {
+	var completedSubjects []string
+	var incompleteSubjects []string
+	homeworkMap := make(map[string][]Homework)
+
+	for _, homework := range homeworks {
+		homeworkMap[homework.Subject] = append(homeworkMap[homework.Subject], homework)
+	}
+
+	for _, subject := range day.Subjects {
+		if len(homeworkMap[subject.SubjectName]) > 0 {
+			completedSubjects = append(completedSubjects, subject.SubjectName)
+		} else {
+			incompleteSubjects = append(incompleteSubjects, subject.SubjectName)
+		}
+	}
+
+	return completedSubjects, incompleteSubjects, homeworkMap
+}
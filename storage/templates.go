@@ -0,0 +1,82 @@
+package storage
+
+import "time"
+
+// ScheduleTemplates maps a template name to a constructor of its weekly timetable.
+// New users start with the empty one and may switch with /template.
+var ScheduleTemplates = map[string]func() []DaySchedule{
+	"пустое": EmptySchedule,
+	"пример": exampleSchedule,
+}
+
+// EmptySchedule returns a week with every day present and no lessons
+func EmptySchedule() []DaySchedule {
+	schedule := make([]DaySchedule, 0, 7)
+	for d := time.Monday; d <= time.Saturday; d++ {
+		schedule = append(schedule, DaySchedule{DayName: d.String(), Subjects: []Subject{}})
+	}
+	return append(schedule, DaySchedule{DayName: time.Sunday.String(), Subjects: []Subject{}})
+}
+
+// exampleSchedule is the timetable the bot originally shipped with
+func exampleSchedule() []DaySchedule {
+	return []DaySchedule{
+		{
+			DayName: "Monday",
+			Subjects: []Subject{
+				{SubjectName: "Русский"},
+				{SubjectName: "История"},
+				{SubjectName: "Геометрия"},
+				{SubjectName: "Английский"},
+				{SubjectName: "ИЗО"},
+				{SubjectName: "Литература"},
+			},
+		},
+		{
+			DayName: "Wednesday",
+			Subjects: []Subject{
+				{SubjectName: "Физика"},
+				{SubjectName: "Информатика"},
+				{SubjectName: "Физкультура"},
+				{SubjectName: "Алгебра"},
+				{SubjectName: "Английский"},
+				{SubjectName: "Общество"},
+			},
+		},
+		{
+			DayName: "Thursday",
+			Subjects: []Subject{
+				{SubjectName: "География"},
+				{SubjectName: "Алгебра"},
+				{SubjectName: "Биология"},
+				{SubjectName: "Вероятность и статистика"},
+				{SubjectName: "История"},
+				{SubjectName: "Русский"},
+				{SubjectName: "Литература"},
+				{SubjectName: "Россия мои горизонты"},
+			},
+		},
+		{
+			DayName: "Friday",
+			Subjects: []Subject{
+				{SubjectName: "Труд"},
+				{SubjectName: "Физкультура"},
+				{SubjectName: "Алгебра"},
+				{SubjectName: "Геометрия"},
+				{SubjectName: "Английский"},
+			},
+		},
+		{
+			DayName: "Saturday",
+			Subjects: []Subject{
+				{SubjectName: "Физика"},
+				{SubjectName: "Алгебра"},
+				{SubjectName: "Русский"},
+				{SubjectName: "Английский"},
+				{SubjectName: "Русский"},
+				{SubjectName: "География"},
+				{SubjectName: "Музыка"},
+			},
+		},
+	}
+}
@@ -0,0 +1,210 @@
+package subjects
+
+import (
+	"strings"
+	"unicode"
+)
+
+// fillerWords are dropped from captions, so "дз по алгебре" still names a subject
+var fillerWords = map[string]bool{
+	"дз":       true,
+	"домашка":  true,
+	"домашку":  true,
+	"домашнее": true,
+	"задание":  true,
+	"по":       true,
+	"hw":       true,
+}
+
+// minPrefixLen keeps one- and two-letter captions from matching half the timetable
+const minPrefixLen = 3
+
+// Normalize lowercases s, folds ё to е, turns punctuation into spaces and drops filler words
+func Normalize(s string) string {
+	s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	kept := words[:0]
+	for _, word := range words {
+		if !fillerWords[word] {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// Resolve matches free-form input against the candidate subject names. Aliases map a
+// normalized alias to a subject name and are applied first. Matching then tries, in
+// order, exact names, prefixes of the name or one of its words, and finally names
+// within a small edit distance. The first step that matches wins; if it matches more
+// than one subject the result is ambiguous and all of them are returned instead.
+// When the whole input matches nothing, trailing words are dropped one by one, so
+// "алгебра стр 45" resolves like "алгебра". Fuzzy matches are only tried once no
+// prefix of the input matches exactly or by prefix.
+func Resolve(input string, candidates []string, aliases map[string]string) (string, []string) {
+	match, ambiguous, _ := ResolvePrefix(input, candidates, aliases)
+	return match, ambiguous
+}
+
+// ResolvePrefix is Resolve that also returns the words of input left after the
+// subject, as they were written: "Алгебра стр. 45" gives "Алгебра" and "стр. 45".
+func ResolvePrefix(input string, candidates []string, aliases map[string]string) (string, []string, string) {
+	words := strings.Fields(input)
+	for _, fuzzy := range []bool{false, true} {
+		for n := len(words); n > 0; n-- {
+			// A trailing word without letters or digits, like "-", belongs to the rest
+			if Normalize(words[n-1]) == "" {
+				continue
+			}
+			query := Normalize(strings.Join(words[:n], " "))
+			if target, ok := aliases[query]; ok {
+				query = Normalize(target)
+			}
+
+			if match, ambiguous := resolve(query, candidates, fuzzy); match != "" || len(ambiguous) > 0 {
+				return match, ambiguous, strings.Join(words[n:], " ")
+			}
+		}
+	}
+	return "", nil, ""
+}
+
+func resolve(query string, candidates []string, fuzzy bool) (string, []string) {
+	names := unique(candidates)
+	normalized := make([]string, len(names))
+	for i, name := range names {
+		normalized[i] = Normalize(name)
+	}
+
+	steps := []func(string) int{
+		func(name string) int {
+			if name == query {
+				return 0
+			}
+			return -1
+		},
+		func(name string) int {
+			if len([]rune(query)) < minPrefixLen {
+				return -1
+			}
+			if strings.HasPrefix(name, query) {
+				return 0
+			}
+			for _, word := range strings.Fields(name) {
+				if strings.HasPrefix(word, query) {
+					return 0
+				}
+			}
+			return -1
+		},
+		func(name string) int {
+			limit := maxDistance(query)
+			best := -1
+			for _, word := range append([]string{name}, strings.Fields(name)...) {
+				// A typo in a prefix ("анлгийск") should still count
+				if d := distance(query, truncate(word, len([]rune(query)))); d <= limit && len([]rune(query)) >= minPrefixLen {
+					if best == -1 || d < best {
+						best = d
+					}
+				}
+				if d := distance(query, word); d <= limit && (best == -1 || d < best) {
+					best = d
+				}
+			}
+			return best
+		},
+	}
+
+	if !fuzzy {
+		steps = steps[:2]
+	}
+
+	for _, score := range steps {
+		best := -1
+		var matches []string
+		for i, name := range normalized {
+			s := score(name)
+			switch {
+			case s < 0:
+			case best == -1 || s < best:
+				best = s
+				matches = []string{names[i]}
+			case s == best:
+				matches = append(matches, names[i])
+			}
+		}
+
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+		if len(matches) > 1 {
+			return "", matches
+		}
+	}
+
+	return "", nil
+}
+
+func unique(names []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, name := range names {
+		key := Normalize(name)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func maxDistance(s string) int {
+	switch n := len([]rune(s)); {
+	case n <= 3:
+		return 0
+	case n <= 5:
+		return 1
+	case n <= 9:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// distance is the optimal string alignment distance: insertions, deletions,
+// substitutions and swaps of adjacent letters each cost one
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
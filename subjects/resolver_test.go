@@ -0,0 +1,80 @@
+package subjects
+
+import (
+	"slices"
+	"testing"
+)
+
+var timetable = []string{"Алгебра", "Геометрия", "Русский язык", "Литература", "Английский язык", "История", "Информатика"}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		aliases       map[string]string
+		want          string
+		wantAmbiguous []string
+	}{
+		{name: "exact match", input: "Алгебра", want: "Алгебра"},
+		{name: "case and filler words", input: "дз по ГЕОМЕТРИИ", want: "Геометрия"},
+		{name: "alias", input: "Матеша", aliases: map[string]string{"матеша": "Алгебра"}, want: "Алгебра"},
+		{name: "prefix", input: "алг", want: "Алгебра"},
+		{name: "prefix of a later word", input: "англ", want: "Английский язык"},
+		{name: "one-letter typo", input: "Алгебар", want: "Алгебра"},
+		{name: "typo in a prefix", input: "анлгийск", want: "Английский язык"},
+		{name: "ambiguous prefix", input: "язык", wantAmbiguous: []string{"Русский язык", "Английский язык"}},
+		{name: "shortest prefix", input: "инф", want: "Информатика"},
+		{name: "too short for a prefix", input: "ал"},
+		{name: "no match", input: "Физика"},
+		{name: "empty", input: ""},
+		{name: "trailing words", input: "Литература стр. 45", want: "Литература"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ambiguous := Resolve(tt.input, timetable, tt.aliases)
+			if match != tt.want || !slices.Equal(ambiguous, tt.wantAmbiguous) {
+				t.Errorf("Resolve(%q) = %q, %q, want %q, %q", tt.input, match, ambiguous, tt.want, tt.wantAmbiguous)
+			}
+		})
+	}
+}
+
+func TestResolvePrefix(t *testing.T) {
+	tests := []struct {
+		input    string
+		want     string
+		wantRest string
+	}{
+		{input: "Алгебра стр. 45 №3-7", want: "Алгебра", wantRest: "стр. 45 №3-7"},
+		{input: "русский язык упр. 12", want: "Русский язык", wantRest: "упр. 12"},
+		{input: "англ выучить слова", want: "Английский язык", wantRest: "выучить слова"},
+		{input: "Алгебра -", want: "Алгебра", wantRest: "-"},
+		{input: "Геометрея стр. 12", want: "Геометрия", wantRest: "стр. 12"},
+		{input: "Физика стр. 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			match, _, rest := ResolvePrefix(tt.input, timetable, nil)
+			if match != tt.want || rest != tt.wantRest {
+				t.Errorf("ResolvePrefix(%q) = %q, %q, want %q, %q", tt.input, match, rest, tt.want, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "Алгебра", want: "алгебра"},
+		{input: "  Дз по ХИМИИ!! ", want: "химии"},
+		{input: "Ёлка, ёж", want: "елка еж"},
+		{input: "hw", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.input); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
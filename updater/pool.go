@@ -0,0 +1,68 @@
+package updater
+
+import (
+	"runtime/debug"
+
+	"dashka-homework-bot/logger"
+)
+
+// pool runs jobs on a fixed number of workers. Every chat is pinned to one worker, so
+// jobs of the same chat, such as the updates of one album, run in the order they were
+// submitted while different chats proceed in parallel.
+type pool struct {
+	queues []chan job
+}
+
+// job is a unit of work for one chat. name identifies it in logs.
+type job struct {
+	name string
+	run  func()
+}
+
+func newPool(workers, queueSize int) *pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	p := &pool{queues: make([]chan job, workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan job, queueSize)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// submit queues the job for the worker of the chat key. It blocks while that worker's
+// queue is full, which slows down polling or the webhook response instead of piling up memory.
+func (p *pool) submit(key uint64, name string, run func()) {
+	p.queues[key%uint64(len(p.queues))] <- job{name: name, run: run}
+}
+
+func (p *pool) work(queue chan job) {
+	for j := range queue {
+		p.process(j)
+	}
+}
+
+func (p *pool) process(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Panic while handling %s: %v\n%s", j.name, r, debug.Stack())
+		}
+	}()
+	j.run()
+}
+
+// chatKey picks the chat an update belongs to, falling back to the sender
+func chatKey(update botUpdate) uint64 {
+	if chat := update.FromChat(); chat != nil {
+		return uint64(chat.ID)
+	}
+	if user := update.SentFrom(); user != nil {
+		return uint64(user.ID)
+	}
+	return uint64(update.UpdateID)
+}
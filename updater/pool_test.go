@@ -0,0 +1,91 @@
+package updater
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		chats   []uint64
+		// wantMax is how many jobs must have run at once
+		wantMax int
+	}{
+		{name: "two chats on two workers", workers: 4, chats: []uint64{1, 2}, wantMax: 2},
+		{name: "two chats on one worker", workers: 1, chats: []uint64{1, 2}, wantMax: 1},
+		{name: "two chats on the same worker", workers: 4, chats: []uint64{1, 5}, wantMax: 1},
+		{name: "one chat", workers: 4, chats: []uint64{3}, wantMax: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const jobsPerChat = 20
+			p := newPool(tt.workers, 5)
+
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			runningChats := make(map[uint64]bool)
+			order := make(map[uint64][]int)
+			var wg sync.WaitGroup
+
+			// Jobs of the chats are interleaved: chat 1 job 0, chat 2 job 0, chat 1 job 1...
+			for i := 0; i < jobsPerChat; i++ {
+				for _, chat := range tt.chats {
+					wg.Add(1)
+					p.submit(chat, fmt.Sprintf("chat %d job %d", chat, i), func() {
+						defer wg.Done()
+
+						mu.Lock()
+						if runningChats[chat] {
+							t.Errorf("chat %d runs two jobs at once", chat)
+						}
+						runningChats[chat] = true
+						running++
+						maxRunning = max(maxRunning, running)
+						order[chat] = append(order[chat], i)
+						mu.Unlock()
+
+						time.Sleep(2 * time.Millisecond)
+
+						mu.Lock()
+						runningChats[chat] = false
+						running--
+						mu.Unlock()
+					})
+				}
+			}
+			wg.Wait()
+
+			want := make([]int, jobsPerChat)
+			for i := range want {
+				want[i] = i
+			}
+			for _, chat := range tt.chats {
+				if !slices.Equal(order[chat], want) {
+					t.Errorf("chat %d ran jobs in order %v", chat, order[chat])
+				}
+			}
+			if maxRunning != tt.wantMax {
+				t.Errorf("at most %d jobs ran at once, want %d", maxRunning, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestPoolSurvivesPanic(t *testing.T) {
+	p := newPool(1, 1)
+
+	done := make(chan struct{})
+	p.submit(1, "panicking job", func() { panic("boom") })
+	p.submit(1, "next job", func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the worker stopped after a panic")
+	}
+}
@@ -0,0 +1,156 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	blobmemory "dashka-homework-bot/blobstore/memory"
+	"dashka-homework-bot/handlers"
+	"dashka-homework-bot/storage"
+	"dashka-homework-bot/storage/memory"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testToken   = "TEST"
+	testChatID  = 42
+	testSubject = "Алгебра"
+)
+
+// fakeTelegram answers the Bot API requests the handlers make and records the texts
+// of the messages sent
+type fakeTelegram struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (f *fakeTelegram) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Downloads return the file path, so every file has different bytes
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		return response(r.URL.Path), nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	var result any = true
+	switch r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:] {
+	case "getMe":
+		result = tgbotapi.User{ID: 1, IsBot: true, UserName: "test_bot"}
+	case "getFile":
+		result = tgbotapi.File{FileID: r.Form.Get("file_id"), FilePath: "photos/" + r.Form.Get("file_id") + ".jpg"}
+	case "sendMessage":
+		f.mu.Lock()
+		f.sent = append(f.sent, r.Form.Get("text"))
+		f.mu.Unlock()
+		result = tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: testChatID}}
+	}
+
+	data, err := json.Marshal(map[string]any{"ok": true, "result": result})
+	if err != nil {
+		return nil, err
+	}
+	return response(string(data)), nil
+}
+
+func response(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// messages returns the texts sent so far
+func (f *fakeTelegram) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.sent...)
+}
+
+// waitSent waits until n messages were sent and returns them
+func (f *fakeTelegram) waitSent(t *testing.T, n int, timeout time.Duration) []string {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		sent := f.messages()
+		if len(sent) >= n {
+			return sent
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages, want %d: %q", len(sent), n, sent)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newTestUpdater returns an updater backed by memory storage and a fake Bot API, with
+// a student who has testSubject every day
+func newTestUpdater(t *testing.T, workers int) (*Updater, *fakeTelegram) {
+	t.Helper()
+	telegram := &fakeTelegram{}
+
+	// File downloads use the default client
+	transport := http.DefaultTransport
+	http.DefaultTransport = telegram
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	bot, err := tgbotapi.NewBotAPIWithClient(testToken, tgbotapi.APIEndpoint, &http.Client{Transport: telegram})
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+
+	ctx := context.Background()
+	db := memory.NewHomeworkDatabase()
+	userID := "7"
+	if err := db.CreateUser(ctx, userID, "student"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRole(ctx, userID, storage.RoleStudent); err != nil {
+		t.Fatal(err)
+	}
+	schedule := storage.EmptySchedule()
+	for i := range schedule {
+		schedule[i].Subjects = []storage.Subject{{SubjectName: testSubject}}
+	}
+	if err := db.SetSchedule(ctx, userID, schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	h := handlers.NewHandler(bot, db, blobmemory.NewStore(), nil)
+	return NewUpdater(bot, h, workers, 10), telegram
+}
+
+// messageUpdate is an update with a message of the test student
+func messageUpdate(messageID int, update func(message *tgbotapi.Message)) botUpdate {
+	message := &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: 7, UserName: "student"},
+		Chat:      &tgbotapi.Chat{ID: testChatID},
+		Date:      int(time.Now().Unix()),
+	}
+	update(message)
+	return botUpdate{Update: tgbotapi.Update{UpdateID: messageID, Message: message}}
+}
+
+// albumPart is an update with one photo of an album
+func albumPart(messageID int, mediaGroupID, caption string) botUpdate {
+	return messageUpdate(messageID, func(message *tgbotapi.Message) {
+		message.MediaGroupID = mediaGroupID
+		message.Caption = caption
+		message.Photo = []tgbotapi.PhotoSize{{FileID: fmt.Sprintf("photo%d", messageID), FileUniqueID: fmt.Sprintf("unique%d", messageID)}}
+	})
+}
+
+// textMessage is an update with a text message
+func textMessage(messageID int, text string) botUpdate {
+	return messageUpdate(messageID, func(message *tgbotapi.Message) { message.Text = text })
+}
@@ -0,0 +1,40 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"dashka-homework-bot/handlers"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// allowedUpdates are the update types the bot asks Telegram for
+var allowedUpdates = []string{"message", "callback_query"}
+
+// botUpdate is a Telegram update together with the message fields the library predates
+type botUpdate struct {
+	tgbotapi.Update
+	// usersShared is set when the user picked someone with a request_users button
+	usersShared *handlers.UsersShared
+}
+
+func decodeUpdate(data []byte) (botUpdate, error) {
+	var u botUpdate
+	if err := json.Unmarshal(data, &u.Update); err != nil {
+		return botUpdate{}, fmt.Errorf("failed to decode update: %w", err)
+	}
+
+	var extra struct {
+		Message *struct {
+			UsersShared *handlers.UsersShared `json:"users_shared"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return botUpdate{}, fmt.Errorf("failed to decode update: %w", err)
+	}
+	if extra.Message != nil {
+		u.usersShared = extra.Message.UsersShared
+	}
+	return u, nil
+}
@@ -1,6 +1,10 @@
 package updater
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"dashka-homework-bot/logger"
 
 	"dashka-homework-bot/handlers"
@@ -8,55 +12,157 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+const (
+	pollTimeout    = 30
+	pollRetryDelay = 3 * time.Second
+)
+
 type Updater struct {
 	bot      *tgbotapi.BotAPI
 	handlers *handlers.Handler
+	pool     *pool
 }
 
-func NewUpdater(bot *tgbotapi.BotAPI, handlers *handlers.Handler) *Updater {
-	return &Updater{
+// NewUpdater handles updates on the given number of workers, each with a queue of
+// queueSize updates
+func NewUpdater(bot *tgbotapi.BotAPI, handlers *handlers.Handler, workers, queueSize int) *Updater {
+	u := &Updater{
 		bot:      bot,
 		handlers: handlers,
 	}
+	u.pool = newPool(workers, queueSize)
+	// Albums are flushed on the worker of their chat, in order with its updates
+	handlers.SetChatRunner(func(chatID int64, name string, run func()) {
+		u.pool.submit(uint64(chatID), name, run)
+	})
+	return u
 }
 
-func (u *Updater) PollUpdates() {
-	updateConfig := tgbotapi.NewUpdate(0)
-	updateConfig.Timeout = 30
+// submit queues an update on the worker of its chat
+func (u *Updater) submit(update botUpdate) {
+	u.pool.submit(chatKey(update), fmt.Sprintf("update %d", update.UpdateID), func() { u.handleUpdate(update) })
+}
 
-	updates := u.bot.GetUpdatesChan(updateConfig)
+func (u *Updater) PollUpdates() {
+	// getUpdates is refused while a webhook is set, e.g. after running in webhook mode
+	if _, err := u.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		logger.Error("Failed to delete webhook: %v", err)
+	}
 
-	for update := range updates {
-		// Ignore any non-Message updates
-		if update.Message == nil {
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID,
-				"Пожалуйста, отправьте фото(снимки) вашего домашнего задания с подписью, содержащей название предмета.")
-			u.bot.Send(msg)
+	offset := 0
+	for {
+		updates, next, err := u.getUpdates(offset)
+		if err != nil {
+			logger.Error("Failed to get updates, retrying in %s: %v", pollRetryDelay, err)
+			time.Sleep(pollRetryDelay)
 			continue
 		}
 
-		logger.Info("[Message from %s] %s", update.Message.From.UserName, update.Message.Text)
+		offset = next
+		for _, update := range updates {
+			u.submit(update)
+		}
+	}
+}
 
-		// Check if it's a command
-		if update.Message.IsCommand() {
-			u.handlers.HandleCommand(update.Message)
-			continue
+// getUpdates long-polls for updates after offset and returns them with the next
+// offset. The library's update channel is not used because it drops users_shared.
+func (u *Updater) getUpdates(offset int) ([]botUpdate, int, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero("offset", offset)
+	params.AddNonZero("timeout", pollTimeout)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return nil, offset, fmt.Errorf("failed to encode allowed updates: %w", err)
+	}
+
+	resp, err := u.bot.MakeRequest("getUpdates", params)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &raw); err != nil {
+		return nil, offset, fmt.Errorf("failed to decode updates: %w", err)
+	}
+
+	var updates []botUpdate
+	for _, data := range raw {
+		var id struct {
+			UpdateID int `json:"update_id"`
+		}
+		if err := json.Unmarshal(data, &id); err == nil && id.UpdateID >= offset {
+			offset = id.UpdateID + 1
 		}
 
-		// Handle media messages
-		if update.Message.Photo != nil {
-			// Media messages will be handled by HandleMessage
-			// It will take care of both single photos and photo albums
-			u.handlers.HandleMessage(update.Message)
+		// A malformed update is skipped rather than fetched again forever
+		update, err := decodeUpdate(data)
+		if err != nil {
+			logger.Error("Skipping update %d: %v", id.UpdateID, err)
 			continue
 		}
+		updates = append(updates, update)
+	}
+	return updates, offset, nil
+}
 
-		// Handle other text messages
-		if update.Message.Text != "" {
-			msg := tgbotapi.NewMessage(update.Message.Chat.ID,
-				"Пожалуйста, отправьте фото(снимки) вашего домашнего задания с подписью, содержащей название предмета.")
-			u.bot.Send(msg)
-			continue
+// handleUpdate routes one update to the handlers, however it was received
+func (u *Updater) handleUpdate(update botUpdate) {
+	// An album still being collected is submitted before anything sent after it
+	if chat := update.FromChat(); chat != nil {
+		mediaGroupID := ""
+		if update.Message != nil {
+			mediaGroupID = update.Message.MediaGroupID
 		}
+		u.handlers.FlushAlbums(chat.ID, mediaGroupID)
+	}
+
+	// Inline keyboard presses
+	if update.CallbackQuery != nil {
+		u.handlers.HandleCallback(update.CallbackQuery)
+		return
+	}
+
+	// Ignore any other non-Message updates
+	if update.Message == nil {
+		return
 	}
+
+	logger.Info("[Message from %s] %s", update.Message.From.UserName, update.Message.Text)
+
+	// A user picked with the /addstudent keyboard button
+	if update.usersShared != nil {
+		u.handlers.HandleUsersShared(update.Message, *update.usersShared)
+		return
+	}
+
+	// Check if it's a command
+	if update.Message.IsCommand() {
+		u.handlers.HandleCommand(update.Message)
+		return
+	}
+
+	// Documents are timetable imports or homework
+	if update.Message.Document != nil {
+		u.handlers.HandleDocument(update.Message)
+		return
+	}
+
+	// Handle media messages
+	if isMedia(update.Message) {
+		// Media messages will be handled by HandleMessage
+		// It will take care of both single files and albums
+		u.handlers.HandleMessage(update.Message)
+		return
+	}
+
+	// Handle other text messages
+	if update.Message.Text != "" {
+		u.handlers.HandleText(update.Message)
+	}
+}
+
+// isMedia reports whether the message is a photo, voice, audio, video or video note
+func isMedia(message *tgbotapi.Message) bool {
+	return message.Photo != nil || message.Voice != nil || message.Audio != nil ||
+		message.Video != nil || message.VideoNote != nil
 }
@@ -0,0 +1,43 @@
+package updater
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkSent(t *testing.T, sent []string, prefixes ...string) {
+	t.Helper()
+	if len(sent) != len(prefixes) {
+		t.Fatalf("sent %q, want %d messages", sent, len(prefixes))
+	}
+	for i, prefix := range prefixes {
+		if !strings.HasPrefix(sent[i], prefix) {
+			t.Errorf("message %d = %q, want it to start with %q", i+1, sent[i], prefix)
+		}
+	}
+}
+
+func TestAlbumIsSavedBeforeLaterMessage(t *testing.T) {
+	u, telegram := newTestUpdater(t, 4)
+
+	u.submit(albumPart(1, "album", testSubject))
+	u.submit(albumPart(2, "album", ""))
+	u.submit(textMessage(3, testSubject+": №5"))
+
+	// The text arrives within albumWindow, so it must flush the album first
+	sent := telegram.waitSent(t, 3, time.Second)
+	checkSent(t, sent, "Обрабатываю домашку", "Сохранил 2 стр.", "Записал ответ")
+}
+
+func TestAlbumIsSavedAfterWindow(t *testing.T) {
+	u, telegram := newTestUpdater(t, 4)
+
+	u.submit(albumPart(1, "album", ""))
+	u.submit(albumPart(2, "album", testSubject))
+	u.submit(albumPart(3, "album", ""))
+
+	// Nothing follows the album, so it is saved once no part arrived for a while
+	sent := telegram.waitSent(t, 2, 5*time.Second)
+	checkSent(t, sent, "Обрабатываю домашку", "Сохранил 3 стр.")
+}
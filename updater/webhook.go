@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"dashka-homework-bot/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+	maxUpdateSize     = 1 << 20
+)
+
+// WebhookConfig describes where Telegram delivers updates in webhook mode
+type WebhookConfig struct {
+	// ListenAddr is the local address of the HTTP server, e.g. ":8080"
+	ListenAddr string
+	// Path is the URL path updates are posted to
+	Path string
+	// PublicURL is the HTTPS address registered with Telegram. When empty the
+	// webhook is not registered, which is handy for posting updates by hand.
+	PublicURL string
+	// SecretToken must be sent by Telegram in the X-Telegram-Bot-Api-Secret-Token header
+	SecretToken string
+}
+
+// ServeWebhook registers the webhook with Telegram and serves updates until the server fails
+func (u *Updater) ServeWebhook(config WebhookConfig) error {
+	if config.SecretToken == "" {
+		return fmt.Errorf("webhook secret token is required")
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+
+	if config.PublicURL != "" {
+		if err := u.setWebhook(config); err != nil {
+			return err
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(config.Path, u.WebhookHandler(config.SecretToken))
+
+	server := &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logger.Info("Listening for webhook updates on %s%s", config.ListenAddr, config.Path)
+	return server.ListenAndServe()
+}
+
+// WebhookHandler accepts Telegram updates posted as JSON and feeds them to the handlers.
+// Requests without the matching secret token are rejected, updates that can't be
+// decoded are logged and dropped.
+func (u *Updater) WebhookHandler(secretToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secretToken)) != 1 {
+			logger.Warning("Rejected webhook request from %s: bad secret token", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUpdateSize))
+		if err != nil {
+			logger.Error("Failed to read webhook update: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// Telegram retries an update until it is accepted, so one that can't be decoded
+		// is dropped rather than left to hold up the updates after it
+		update, err := decodeUpdate(data)
+		if err != nil {
+			logger.Error("Dropping webhook update that failed to decode: %v", err)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		u.submit(update)
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// setWebhook registers the webhook. The library's WebhookConfig has no secret_token,
+// so the request is made directly.
+func (u *Updater) setWebhook(config WebhookConfig) error {
+	link, err := url.Parse(config.PublicURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", config.PublicURL, err)
+	}
+
+	params := tgbotapi.Params{}
+	params["url"] = link.String()
+	params["secret_token"] = config.SecretToken
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return fmt.Errorf("failed to encode allowed updates: %w", err)
+	}
+
+	if _, err := u.bot.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	logger.Info("Webhook registered at %s", link.Redacted())
+	return nil
+}
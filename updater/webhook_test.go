@@ -0,0 +1,60 @@
+package updater
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+func TestWebhookHandler(t *testing.T) {
+	const update = `{"update_id": 1, "message": {"message_id": 1, "date": 1700000000,
+		"from": {"id": 7, "is_bot": false, "first_name": "Ученик", "username": "student"},
+		"chat": {"id": 42, "type": "private"},
+		"text": "/help", "entities": [{"type": "bot_command", "offset": 0, "length": 5}]}}`
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		body   string
+		want   int
+		// sent is how many messages the update makes the bot send
+		sent int
+	}{
+		{name: "valid update", method: http.MethodPost, token: testSecret, body: update, want: http.StatusOK, sent: 1},
+		{name: "missing token", method: http.MethodPost, body: update, want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, token: "wrong", body: update, want: http.StatusUnauthorized},
+		{name: "malformed body", method: http.MethodPost, token: testSecret, body: `{"update_id": `, want: http.StatusOK},
+		{name: "malformed body, wrong token", method: http.MethodPost, token: "wrong", body: `{"update_id": `, want: http.StatusUnauthorized},
+		{name: "not a post", method: http.MethodGet, token: testSecret, want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, telegram := newTestUpdater(t, 1)
+
+			r := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set(secretTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			u.WebhookHandler(testSecret).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+
+			// Give a dispatched update time to reach the bot
+			if tt.sent > 0 {
+				telegram.waitSent(t, tt.sent, time.Second)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if sent := telegram.messages(); len(sent) != tt.sent {
+				t.Errorf("sent %q, want %d messages", sent, tt.sent)
+			}
+		})
+	}
+}